@@ -0,0 +1,13 @@
+package certrotation_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestCertRotation(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Cert Rotation Suite")
+}
@@ -0,0 +1 @@
+package certrotation // import "code.cloudfoundry.org/route-emitter/certrotation"
@@ -0,0 +1,264 @@
+package certrotation
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/tlsconfig"
+)
+
+// DefaultCheckInterval is how often the files are checked for new material,
+// unless configured otherwise.
+const DefaultCheckInterval = time.Minute
+
+// Files are the PEM files of a client certificate and its key, and of the CA
+// that signs the certificates of the servers.
+type Files struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+// Rotator keeps the TLS material of a client up to date with its files. The
+// configs it returns present the current certificate and verify the servers
+// against the current CA on every new connection, connections that are
+// already established are not affected. The time until the certificate
+// expires is reported on every check.
+type Rotator struct {
+	logger        lager.Logger
+	clock         clock.Clock
+	metronClient  loggingclient.IngressClient
+	expiryMetric  string
+	files         Files
+	checkInterval time.Duration
+
+	lock        sync.RWMutex
+	contents    [][]byte
+	certificate *tls.Certificate
+	leaf        *x509.Certificate
+	caPool      *x509.CertPool
+	onRotate    []func()
+}
+
+// NewRotator loads the files and returns a rotator that checks them every
+// check interval once it runs. name identifies the client in the logs and
+// expiryMetric is the name of the metric the time until the certificate
+// expires is sent as.
+func NewRotator(
+	logger lager.Logger,
+	clock clock.Clock,
+	metronClient loggingclient.IngressClient,
+	name, expiryMetric string,
+	files Files,
+	checkInterval time.Duration,
+) (*Rotator, error) {
+	if checkInterval <= 0 {
+		checkInterval = DefaultCheckInterval
+	}
+
+	r := &Rotator{
+		logger:        logger.Session("cert-rotation", lager.Data{"client": name}),
+		clock:         clock,
+		metronClient:  metronClient,
+		expiryMetric:  expiryMetric,
+		files:         files,
+		checkInterval: checkInterval,
+	}
+
+	contents, err := r.readFiles()
+	if err != nil {
+		return nil, err
+	}
+	err = r.load(contents)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// OnRotate registers a callback that is called after new material was
+// loaded, e.g. to replace connections that should present it right away.
+func (r *Rotator) OnRotate(callback func()) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.onRotate = append(r.onRotate, callback)
+}
+
+// ClientTLSConfig returns a client config that uses the current material.
+// crypto/tls does not pass the name of a server that is addressed by IP to
+// the verification, the certificate of such a server has to be valid for one
+// of the serverNames instead.
+func (r *Rotator) ClientTLSConfig(serverNames ...string) (*tls.Config, error) {
+	tlsConfig, err := tlsconfig.Build(tlsconfig.WithInternalServiceDefaults()).Client()
+	if err != nil {
+		return nil, err
+	}
+
+	// the server is verified by VerifyConnection, against the current CA
+	tlsConfig.InsecureSkipVerify = true
+	tlsConfig.VerifyConnection = r.verifyConnection(serverNames)
+	tlsConfig.GetClientCertificate = r.getClientCertificate
+	return tlsConfig, nil
+}
+
+func (r *Rotator) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	r.logger.Info("started", lager.Data{"check-interval": r.checkInterval.String()})
+	defer r.logger.Info("stopped")
+
+	r.sendExpiry()
+	ticker := r.clock.NewTicker(r.checkInterval)
+	defer ticker.Stop()
+
+	close(ready)
+	for {
+		select {
+		case <-ticker.C():
+			r.check()
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+// check loads the files if any of them changed. New material that cannot be
+// loaded is logged and the current material is kept.
+func (r *Rotator) check() {
+	defer r.sendExpiry()
+
+	contents, err := r.readFiles()
+	if err != nil {
+		r.logger.Error("failed-to-read-files", err, r.fileData())
+		return
+	}
+
+	r.lock.RLock()
+	changed := false
+	for i := range contents {
+		if !bytes.Equal(contents[i], r.contents[i]) {
+			changed = true
+		}
+	}
+	r.lock.RUnlock()
+	if !changed {
+		return
+	}
+
+	err = r.load(contents)
+	if err != nil {
+		r.logger.Error("failed-to-load-rotated-material", err, r.fileData())
+		return
+	}
+
+	r.lock.RLock()
+	callbacks := r.onRotate
+	expires := r.leaf.NotAfter
+	r.lock.RUnlock()
+
+	r.logger.Info("rotated", lager.Data{"expires": expires})
+	for _, callback := range callbacks {
+		callback()
+	}
+}
+
+func (r *Rotator) readFiles() ([][]byte, error) {
+	contents := [][]byte{}
+	for _, file := range []string{r.files.CertFile, r.files.KeyFile, r.files.CAFile} {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, content)
+	}
+	return contents, nil
+}
+
+func (r *Rotator) load(contents [][]byte) error {
+	certificate, err := tls.X509KeyPair(contents[0], contents[1])
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return err
+	}
+
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(contents[2]) {
+		return fmt.Errorf("no certificates found in %s", r.files.CAFile)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.contents = contents
+	r.certificate = &certificate
+	r.leaf = leaf
+	r.caPool = caPool
+	return nil
+}
+
+func (r *Rotator) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.certificate, nil
+}
+
+func (r *Rotator) verifyConnection(serverNames []string) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("server did not present a certificate")
+		}
+
+		r.lock.RLock()
+		caPool := r.caPool
+		r.lock.RUnlock()
+
+		leaf := state.PeerCertificates[0]
+		intermediates := x509.NewCertPool()
+		for _, cert := range state.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         caPool,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			return err
+		}
+
+		if state.ServerName != "" {
+			return leaf.VerifyHostname(state.ServerName)
+		}
+		for _, serverName := range serverNames {
+			if leaf.VerifyHostname(serverName) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("x509: certificate is not valid for any of %s", strings.Join(serverNames, ", "))
+	}
+}
+
+func (r *Rotator) sendExpiry() {
+	r.lock.RLock()
+	expires := r.leaf.NotAfter
+	r.lock.RUnlock()
+
+	err := r.metronClient.SendDuration(r.expiryMetric, expires.Sub(r.clock.Now()))
+	if err != nil {
+		r.logger.Error("failed-to-send-expiry-metric", err)
+	}
+}
+
+func (r *Rotator) fileData() lager.Data {
+	return lager.Data{"cert-file": r.files.CertFile, "key-file": r.files.KeyFile, "ca-file": r.files.CAFile}
+}
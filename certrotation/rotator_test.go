@@ -0,0 +1,260 @@
+package certrotation_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/route-emitter/certrotation"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+)
+
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newAuthority(name string) authority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+	return authority{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// sign returns a PEM certificate and key for the name, valid until notAfter.
+func (a authority) sign(name string, notAfter time.Time) (*x509.Certificate, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, &key.PublicKey, a.key)
+	Expect(err).NotTo(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+	return cert,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+var _ = Describe("Rotator", func() {
+	var (
+		logger           *lagertest.TestLogger
+		clock            *fakeclock.FakeClock
+		fakeMetronClient *mfakes.FakeIngressClient
+		certDir          string
+		files            certrotation.Files
+		ca               authority
+		notAfter         time.Time
+		rotator          *certrotation.Rotator
+		process          ifrit.Process
+		rotations        chan struct{}
+	)
+
+	writeFiles := func(ca authority, notAfter time.Time) {
+		_, certPEM, keyPEM := ca.sign("client", notAfter)
+		Expect(ioutil.WriteFile(files.CertFile, certPEM, 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(files.KeyFile, keyPEM, 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(files.CAFile, ca.pem, 0600)).To(Succeed())
+	}
+
+	clientCertificate := func(tlsConfig *tls.Config) *x509.Certificate {
+		cert, err := tlsConfig.GetClientCertificate(&tls.CertificateRequestInfo{})
+		Expect(err).NotTo(HaveOccurred())
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		Expect(err).NotTo(HaveOccurred())
+		return leaf
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		clock = fakeclock.NewFakeClock(time.Now())
+		fakeMetronClient = &mfakes.FakeIngressClient{}
+
+		var err error
+		certDir, err = ioutil.TempDir("", "cert-rotation")
+		Expect(err).NotTo(HaveOccurred())
+		files = certrotation.Files{
+			CertFile: filepath.Join(certDir, "client.crt"),
+			KeyFile:  filepath.Join(certDir, "client.key"),
+			CAFile:   filepath.Join(certDir, "ca.crt"),
+		}
+
+		ca = newAuthority("ca")
+		notAfter = clock.Now().Add(10 * time.Hour).Truncate(time.Second)
+		writeFiles(ca, notAfter)
+
+		rotator, err = certrotation.NewRotator(logger, clock, fakeMetronClient, "bbs", "BBSClientCertTimeToExpiry", files, time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+
+		rotations = make(chan struct{}, 1)
+		rotator.OnRotate(func() { rotations <- struct{}{} })
+		process = ifrit.Invoke(rotator)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+		Expect(os.RemoveAll(certDir)).To(Succeed())
+	})
+
+	It("reports the time until the certificate expires", func() {
+		Expect(fakeMetronClient.SendDurationCallCount()).To(Equal(1))
+		name, value := fakeMetronClient.SendDurationArgsForCall(0)
+		Expect(name).To(Equal("BBSClientCertTimeToExpiry"))
+		Expect(value).To(Equal(notAfter.Sub(clock.Now())))
+
+		clock.WaitForWatcherAndIncrement(time.Minute)
+		Eventually(fakeMetronClient.SendDurationCallCount).Should(Equal(2))
+		_, value = fakeMetronClient.SendDurationArgsForCall(1)
+		Expect(value).To(Equal(notAfter.Sub(clock.Now())))
+	})
+
+	Context("when the files do not exist", func() {
+		It("returns an error", func() {
+			_, err := certrotation.NewRotator(logger, clock, fakeMetronClient, "bbs", "BBSClientCertTimeToExpiry", certrotation.Files{
+				CertFile: filepath.Join(certDir, "missing.crt"),
+				KeyFile:  files.KeyFile,
+				CAFile:   files.CAFile,
+			}, time.Minute)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("ClientTLSConfig", func() {
+		var tlsConfig *tls.Config
+
+		BeforeEach(func() {
+			var err error
+			tlsConfig, err = rotator.ClientTLSConfig("127.0.0.1")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("presents the certificate", func() {
+			Expect(clientCertificate(tlsConfig).NotAfter).To(Equal(notAfter))
+		})
+
+		It("verifies the server against the CA and the server name", func() {
+			serverCert, _, _ := ca.sign("bbs.service.cf.internal", notAfter)
+			Expect(tlsConfig.VerifyConnection(tls.ConnectionState{
+				ServerName:       "bbs.service.cf.internal",
+				PeerCertificates: []*x509.Certificate{serverCert},
+			})).To(Succeed())
+
+			Expect(tlsConfig.VerifyConnection(tls.ConnectionState{
+				ServerName:       "locket.service.cf.internal",
+				PeerCertificates: []*x509.Certificate{serverCert},
+			})).To(HaveOccurred())
+
+			otherServerCert, _, _ := newAuthority("other-ca").sign("bbs.service.cf.internal", notAfter)
+			Expect(tlsConfig.VerifyConnection(tls.ConnectionState{
+				ServerName:       "bbs.service.cf.internal",
+				PeerCertificates: []*x509.Certificate{otherServerCert},
+			})).To(HaveOccurred())
+		})
+
+		Context("when the server is addressed by IP", func() {
+			It("verifies the server against the server names", func() {
+				serverCert, _, _ := ca.sign("bbs.service.cf.internal", notAfter)
+				Expect(tlsConfig.VerifyConnection(tls.ConnectionState{
+					PeerCertificates: []*x509.Certificate{serverCert},
+				})).To(Succeed())
+
+				tlsConfig, err := rotator.ClientTLSConfig("10.0.0.1")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(tlsConfig.VerifyConnection(tls.ConnectionState{
+					PeerCertificates: []*x509.Certificate{serverCert},
+				})).To(MatchError(ContainSubstring("not valid for any of 10.0.0.1")))
+			})
+		})
+
+		Context("when the files are rotated", func() {
+			var (
+				newCA       authority
+				newNotAfter time.Time
+			)
+
+			BeforeEach(func() {
+				newCA = newAuthority("new-ca")
+				newNotAfter = notAfter.Add(24 * time.Hour)
+				writeFiles(newCA, newNotAfter)
+				clock.WaitForWatcherAndIncrement(time.Minute)
+				Eventually(rotations).Should(Receive())
+			})
+
+			It("uses the new material for new connections", func() {
+				Expect(logger).To(gbytes.Say("cert-rotation.rotated"))
+				Expect(clientCertificate(tlsConfig).NotAfter).To(Equal(newNotAfter))
+
+				serverCert, _, _ := newCA.sign("bbs.service.cf.internal", notAfter)
+				Expect(tlsConfig.VerifyConnection(tls.ConnectionState{
+					ServerName:       "bbs.service.cf.internal",
+					PeerCertificates: []*x509.Certificate{serverCert},
+				})).To(Succeed())
+
+				oldServerCert, _, _ := ca.sign("bbs.service.cf.internal", notAfter)
+				Expect(tlsConfig.VerifyConnection(tls.ConnectionState{
+					ServerName:       "bbs.service.cf.internal",
+					PeerCertificates: []*x509.Certificate{oldServerCert},
+				})).To(HaveOccurred())
+			})
+
+			It("reports the expiry of the new certificate", func() {
+				Eventually(fakeMetronClient.SendDurationCallCount).Should(Equal(2))
+				_, value := fakeMetronClient.SendDurationArgsForCall(1)
+				Expect(value).To(Equal(newNotAfter.Sub(clock.Now())))
+			})
+		})
+
+		Context("when the new files are invalid", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(files.KeyFile, []byte("not a key"), 0600)).To(Succeed())
+				clock.WaitForWatcherAndIncrement(time.Minute)
+			})
+
+			It("keeps the current material", func() {
+				Eventually(logger).Should(gbytes.Say("failed-to-load-rotated-material"))
+				Consistently(rotations).ShouldNot(Receive())
+				Expect(clientCertificate(tlsConfig).NotAfter).To(Equal(notAfter))
+			})
+		})
+	})
+})
@@ -1,8 +1,11 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"os"
+	"sort"
+	"time"
 
 	"code.cloudfoundry.org/debugserver"
 	loggingclient "code.cloudfoundry.org/diego-logging-client"
@@ -29,50 +32,189 @@ type OAuthConfig struct {
 	SkipCertVerify    bool                  `json:"skip_cert_verify"`
 }
 
+// FilterConfig limits the routes an emitter publishes. The shared isolation
+// segment is matched by an empty string.
+type FilterConfig struct {
+	IncludeDomains             []string `json:"include_domains,omitempty"`
+	ExcludeDomains             []string `json:"exclude_domains,omitempty"`
+	IncludeIsolationSegments   []string `json:"include_isolation_segments,omitempty"`
+	ExcludeIsolationSegments   []string `json:"exclude_isolation_segments,omitempty"`
+	IncludeRouterGroups        []string `json:"include_router_groups,omitempty"`
+	ExcludeRouterGroups        []string `json:"exclude_router_groups,omitempty"`
+	IncludeProcessGuidPrefixes []string `json:"include_process_guid_prefixes,omitempty"`
+	ExcludeProcessGuidPrefixes []string `json:"exclude_process_guid_prefixes,omitempty"`
+}
+
+const (
+	ExternalRouteType = "external"
+	InternalRouteType = "internal"
+)
+
+// The defaults of the fields that must be positive, they are used when a
+// config file leaves the field out. A zero in the file is kept, and rejected by
+// Validate.
+const (
+	DefaultSyncInterval                          = time.Minute
+	DefaultRouteEmittingWorkers                  = 20
+	DefaultUnregistrationInterval                = 5 * time.Second
+	DefaultUnregistrationSendCount               = 5
+	DefaultUnregistrationCacheCompactionInterval = time.Minute
+)
+
+// ExternalServiceConfig is a service that routes are broadcast to over NATS.
+// The service is greeted on <name>.greet and announces itself on
+// <name>.start, routes are published to <subject>.register and
+// <subject>.unregister. RouteType selects the external or the internal routes.
+// With TargetedStartEmit, a starting instance of the service that provides an
+// inbox gets the routes published to it instead of to all instances.
+type ExternalServiceConfig struct {
+	Name              string `json:"name"`
+	Subject           string `json:"subject,omitempty"`
+	RouteType         string `json:"route_type,omitempty"`
+	TargetedStartEmit bool   `json:"targeted_start_emit,omitempty"`
+}
+
 type RouteEmitterConfig struct {
-	BBSAddress                         string                `json:"bbs_address"`
-	BBSCACertFile                      string                `json:"bbs_ca_cert_file"`
-	BBSClientCertFile                  string                `json:"bbs_client_cert_file"`
-	BBSClientKeyFile                   string                `json:"bbs_client_key_file"`
-	BBSClientSessionCacheSize          int                   `json:"bbs_client_session_cache_size,omitempty"`
-	BBSMaxIdleConnsPerHost             int                   `json:"bbs_max_idle_conns_per_host,omitempty"`
-	CellID                             string                `json:"cell_id,omitempty"`
-	UUID                               string                `json:"uuid,omitempty"`
-	RegisterDirectInstanceRoutes       bool                  `json:"register_direct_instance_routes,omitempty"`
-	CommunicationTimeout               durationjson.Duration `json:"communication_timeout,omitempty"`
-	ConsulCluster                      string                `json:"consul_cluster,omitempty"`
-	ConsulDownModeNotificationInterval durationjson.Duration `json:"consul_down_mode_notification_interval,omitempty"`
-	ConsulSessionName                  string                `json:"consul_session_name,omitempty"`
-	HealthCheckAddress                 string                `json:"healthcheck_address,omitempty"`
-	LockRetryInterval                  durationjson.Duration `json:"lock_retry_interval,omitempty"`
-	LockTTL                            durationjson.Duration `json:"lock_ttl,omitempty"`
-	NATSAddresses                      string                `json:"nats_addresses,omitempty"`
-	NATSUsername                       string                `json:"nats_username,omitempty"`
-	NATSPassword                       string                `json:"nats_password,omitempty"`
-	NATSTLSEnabled                     bool                  `json:"nats_tls_enabled"`
-	NATSCACertFile                     string                `json:"nats_ca_cert_file"`
-	NATSClientCertFile                 string                `json:"nats_client_cert_file"`
-	NATSClientKeyFile                  string                `json:"nats_client_key_file"`
-	RouteEmittingWorkers               int                   `json:"route_emitting_workers,omitempty"`
-	SyncInterval                       durationjson.Duration `json:"sync_interval,omitempty"`
-	TCPRouteTTL                        durationjson.Duration `json:"tcp_route_ttl,omitempty"`
-	OAuth                              OAuthConfig           `json:"oauth"`
-	RoutingAPI                         RoutingAPIConfig      `json:"routing_api"`
-	EnableTCPEmitter                   bool                  `json:"enable_tcp_emitter"`
-	LoggregatorConfig                  loggingclient.Config  `json:"loggregator"`
-	ReportInterval                     durationjson.Duration `json:"report_interval,omitempty"`
-	UnregistrationInterval             durationjson.Duration `json:"unregistration_interval,omitempty"`
-	UnregistrationSendCount            int                   `json:"unregistration_send_count,omitempty"`
-	EnableInternalEmitter              bool                  `json:"enable_internal_emitter"`
-	ConsulEnabled                      bool                  `json:"consul_enabled"`
-	LocketEnabled                      bool                  `json:"locket_enabled"`
+	BBSAddress                            string                  `json:"bbs_address"`
+	BBSCACertFile                         string                  `json:"bbs_ca_cert_file"`
+	BBSClientCertFile                     string                  `json:"bbs_client_cert_file"`
+	BBSClientKeyFile                      string                  `json:"bbs_client_key_file"`
+	BBSClientSessionCacheSize             int                     `json:"bbs_client_session_cache_size,omitempty"`
+	BBSMaxIdleConnsPerHost                int                     `json:"bbs_max_idle_conns_per_host,omitempty"`
+	BBSSubscriptionRetryMinBackoff        durationjson.Duration   `json:"bbs_subscription_retry_min_backoff,omitempty"`
+	BBSSubscriptionRetryMaxBackoff        durationjson.Duration   `json:"bbs_subscription_retry_max_backoff,omitempty"`
+	BBSSubscriptionRetryJitter            float64                 `json:"bbs_subscription_retry_jitter,omitempty"`
+	BBSSubscriptionFailureThreshold       int                     `json:"bbs_subscription_failure_threshold,omitempty"`
+	CellID                                string                  `json:"cell_id,omitempty"`
+	UUID                                  string                  `json:"uuid,omitempty"`
+	ShardCount                            int                     `json:"shard_count,omitempty"`
+	ShardIndex                            int                     `json:"shard_index,omitempty"`
+	RegisterDirectInstanceRoutes          bool                    `json:"register_direct_instance_routes,omitempty"`
+	CommunicationTimeout                  durationjson.Duration   `json:"communication_timeout,omitempty"`
+	ConsulCluster                         string                  `json:"consul_cluster,omitempty"`
+	ConsulDownModeNotificationInterval    durationjson.Duration   `json:"consul_down_mode_notification_interval,omitempty"`
+	ConsulSessionName                     string                  `json:"consul_session_name,omitempty"`
+	HealthCheckAddress                    string                  `json:"healthcheck_address,omitempty"`
+	LockRetryInterval                     durationjson.Duration   `json:"lock_retry_interval,omitempty"`
+	LockTTL                               durationjson.Duration   `json:"lock_ttl,omitempty"`
+	NATSAddresses                         string                  `json:"nats_addresses,omitempty"`
+	NATSUsername                          string                  `json:"nats_username,omitempty"`
+	NATSPassword                          string                  `json:"nats_password,omitempty"`
+	NATSTLSEnabled                        bool                    `json:"nats_tls_enabled"`
+	NATSCACertFile                        string                  `json:"nats_ca_cert_file"`
+	NATSClientCertFile                    string                  `json:"nats_client_cert_file"`
+	NATSClientKeyFile                     string                  `json:"nats_client_key_file"`
+	RouteEmittingWorkers                  int                     `json:"route_emitting_workers,omitempty"`
+	RouteEmitSlices                       int                     `json:"route_emit_slices,omitempty"`
+	ExternalServices                      []ExternalServiceConfig `json:"external_services,omitempty"`
+	SyncInterval                          durationjson.Duration   `json:"sync_interval,omitempty"`
+	SyncIntervalJitter                    float64                 `json:"sync_interval_jitter,omitempty"`
+	SyncRetryMinBackoff                   durationjson.Duration   `json:"sync_retry_min_backoff,omitempty"`
+	SyncRetryMaxBackoff                   durationjson.Duration   `json:"sync_retry_max_backoff,omitempty"`
+	TriggerMinInterval                    durationjson.Duration   `json:"trigger_min_interval,omitempty"`
+	MaxDomainStaleness                    durationjson.Duration   `json:"max_domain_staleness,omitempty"`
+	EventCoalescingWindow                 durationjson.Duration   `json:"event_coalescing_window,omitempty"`
+	EventRecordingFile                    string                  `json:"event_recording_file,omitempty"`
+	TCPRouteTTL                           durationjson.Duration   `json:"tcp_route_ttl,omitempty"`
+	OAuth                                 OAuthConfig             `json:"oauth"`
+	RoutingAPI                            RoutingAPIConfig        `json:"routing_api"`
+	Filters                               FilterConfig            `json:"filters"`
+	EnableTCPEmitter                      bool                    `json:"enable_tcp_emitter"`
+	TCPRouteReconciliationInterval        durationjson.Duration   `json:"tcp_route_reconciliation_interval,omitempty"`
+	TCPRouteReconciliationDryRun          bool                    `json:"tcp_route_reconciliation_dry_run"`
+	LoggregatorConfig                     loggingclient.Config    `json:"loggregator"`
+	ReportInterval                        durationjson.Duration   `json:"report_interval,omitempty"`
+	UnregistrationInterval                durationjson.Duration   `json:"unregistration_interval,omitempty"`
+	UnregistrationSendCount               int                     `json:"unregistration_send_count,omitempty"`
+	UnregistrationCacheFile               string                  `json:"unregistration_cache_file,omitempty"`
+	UnregistrationCacheCompactionInterval durationjson.Duration   `json:"unregistration_cache_compaction_interval,omitempty"`
+	UnregistrationCacheMaxSize            int                     `json:"unregistration_cache_max_size,omitempty"`
+	UnregistrationCacheMaxAge             durationjson.Duration   `json:"unregistration_cache_max_age,omitempty"`
+	EnableInternalEmitter                 bool                    `json:"enable_internal_emitter"`
+	ConsulEnabled                         bool                    `json:"consul_enabled"`
+	LocketEnabled                         bool                    `json:"locket_enabled"`
+	CertRotationCheckInterval             durationjson.Duration   `json:"cert_rotation_check_interval,omitempty"`
 	lagerflags.LagerConfig
 	debugserver.DebugServerConfig
 	locket.ClientLocketConfig
 }
 
+// ExternalServiceConfigs returns the configured external services, with the
+// subject and route type defaulted. Without any configured services, the
+// routes are broadcast to the gorouter and, if internal routes are enabled,
+// to service discovery.
+func (c RouteEmitterConfig) ExternalServiceConfigs() []ExternalServiceConfig {
+	if len(c.ExternalServices) == 0 {
+		services := []ExternalServiceConfig{
+			{Name: "router", Subject: "router", RouteType: ExternalRouteType},
+		}
+		if c.EnableInternalEmitter {
+			services = append(services, ExternalServiceConfig{Name: "service-discovery", Subject: "service-discovery", RouteType: InternalRouteType})
+		}
+		return services
+	}
+
+	services := make([]ExternalServiceConfig, 0, len(c.ExternalServices))
+	for _, service := range c.ExternalServices {
+		if service.Subject == "" {
+			service.Subject = service.Name
+		}
+		if service.RouteType == "" {
+			service.RouteType = ExternalRouteType
+		}
+		services = append(services, service)
+	}
+	return services
+}
+
+// ChangedFields returns the JSON names of the top level fields that differ
+// between the configs, sorted by name. A nested object, e.g. routing_api,
+// changes as a whole.
+func ChangedFields(oldConfig, newConfig RouteEmitterConfig) ([]string, error) {
+	oldFields, err := jsonFields(oldConfig)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := jsonFields(newConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := []string{}
+	for name, value := range oldFields {
+		if newValue, ok := newFields[name]; !ok || !bytes.Equal(value, newValue) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range newFields {
+		if _, ok := oldFields[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+func jsonFields(c RouteEmitterConfig) (map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	err = json.Unmarshal(encoded, &fields)
+	return fields, err
+}
+
 func NewRouteEmitterConfig(configPath string) (RouteEmitterConfig, error) {
-	routeEmitterConfig := RouteEmitterConfig{}
+	// the file only overwrites the defaults of the fields it sets
+	routeEmitterConfig := RouteEmitterConfig{
+		SyncInterval:                          durationjson.Duration(DefaultSyncInterval),
+		RouteEmittingWorkers:                  DefaultRouteEmittingWorkers,
+		UnregistrationInterval:                durationjson.Duration(DefaultUnregistrationInterval),
+		UnregistrationSendCount:               DefaultUnregistrationSendCount,
+		UnregistrationCacheCompactionInterval: durationjson.Duration(DefaultUnregistrationCacheCompactionInterval),
+	}
 
 	configFile, err := os.Open(configPath)
 	if err != nil {
@@ -25,18 +25,36 @@ var _ = Describe("Config", func() {
 			"healthcheck_address": "127.0.0.1:8090",
 			"cell_id": "cellID",
 			"uuid": "bosh-boshy-bosh-bosh",
+			"shard_count": 3,
+			"shard_index": 1,
 			"consul_cluster": "consul.example.com",
 			"consul_session_name": "myconsulsession",
 			"communication_timeout":"2s",
 			"consul_down_mode_notification_interval": "2m",
 			"sync_interval": "4s",
+			"sync_interval_jitter": 0.1,
+			"sync_retry_min_backoff": "2s",
+			"sync_retry_max_backoff": "30s",
+			"trigger_min_interval": "15s",
+			"max_domain_staleness": "24h",
+			"event_coalescing_window": "200ms",
+			"event_recording_file": "/tmp/route-emitter-events.ndjson",
 			"bbs_address": "1.1.1.1:9091",
 			"bbs_ca_cert_file": "/tmp/bbs_ca_cert",
 			"bbs_client_cert_file": "/tmp/bbs_client_cert",
 			"bbs_client_key_file": "/tmp/bbs_client_key",
 			"bbs_client_session_cache_size": 100,
 			"bbs_max_idle_conns_per_host": 10,
+			"bbs_subscription_retry_min_backoff": "1s",
+			"bbs_subscription_retry_max_backoff": "30s",
+			"bbs_subscription_retry_jitter": 0.2,
+			"bbs_subscription_failure_threshold": 5,
 			"route_emitting_workers": 18,
+			"route_emit_slices": 30,
+			"external_services": [
+				{"name": "router", "route_type": "external"},
+				{"name": "edge-router", "subject": "edge-router.routes", "route_type": "external", "targeted_start_emit": true}
+			],
 			"nats_addresses": "http://127.0.0.2:4222",
 			"nats_username": "user",
 			"nats_password": "password",
@@ -50,6 +68,8 @@ var _ = Describe("Config", func() {
 			"log_level": "debug",
 			"debug_address": "127.0.0.1:9999",
 			"enable_tcp_emitter": true,
+			"tcp_route_reconciliation_interval": "5m",
+			"tcp_route_reconciliation_dry_run": true,
 			"enable_internal_emitter": true,
 			"register_direct_instance_routes": true,
 			"routing_api": {
@@ -59,11 +79,22 @@ var _ = Describe("Config", func() {
 				"client_cert_file": "/tmp/routing_api_client_cert_file",
 				"client_key_file": "/tmp/routing_api_client_key_file"
 			},
+			"filters": {
+				"include_isolation_segments": ["segment-a"],
+				"exclude_domains": ["internal"],
+				"include_router_groups": ["router-group-guid"],
+				"exclude_process_guid_prefixes": ["test-"]
+			},
 			"consul_enabled": true,
 			"locket_enabled": true,
+			"cert_rotation_check_interval": "30s",
 			"locket_address": "127.0.0.1:18018",
 			"locket_ca_cert_file": "locket-ca-cert",
 			"report_interval": "1m",
+			"unregistration_cache_file": "/var/vcap/data/route_emitter/unregistration_cache.json",
+			"unregistration_cache_compaction_interval": "30s",
+			"unregistration_cache_max_size": 50000,
+			"unregistration_cache_max_age": "10m",
 			"locket_client_cert_file": "locket-client-cert",
 			"locket_client_key_file": "locket-client-key",
 			"oauth": {
@@ -116,8 +147,17 @@ var _ = Describe("Config", func() {
 			ConsulCluster:                      "consul.example.com",
 			CellID:                             "cellID",
 			UUID:                               "bosh-boshy-bosh-bosh",
+			ShardCount:                         3,
+			ShardIndex:                         1,
 			CommunicationTimeout:               durationjson.Duration(2 * time.Second),
 			SyncInterval:                       durationjson.Duration(4 * time.Second),
+			SyncIntervalJitter:                 0.1,
+			SyncRetryMinBackoff:                durationjson.Duration(2 * time.Second),
+			SyncRetryMaxBackoff:                durationjson.Duration(30 * time.Second),
+			TriggerMinInterval:                 durationjson.Duration(15 * time.Second),
+			MaxDomainStaleness:                 durationjson.Duration(24 * time.Hour),
+			EventCoalescingWindow:              durationjson.Duration(200 * time.Millisecond),
+			EventRecordingFile:                 "/tmp/route-emitter-events.ndjson",
 			ConsulDownModeNotificationInterval: durationjson.Duration(2 * time.Minute),
 			BBSAddress:                         "1.1.1.1:9091",
 			BBSCACertFile:                      "/tmp/bbs_ca_cert",
@@ -125,6 +165,10 @@ var _ = Describe("Config", func() {
 			BBSClientKeyFile:                   "/tmp/bbs_client_key",
 			BBSClientSessionCacheSize:          100,
 			BBSMaxIdleConnsPerHost:             10,
+			BBSSubscriptionRetryMinBackoff:     durationjson.Duration(time.Second),
+			BBSSubscriptionRetryMaxBackoff:     durationjson.Duration(30 * time.Second),
+			BBSSubscriptionRetryJitter:         0.2,
+			BBSSubscriptionFailureThreshold:    5,
 			NATSAddresses:                      "http://127.0.0.2:4222",
 			NATSUsername:                       "user",
 			NATSPassword:                       "password",
@@ -136,13 +180,27 @@ var _ = Describe("Config", func() {
 			LockTTL:                            durationjson.Duration(20 * time.Second),
 			ConsulSessionName:                  "myconsulsession",
 			RouteEmittingWorkers:               18,
-			TCPRouteTTL:                        durationjson.Duration(2 * time.Minute),
-			ReportInterval:                     durationjson.Duration(1 * time.Minute),
-			EnableTCPEmitter:                   true,
-			EnableInternalEmitter:              true,
-			RegisterDirectInstanceRoutes:       true,
-			ConsulEnabled:                      true,
-			LocketEnabled:                      true,
+			RouteEmitSlices:                    30,
+			ExternalServices: []config.ExternalServiceConfig{
+				{Name: "router", RouteType: "external"},
+				{Name: "edge-router", Subject: "edge-router.routes", RouteType: "external", TargetedStartEmit: true},
+			},
+			TCPRouteTTL:                           durationjson.Duration(2 * time.Minute),
+			ReportInterval:                        durationjson.Duration(1 * time.Minute),
+			UnregistrationInterval:                durationjson.Duration(config.DefaultUnregistrationInterval),
+			UnregistrationSendCount:               config.DefaultUnregistrationSendCount,
+			UnregistrationCacheFile:               "/var/vcap/data/route_emitter/unregistration_cache.json",
+			UnregistrationCacheCompactionInterval: durationjson.Duration(30 * time.Second),
+			UnregistrationCacheMaxSize:            50000,
+			UnregistrationCacheMaxAge:             durationjson.Duration(10 * time.Minute),
+			EnableTCPEmitter:                      true,
+			TCPRouteReconciliationInterval:        durationjson.Duration(5 * time.Minute),
+			TCPRouteReconciliationDryRun:          true,
+			EnableInternalEmitter:                 true,
+			RegisterDirectInstanceRoutes:          true,
+			ConsulEnabled:                         true,
+			LocketEnabled:                         true,
+			CertRotationCheckInterval:             durationjson.Duration(30 * time.Second),
 			RoutingAPI: config.RoutingAPIConfig{
 				URL:            "https://routing-api.cf.service.internal",
 				Port:           443,
@@ -150,6 +208,12 @@ var _ = Describe("Config", func() {
 				ClientCertFile: "/tmp/routing_api_client_cert_file",
 				ClientKeyFile:  "/tmp/routing_api_client_key_file",
 			},
+			Filters: config.FilterConfig{
+				IncludeIsolationSegments:   []string{"segment-a"},
+				ExcludeDomains:             []string{"internal"},
+				IncludeRouterGroups:        []string{"router-group-guid"},
+				ExcludeProcessGuidPrefixes: []string{"test-"},
+			},
 			DebugServerConfig: debugserver.DebugServerConfig{
 				DebugAddress: "127.0.0.1:9999",
 			},
@@ -187,6 +251,241 @@ var _ = Describe("Config", func() {
 		Expect(routeEmitterConfig).To(test_helpers.DeepEqual(expectedConfig))
 	})
 
+	Context("when fields that must be positive are set to zero", func() {
+		BeforeEach(func() {
+			configData = `{
+				"sync_interval": "0s",
+				"route_emitting_workers": 0,
+				"unregistration_interval": "0s",
+				"unregistration_send_count": 0,
+				"unregistration_cache_file": "/var/vcap/data/route_emitter/unregistration_cache.json",
+				"unregistration_cache_compaction_interval": "0s"
+			}`
+		})
+
+		It("keeps the zeros instead of the defaults", func() {
+			routeEmitterConfig, err := config.NewRouteEmitterConfig(configPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(routeEmitterConfig.SyncInterval).To(BeZero())
+			Expect(routeEmitterConfig.RouteEmittingWorkers).To(BeZero())
+			Expect(routeEmitterConfig.UnregistrationInterval).To(BeZero())
+			Expect(routeEmitterConfig.UnregistrationSendCount).To(BeZero())
+			Expect(routeEmitterConfig.UnregistrationCacheCompactionInterval).To(BeZero())
+		})
+
+		It("fails validation for each of them", func() {
+			routeEmitterConfig, err := config.NewRouteEmitterConfig(configPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = routeEmitterConfig.Validate()
+			Expect(err).To(BeAssignableToTypeOf(config.ValidationError{}))
+			var fields []string
+			for _, fieldErr := range err.(config.ValidationError) {
+				fields = append(fields, fieldErr.Field)
+			}
+			Expect(fields).To(ContainElement("sync_interval"))
+			Expect(fields).To(ContainElement("route_emitting_workers"))
+			Expect(fields).To(ContainElement("unregistration_interval"))
+			Expect(fields).To(ContainElement("unregistration_send_count"))
+			Expect(fields).To(ContainElement("unregistration_cache_compaction_interval"))
+		})
+	})
+
+	Describe("ExternalServiceConfigs", func() {
+		It("defaults the subject to the name and the route type to external", func() {
+			cfg := config.RouteEmitterConfig{
+				ExternalServices: []config.ExternalServiceConfig{
+					{Name: "edge-router"},
+					{Name: "edge-discovery", Subject: "edge-discovery.routes", RouteType: config.InternalRouteType},
+				},
+			}
+			Expect(cfg.ExternalServiceConfigs()).To(Equal([]config.ExternalServiceConfig{
+				{Name: "edge-router", Subject: "edge-router", RouteType: config.ExternalRouteType},
+				{Name: "edge-discovery", Subject: "edge-discovery.routes", RouteType: config.InternalRouteType},
+			}))
+		})
+
+		Context("when no external services are configured", func() {
+			It("defaults to the router", func() {
+				cfg := config.RouteEmitterConfig{}
+				Expect(cfg.ExternalServiceConfigs()).To(Equal([]config.ExternalServiceConfig{
+					{Name: "router", Subject: "router", RouteType: config.ExternalRouteType},
+				}))
+			})
+
+			It("adds service discovery if the internal emitter is enabled", func() {
+				cfg := config.RouteEmitterConfig{EnableInternalEmitter: true}
+				Expect(cfg.ExternalServiceConfigs()).To(Equal([]config.ExternalServiceConfig{
+					{Name: "router", Subject: "router", RouteType: config.ExternalRouteType},
+					{Name: "service-discovery", Subject: "service-discovery", RouteType: config.InternalRouteType},
+				}))
+			})
+		})
+	})
+
+	Describe("ChangedFields", func() {
+		It("returns the names of the fields that differ", func() {
+			oldConfig := config.RouteEmitterConfig{
+				SyncInterval:  durationjson.Duration(time.Minute),
+				NATSAddresses: "127.0.0.1:4222",
+				RoutingAPI:    config.RoutingAPIConfig{URL: "https://routing-api.cf.service.internal"},
+				LagerConfig:   lagerflags.LagerConfig{LogLevel: lagerflags.INFO},
+			}
+			newConfig := oldConfig
+			newConfig.SyncInterval = durationjson.Duration(time.Second)
+			newConfig.RoutingAPI.Port = 443
+			newConfig.LogLevel = lagerflags.DEBUG
+			newConfig.NATSAddresses = ""
+			newConfig.UnregistrationSendCount = 3
+
+			changed, err := config.ChangedFields(oldConfig, newConfig)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed).To(Equal([]string{
+				"log_level",
+				"nats_addresses",
+				"routing_api",
+				"sync_interval",
+				"unregistration_send_count",
+			}))
+		})
+
+		It("returns no fields for equal configs", func() {
+			cfg, err := config.NewRouteEmitterConfig(configPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			changed, err := config.ChangedFields(cfg, cfg)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed).To(BeEmpty())
+		})
+	})
+
+	Describe("Validate", func() {
+		var cfg config.RouteEmitterConfig
+
+		BeforeEach(func() {
+			cfg = config.RouteEmitterConfig{
+				BBSAddress:              "https://bbs.service.cf.internal:8889",
+				BBSCACertFile:           "/tmp/bbs_ca_cert",
+				BBSClientCertFile:       "/tmp/bbs_client_cert",
+				BBSClientKeyFile:        "/tmp/bbs_client_key",
+				NATSAddresses:           "127.0.0.1:4222",
+				SyncInterval:            durationjson.Duration(time.Minute),
+				RouteEmittingWorkers:    20,
+				UnregistrationInterval:  durationjson.Duration(5 * time.Second),
+				UnregistrationSendCount: 5,
+				ConsulEnabled:           true,
+				ConsulCluster:           "http://127.0.0.1:8500",
+			}
+		})
+
+		It("accepts a valid config", func() {
+			Expect(cfg.Validate()).To(Succeed())
+		})
+
+		It("reports every problem with the name of the field", func() {
+			cfg.BBSAddress = "1.1.1.1:9091"
+			cfg.BBSClientKeyFile = ""
+			cfg.NATSTLSEnabled = true
+			cfg.NATSCACertFile = "/tmp/nats_ca_cert"
+			cfg.SyncInterval = 0
+			cfg.SyncIntervalJitter = 1.5
+			cfg.UnregistrationSendCount = 0
+			cfg.RouteEmitSlices = 61
+			cfg.ShardCount = 3
+			cfg.ShardIndex = 3
+			cfg.ConsulCluster = ""
+			cfg.RoutingAPI.CACertFile = "/tmp/routing_api_ca_cert_file"
+			cfg.ExternalServices = []config.ExternalServiceConfig{
+				{Name: "router"},
+				{Name: "router", RouteType: "sideways"},
+				{Name: "service-discovery", RouteType: config.InternalRouteType},
+			}
+
+			err := cfg.Validate()
+			Expect(err).To(BeAssignableToTypeOf(config.ValidationError{}))
+
+			var fields []string
+			for _, fieldErr := range err.(config.ValidationError) {
+				fields = append(fields, fieldErr.Field)
+			}
+			Expect(fields).To(Equal([]string{
+				"bbs_address",
+				"bbs_client_key_file",
+				"nats_client_cert_file",
+				"nats_client_key_file",
+				"sync_interval",
+				"sync_interval_jitter",
+				"unregistration_send_count",
+				"route_emit_slices",
+				"shard_index",
+				"consul_cluster",
+				"routing_api",
+				"external_services[1].name",
+				"external_services[1].route_type",
+				"external_services[2].route_type",
+			}))
+			Expect(err.Error()).To(ContainSubstring("sync_interval_jitter: must be at least 0 and less than 1, got 1.5"))
+			Expect(err.Error()).To(ContainSubstring("route_emit_slices: must be between 0 and 60, got 61"))
+		})
+
+		It("rejects a sync interval jitter of 1", func() {
+			cfg.SyncIntervalJitter = 1
+
+			err := cfg.Validate()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("sync_interval_jitter: must be at least 0 and less than 1, got 1"))
+		})
+
+		Context("when the tcp emitter is enabled", func() {
+			BeforeEach(func() {
+				cfg.EnableTCPEmitter = true
+				cfg.RoutingAPI.AuthEnabled = true
+				cfg.TCPRouteTTL = durationjson.Duration(24 * time.Hour)
+			})
+
+			It("requires the routing api and oauth settings", func() {
+				err := cfg.Validate()
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(Equal("invalid config: " +
+					"routing_api.url: is required; " +
+					"routing_api.port: must be positive when enable_tcp_emitter is set, got 0; " +
+					"oauth.uaa_url: is required; " +
+					"oauth.client_name: is required; " +
+					"oauth.client_secret: is required; " +
+					"tcp_route_ttl: must be at most 18h12m15s, got 24h0m0s"))
+			})
+		})
+
+		Context("when the unregistration cache file is set", func() {
+			BeforeEach(func() {
+				cfg.UnregistrationCacheFile = "/var/vcap/data/route_emitter/unregistration_cache.json"
+			})
+
+			It("requires a positive compaction interval", func() {
+				err := cfg.Validate()
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(Equal("invalid config: " +
+					"unregistration_cache_compaction_interval: must be positive when unregistration_cache_file is set, got 0s"))
+
+				cfg.UnregistrationCacheCompactionInterval = durationjson.Duration(time.Minute)
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+
+		Context("when the emitter runs on a cell", func() {
+			BeforeEach(func() {
+				cfg.CellID = "cell-id"
+				cfg.ConsulCluster = ""
+				cfg.LocketEnabled = true
+			})
+
+			It("does not require consul or locket", func() {
+				Expect(cfg.Validate()).To(Succeed())
+			})
+		})
+	})
+
 	Context("when the file does not exist", func() {
 		It("returns an error", func() {
 			_, err := config.NewRouteEmitterConfig("foobar")
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxTCPRouteTTL is the largest TTL the routing API accepts, in seconds.
+const maxTCPRouteTTL = 65535 * time.Second
+
+// maxRouteEmitSlices bounds how often the routes are emitted, the scheduler
+// never emits more often than every 100ms either way.
+const maxRouteEmitSlices = 60
+
+// FieldError is a problem with a config field. Field is the JSON name of the
+// field, with nested fields separated by dots.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationError is every problem found in a config.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	problems := make([]string, 0, len(e))
+	for _, fieldError := range e {
+		problems = append(problems, fieldError.Error())
+	}
+	return fmt.Sprintf("invalid config: %s", strings.Join(problems, "; "))
+}
+
+// Validate checks the config for problems that would otherwise only surface
+// once the emitter uses the field. It returns a ValidationError with all of
+// them, or nil if there are none.
+func (c RouteEmitterConfig) Validate() error {
+	var errs ValidationError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	required := func(field, value string) {
+		if value == "" {
+			add(field, "is required")
+		}
+	}
+
+	required("bbs_address", c.BBSAddress)
+	if c.BBSAddress != "" {
+		if u, err := url.Parse(c.BBSAddress); err != nil || u.Scheme == "" || u.Host == "" {
+			add("bbs_address", "must be a URL, got %q", c.BBSAddress)
+		}
+	}
+	required("bbs_ca_cert_file", c.BBSCACertFile)
+	required("bbs_client_cert_file", c.BBSClientCertFile)
+	required("bbs_client_key_file", c.BBSClientKeyFile)
+	if c.BBSSubscriptionRetryJitter < 0 || c.BBSSubscriptionRetryJitter > 1 {
+		add("bbs_subscription_retry_jitter", "must be between 0 and 1, got %v", c.BBSSubscriptionRetryJitter)
+	}
+
+	required("nats_addresses", c.NATSAddresses)
+	if c.NATSTLSEnabled {
+		required("nats_ca_cert_file", c.NATSCACertFile)
+		required("nats_client_cert_file", c.NATSClientCertFile)
+		required("nats_client_key_file", c.NATSClientKeyFile)
+	}
+
+	if c.SyncInterval <= 0 {
+		add("sync_interval", "must be positive, got %s", time.Duration(c.SyncInterval))
+	}
+	// a jitter of 1 would allow syncing right after the previous sync
+	if c.SyncIntervalJitter < 0 || c.SyncIntervalJitter >= 1 {
+		add("sync_interval_jitter", "must be at least 0 and less than 1, got %v", c.SyncIntervalJitter)
+	}
+	if c.RouteEmittingWorkers <= 0 {
+		add("route_emitting_workers", "must be positive, got %d", c.RouteEmittingWorkers)
+	}
+	if c.UnregistrationInterval <= 0 {
+		add("unregistration_interval", "must be positive, got %s", time.Duration(c.UnregistrationInterval))
+	}
+	if c.UnregistrationSendCount <= 0 {
+		add("unregistration_send_count", "must be positive, got %d", c.UnregistrationSendCount)
+	}
+	if c.UnregistrationCacheFile != "" && c.UnregistrationCacheCompactionInterval <= 0 {
+		add("unregistration_cache_compaction_interval", "must be positive when unregistration_cache_file is set, got %s", time.Duration(c.UnregistrationCacheCompactionInterval))
+	}
+	if c.RouteEmitSlices < 0 || c.RouteEmitSlices > maxRouteEmitSlices {
+		add("route_emit_slices", "must be between 0 and %d, got %d", maxRouteEmitSlices, c.RouteEmitSlices)
+	}
+
+	if c.ShardCount < 0 {
+		add("shard_count", "must not be negative, got %d", c.ShardCount)
+	}
+	if c.ShardIndex < 0 || (c.ShardCount > 0 && c.ShardIndex >= c.ShardCount) {
+		add("shard_index", "must be between 0 and shard_count - 1, got %d", c.ShardIndex)
+	}
+
+	if c.ConsulEnabled && c.CellID == "" {
+		required("consul_cluster", c.ConsulCluster)
+	}
+	if c.LocketEnabled && c.CellID == "" {
+		required("locket_address", c.LocketAddress)
+	}
+
+	if c.EnableTCPEmitter {
+		required("routing_api.url", c.RoutingAPI.URL)
+		if c.RoutingAPI.Port <= 0 {
+			add("routing_api.port", "must be positive when enable_tcp_emitter is set, got %d", c.RoutingAPI.Port)
+		}
+		if c.RoutingAPI.AuthEnabled {
+			required("oauth.uaa_url", c.OAuth.UaaURL)
+			required("oauth.client_name", c.OAuth.ClientName)
+			required("oauth.client_secret", c.OAuth.ClientSecret)
+		}
+		if time.Duration(c.TCPRouteTTL) > maxTCPRouteTTL {
+			add("tcp_route_ttl", "must be at most %s, got %s", maxTCPRouteTTL, time.Duration(c.TCPRouteTTL))
+		}
+	}
+	tlsFiles := 0
+	for _, file := range []string{c.RoutingAPI.CACertFile, c.RoutingAPI.ClientCertFile, c.RoutingAPI.ClientKeyFile} {
+		if file != "" {
+			tlsFiles++
+		}
+	}
+	if tlsFiles > 0 && tlsFiles < 3 {
+		add("routing_api", "ca_cert_file, client_cert_file and client_key_file must be set together")
+	}
+
+	if c.CertRotationCheckInterval < 0 {
+		add("cert_rotation_check_interval", "must not be negative, got %s", time.Duration(c.CertRotationCheckInterval))
+	}
+
+	names := map[string]bool{}
+	for i, service := range c.ExternalServiceConfigs() {
+		field := fmt.Sprintf("external_services[%d]", i)
+		if service.Name == "" {
+			add(field+".name", "is required")
+		} else if names[service.Name] {
+			add(field+".name", "%q is used by another external service", service.Name)
+		}
+		names[service.Name] = true
+
+		switch service.RouteType {
+		case ExternalRouteType:
+		case InternalRouteType:
+			if !c.EnableInternalEmitter {
+				add(field+".route_type", "%q requires enable_internal_emitter", service.RouteType)
+			}
+		default:
+			add(field+".route_type", "must be %q or %q, got %q", ExternalRouteType, InternalRouteType, service.RouteType)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"time"
@@ -21,19 +22,25 @@ import (
 	"code.cloudfoundry.org/locket/lock"
 	locketmodels "code.cloudfoundry.org/locket/models"
 	route_emitter "code.cloudfoundry.org/route-emitter"
+	"code.cloudfoundry.org/route-emitter/certrotation"
 	"code.cloudfoundry.org/route-emitter/cmd/route-emitter/config"
 	"code.cloudfoundry.org/route-emitter/consuldownchecker"
 	"code.cloudfoundry.org/route-emitter/consuldownmodenotifier"
 	"code.cloudfoundry.org/route-emitter/diegonats"
 	"code.cloudfoundry.org/route-emitter/emitter"
+	"code.cloudfoundry.org/route-emitter/filter"
+	"code.cloudfoundry.org/route-emitter/readiness"
+	"code.cloudfoundry.org/route-emitter/reconciler"
+	"code.cloudfoundry.org/route-emitter/recording"
 	"code.cloudfoundry.org/route-emitter/routehandlers"
 	"code.cloudfoundry.org/route-emitter/routingtable"
 	"code.cloudfoundry.org/route-emitter/scheduler"
+	"code.cloudfoundry.org/route-emitter/shard"
 	"code.cloudfoundry.org/route-emitter/syncer"
+	"code.cloudfoundry.org/route-emitter/trigger"
 	"code.cloudfoundry.org/route-emitter/unregistration"
 	"code.cloudfoundry.org/route-emitter/watcher"
 	routing_api "code.cloudfoundry.org/routing-api"
-	"code.cloudfoundry.org/tlsconfig"
 	uaaclient "code.cloudfoundry.org/uaa-go-client"
 	uaaconfig "code.cloudfoundry.org/uaa-go-client/config"
 	"code.cloudfoundry.org/workpool"
@@ -50,34 +57,59 @@ var configFilePath = flag.String(
 	"Path to JSON configuration file",
 )
 
+var validateConfig = flag.Bool(
+	"validate-config",
+	false,
+	"Check the configuration file for problems and exit",
+)
+
 const (
 	routeEmitterLockKey = "route_emitter"
+
+	// targetedEmitsPending is how many starting routers can wait for the
+	// routes to be sent to them before the routes are broadcast instead
+	targetedEmitsPending = 16
+
+	bbsCertExpiryMetric        = "BBSClientCertTimeToExpiry"
+	natsCertExpiryMetric       = "NATSClientCertTimeToExpiry"
+	locketCertExpiryMetric     = "LocketClientCertTimeToExpiry"
+	routingAPICertExpiryMetric = "RoutingAPIClientCertTimeToExpiry"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		err := replay(os.Args[2:], os.Stdout, os.Stderr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	flag.Parse()
 
+	if *validateConfig {
+		os.Exit(checkConfig(*configFilePath, os.Stdout, os.Stderr))
+	}
+
 	cfg, err := config.NewRouteEmitterConfig(*configFilePath)
 	if err != nil {
 		logger, _ := lagerflags.NewFromConfig("route-emitter", lagerflags.DefaultLagerConfig())
 		logger.Fatal("failed-to-parse-config", err)
 	}
+	if err := cfg.Validate(); err != nil {
+		logger, _ := lagerflags.NewFromConfig("route-emitter", lagerflags.DefaultLagerConfig())
+		logger.Fatal("invalid-config", err)
+	}
 
 	logger, reconfigurableSink := lagerflags.NewFromConfig(cfg.ConsulSessionName, cfg.LagerConfig)
 
-	natsClient, err := initializeNATSClient(logger, cfg.NATSTLSEnabled, cfg.NATSCACertFile, cfg.NATSClientCertFile, cfg.NATSClientKeyFile)
-	if err != nil {
-		logger.Error("failed-to-initialize-nats-client", err)
-		os.Exit(1)
-	}
-
 	clock := clock.NewClock()
 
-	externalChan := make(chan struct{}, 1)
-	internalChan := make(chan struct{}, 1)
-	syncer := syncer.NewSyncer(clock, time.Duration(cfg.SyncInterval), logger)
-	externalScheduler := scheduler.NewRouteBroadcastScheduler(clock, natsClient, logger, "router", externalChan)
-	internalScheduler := scheduler.NewRouteBroadcastScheduler(clock, natsClient, logger, "service-discovery", internalChan)
+	// the trigger and reload signals are handled from the start, they would
+	// terminate an emitter that is still waiting for the lock otherwise
+	triggerSignals := trigger.NotifySignals()
+	reloadSignals := notifyReloadSignals()
 
 	metronClient, err := initializeMetron(logger, cfg)
 	if err != nil {
@@ -85,13 +117,85 @@ func main() {
 		os.Exit(1)
 	}
 
+	// the rotators keep the client certificates up to date with their files
+	var rotators grouper.Members
+	var natsRotator *certrotation.Rotator
+	if cfg.NATSTLSEnabled {
+		natsRotator, err = certrotation.NewRotator(logger, clock, metronClient, "nats", natsCertExpiryMetric, certrotation.Files{
+			CertFile: cfg.NATSClientCertFile,
+			KeyFile:  cfg.NATSClientKeyFile,
+			CAFile:   cfg.NATSCACertFile,
+		}, time.Duration(cfg.CertRotationCheckInterval))
+		if err != nil {
+			logger.Error("failed-to-initialize-nats-client", err)
+			os.Exit(1)
+		}
+		rotators = append(rotators, grouper.Member{"nats-cert-rotation", natsRotator})
+	}
+
+	natsClient, err := initializeNATSClient(logger, natsRotator, cfg.NATSAddresses)
+	if err != nil {
+		logger.Error("failed-to-initialize-nats-client", err)
+		os.Exit(1)
+	}
+
+	externalChan := make(chan struct{}, 1)
+	externalSliceChan := make(chan struct{}, 1)
+	internalChan := make(chan struct{}, 1)
+	externalToChan := make(chan string, targetedEmitsPending)
+	internalToChan := make(chan string, targetedEmitsPending)
+	syncer := syncer.NewJitteredSyncer(clock, time.Duration(cfg.SyncInterval), cfg.SyncIntervalJitter, logger)
+
+	schedulers, routersHandlers, subjects := initializeSchedulers(logger, clock, natsClient, metronClient, cfg, externalChan, externalSliceChan, internalChan, externalToChan, internalToChan)
+
 	natsClientRunner := diegonats.NewClientRunner(cfg.NATSAddresses, cfg.NATSUsername, cfg.NATSPassword, logger, natsClient)
+	if natsRotator != nil {
+		// reconnect so that the connection presents the new certificate
+		natsRotator.OnRotate(natsClientRunner.Refresh)
+	}
 
-	bbsClient := initializeBBSClient(logger, cfg)
+	bbsClient, err := newRotatingBBSClient(logger, func() (bbs.Client, error) { return initializeBBSClient(cfg) })
+	if err != nil {
+		logger.Fatal("Failed to configure secure BBS client", err)
+	}
+	bbsRotator := initializeRotator(logger, clock, metronClient, cfg, "bbs", bbsCertExpiryMetric, certrotation.Files{
+		CertFile: cfg.BBSClientCertFile,
+		KeyFile:  cfg.BBSClientKeyFile,
+		CAFile:   cfg.BBSCACertFile,
+	})
+	bbsRotator.OnRotate(bbsClient.rebuild)
+	rotators = append(rotators, grouper.Member{"bbs-cert-rotation", bbsRotator})
 
 	localMode := cfg.CellID != ""
-	table := routingtable.NewRoutingTable(cfg.RegisterDirectInstanceRoutes, metronClient)
-	natsEmitter := initializeNatsEmitter(logger, natsClient, cfg.RouteEmittingWorkers, metronClient, cfg.EnableInternalEmitter)
+
+	emitterShard, err := shard.New(cfg.ShardIndex, cfg.ShardCount)
+	if err != nil {
+		logger.Fatal("invalid-shard", err)
+	}
+	watcherFilters := watcher.Filters{}
+	if emitterShard.Sharded() {
+		if localMode {
+			logger.Fatal("invalid-shard", errors.New("sharding is only supported in global mode"))
+		}
+		if cfg.ConsulEnabled {
+			logger.Fatal("invalid-shard", errors.New("sharding requires locket"))
+		}
+		logger.Info("sharded", lager.Data{"shard-index": emitterShard.Index, "shard-count": emitterShard.Count})
+		watcherFilters = append(watcherFilters, emitterShard)
+	}
+
+	routeFilter := initializeRouteFilter(cfg.Filters)
+	if !routeFilter.Empty() {
+		logger.Info("filtering-routes", lager.Data{"filters": cfg.Filters})
+		watcherFilters = append(watcherFilters, routeFilter)
+	}
+
+	var watcherFilter watcher.Filter
+	if len(watcherFilters) > 0 {
+		watcherFilter = watcherFilters
+	}
+	table := routingtable.NewRoutingTableWithStaleDomainCutoff(logger, cfg.RegisterDirectInstanceRoutes, metronClient, clock, time.Duration(cfg.MaxDomainStaleness))
+	natsEmitter := initializeNatsEmitter(logger, natsClient, cfg.RouteEmittingWorkers, metronClient, subjects)
 
 	routeTTL := time.Duration(cfg.TCPRouteTTL)
 	if routeTTL.Seconds() > 65535 {
@@ -99,58 +203,198 @@ func main() {
 	}
 
 	var routingAPIEmitter emitter.RoutingAPIEmitter
+	var tcpRouteReconciler *reconciler.TCPRouteReconciler
 	if cfg.EnableTCPEmitter {
 		tcpLogger := logger.Session("tcp")
 		uaaClient := newUaaClient(tcpLogger, &cfg, clock)
 
-		routingAPIAddress := fmt.Sprintf("%s:%d", cfg.RoutingAPI.URL, cfg.RoutingAPI.Port)
-		logger.Debug("creating-routing-api-client", lager.Data{"api-location": routingAPIAddress})
-
-		var routingAPIClient routing_api.Client
+		var routingAPIRotator *certrotation.Rotator
 		if cfg.RoutingAPI.ClientCertFile != "" && cfg.RoutingAPI.ClientKeyFile != "" && cfg.RoutingAPI.CACertFile != "" {
-			tlsConfig, err := tlsconfig.Build(
-				tlsconfig.WithInternalServiceDefaults(),
-				tlsconfig.WithIdentityFromFile(cfg.RoutingAPI.ClientCertFile, cfg.RoutingAPI.ClientKeyFile),
-			).Client(
-				tlsconfig.WithAuthorityFromFile(cfg.RoutingAPI.CACertFile),
+			routingAPIRotator = initializeRotator(logger, clock, metronClient, cfg, "routing-api", routingAPICertExpiryMetric, certrotation.Files{
+				CertFile: cfg.RoutingAPI.ClientCertFile,
+				KeyFile:  cfg.RoutingAPI.ClientKeyFile,
+				CAFile:   cfg.RoutingAPI.CACertFile,
+			})
+			rotators = append(rotators, grouper.Member{"routing-api-cert-rotation", routingAPIRotator})
+		}
+
+		routingAPIClient := initializeRoutingAPIClient(logger, cfg, routingAPIRotator)
+		routingAPIEmitter = emitter.NewRoutingAPIEmitter(tcpLogger, routingAPIClient, uaaClient, int(routeTTL.Seconds()))
+
+		if cfg.TCPRouteReconciliationInterval > 0 && (emitterShard.Sharded() || routeFilter.SelectsLRPs()) {
+			// the routing api cannot tell which emitter a mapping belongs to
+			logger.Info("tcp-route-reconciliation-disabled", lager.Data{"reason": "other emitters publish to the same router groups"})
+		} else if cfg.TCPRouteReconciliationInterval > 0 && !localMode {
+			// the reconciler gets its own client since the token is set per call
+			tcpRouteReconciler = reconciler.NewTCPRouteReconciler(
+				tcpLogger,
+				clock,
+				table,
+				initializeRoutingAPIClient(logger, cfg, routingAPIRotator),
+				uaaClient,
+				metronClient,
+				routeFilter,
+				time.Duration(cfg.TCPRouteReconciliationInterval),
+				cfg.TCPRouteReconciliationDryRun,
+			)
+		}
+	}
+
+	unregistrationCacheLimits := unregistration.Limits{
+		MaxSize: cfg.UnregistrationCacheMaxSize,
+		MaxAge:  time.Duration(cfg.UnregistrationCacheMaxAge),
+	}
+	var unregistrationCache unregistration.Cache
+	var unregistrationFileCache *unregistration.FileCache
+	if cfg.UnregistrationCacheFile != "" {
+		unregistrationFileCache, err = unregistration.NewFileCache(
+			logger,
+			clock,
+			metronClient,
+			cfg.UnregistrationCacheFile,
+			time.Duration(cfg.UnregistrationCacheCompactionInterval),
+			unregistrationCacheLimits,
+		)
+		if err != nil {
+			logger.Fatal("failed-to-load-unregistration-cache", err, lager.Data{"path": cfg.UnregistrationCacheFile})
+		}
+		unregistrationCache = unregistrationFileCache
+	} else {
+		unregistrationCache = unregistration.NewBoundedCache(logger, clock, metronClient, unregistrationCacheLimits)
+	}
+
+	// internal routes are unregistered from service discovery, which is just as
+	// likely to miss a single message as the gorouter
+	var internalUnregistrationCache unregistration.Cache
+	var internalUnregistrationFileCache *unregistration.FileCache
+	if cfg.EnableInternalEmitter {
+		if cfg.UnregistrationCacheFile != "" {
+			internalCacheFile := cfg.UnregistrationCacheFile + ".internal"
+			internalUnregistrationFileCache, err = unregistration.NewFileCache(
+				logger.Session("internal"),
+				clock,
+				metronClient,
+				internalCacheFile,
+				time.Duration(cfg.UnregistrationCacheCompactionInterval),
+				unregistrationCacheLimits,
 			)
 			if err != nil {
-				logger.Fatal("failed-to-create-routing-api-tls-config", err)
+				logger.Fatal("failed-to-load-internal-unregistration-cache", err, lager.Data{"path": internalCacheFile})
 			}
-			routingAPIClient = routing_api.NewClientWithTLSConfig(routingAPIAddress, tlsConfig)
+			internalUnregistrationCache = internalUnregistrationFileCache
 		} else {
-			routingAPIClient = routing_api.NewClient(routingAPIAddress, false)
+			internalUnregistrationCache = unregistration.NewBoundedCache(logger.Session("internal"), clock, metronClient, unregistrationCacheLimits)
 		}
-
-		routingAPIEmitter = emitter.NewRoutingAPIEmitter(tcpLogger, routingAPIClient, uaaClient, int(routeTTL.Seconds()))
 	}
 
-	unregistrationCache := unregistration.NewCache(logger)
+	handler := routehandlers.NewHandler(table, natsEmitter, routingAPIEmitter, localMode, metronClient, unregistrationCache, internalUnregistrationCache, cfg.EventCoalescingWindow > 0, cfg.RouteEmitSlices)
 
-	handler := routehandlers.NewHandler(table, natsEmitter, routingAPIEmitter, localMode, metronClient, unregistrationCache)
+	var routeHandler watcher.RouteHandler = handler
+	if cfg.EventRecordingFile != "" {
+		recordingFile, err := os.OpenFile(cfg.EventRecordingFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			logger.Fatal("failed-to-open-event-recording-file", err, lager.Data{"path": cfg.EventRecordingFile})
+		}
+		logger.Info("recording-events", lager.Data{"path": cfg.EventRecordingFile})
+		routeHandler = recording.NewHandler(handler, recording.NewRecorder(clock, recordingFile))
+	}
 
-	watcher := watcher.NewWatcher(
+	routeWatcher := watcher.NewWatcher(
 		cfg.CellID,
 		bbsClient,
 		clock,
-		handler,
+		routeHandler,
 		syncer.SyncCh(),
-		externalScheduler.EmitCh(),
-		internalScheduler.EmitCh(),
+		externalChan,
+		externalSliceChan,
+		internalChan,
+		externalToChan,
+		internalToChan,
 		logger,
 		metronClient,
+		watcher.RetryPolicy{
+			MinBackoff:       time.Duration(cfg.BBSSubscriptionRetryMinBackoff),
+			MaxBackoff:       time.Duration(cfg.BBSSubscriptionRetryMaxBackoff),
+			Jitter:           cfg.BBSSubscriptionRetryJitter,
+			FailureThreshold: cfg.BBSSubscriptionFailureThreshold,
+		},
+		watcher.RetryPolicy{
+			MinBackoff: time.Duration(cfg.SyncRetryMinBackoff),
+			MaxBackoff: time.Duration(cfg.SyncRetryMaxBackoff),
+			Jitter:     cfg.SyncIntervalJitter,
+		},
+		time.Duration(cfg.EventCoalescingWindow),
+		watcherFilter,
 	)
 
 	healthHandler := func(resp http.ResponseWriter, req *http.Request) {
+		if !routeWatcher.Healthy() {
+			resp.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
 		resp.WriteHeader(http.StatusOK)
 	}
-	healthCheckServer := http_server.New(cfg.HealthCheckAddress, http.HandlerFunc(healthHandler))
-	unregistrationSender := unregistration.NewSender(logger, clock, unregistrationCache, natsEmitter, time.Duration(cfg.UnregistrationInterval), cfg.UnregistrationSendCount)
+	readinessChecker := readiness.NewChecker(logger, clock, natsClient, routeWatcher, !localMode)
+	healthCheckMux := http.NewServeMux()
+	healthCheckMux.Handle("/", http.HandlerFunc(healthHandler))
+	healthCheckMux.Handle("/ready", readinessChecker)
+	healthCheckServer := http_server.New(cfg.HealthCheckAddress, healthCheckMux)
+	unregistrationSender := unregistration.NewSender(logger, clock, unregistrationCache, natsEmitter, metronClient, time.Duration(cfg.UnregistrationInterval), cfg.UnregistrationSendCount)
 	members := grouper.Members{
 		{"nats-client", natsClientRunner},
+		{"readiness-nats-ping", readinessChecker.PingRunner(readiness.DefaultPingInterval)},
 		{"healthcheck", healthCheckServer},
 		{"unregistration", unregistrationSender},
 	}
+	members = append(members, rotators...)
+
+	if unregistrationFileCache != nil {
+		members = append(members, grouper.Member{"unregistration-cache-compactor", unregistrationFileCache})
+	}
+
+	var triggerInternalChan chan struct{}
+	if cfg.EnableInternalEmitter {
+		triggerInternalChan = internalChan
+	}
+	routeTrigger := trigger.NewTrigger(logger, clock, syncer.SyncCh(), externalChan, triggerInternalChan, time.Duration(cfg.TriggerMinInterval))
+	members = append(members, grouper.Member{"trigger-signals", routeTrigger.SignalRunner(triggerSignals)})
+
+	debugHandlers := map[string]http.Handler{
+		"/unregistrations":       unregistration.NewHandler(logger, unregistrationCache),
+		"/sync/dry-run":          watcher.NewDryRunHandler(logger, routeWatcher),
+		"/trigger/sync":          trigger.NewHandler(logger, routeTrigger, trigger.Sync),
+		"/trigger/emit-external": trigger.NewHandler(logger, routeTrigger, trigger.EmitExternal),
+	}
+	if routeTrigger.Enabled(trigger.EmitInternal) {
+		debugHandlers["/trigger/emit-internal"] = trigger.NewHandler(logger, routeTrigger, trigger.EmitInternal)
+	}
+	for path, handler := range routersHandlers {
+		debugHandlers[path] = handler
+	}
+
+	unregistrationSenders := []unregistration.Sender{unregistrationSender}
+	if internalUnregistrationCache != nil {
+		internalUnregistrationSender := unregistration.NewInternalSender(logger, clock, internalUnregistrationCache, natsEmitter, metronClient, time.Duration(cfg.UnregistrationInterval), cfg.UnregistrationSendCount)
+		members = append(members, grouper.Member{"internal-unregistration", internalUnregistrationSender})
+		debugHandlers["/internal-unregistrations"] = unregistration.NewHandler(logger, internalUnregistrationCache)
+		unregistrationSenders = append(unregistrationSenders, internalUnregistrationSender)
+	}
+
+	reloader := &configReloader{
+		logger:                logger,
+		configPath:            *configFilePath,
+		reloadSignals:         reloadSignals,
+		cfg:                   cfg,
+		sink:                  reconfigurableSink,
+		syncer:                syncer,
+		unregistrationSenders: unregistrationSenders,
+		natsEmitter:           natsEmitter,
+		natsClientRunner:      natsClientRunner,
+	}
+
+	if internalUnregistrationFileCache != nil {
+		members = append(members, grouper.Member{"internal-unregistration-cache-compactor", internalUnregistrationFileCache})
+	}
 
 	lockMembers := []grouper.Member{}
 	if cfg.CellID == "" {
@@ -181,7 +425,14 @@ func main() {
 		}
 
 		if cfg.LocketEnabled {
-			locketClient, err := locket.NewClient(logger, cfg.ClientLocketConfig)
+			locketRotator := initializeRotator(logger, clock, metronClient, cfg, "locket", locketCertExpiryMetric, certrotation.Files{
+				CertFile: cfg.LocketClientCertFile,
+				KeyFile:  cfg.LocketClientKeyFile,
+				CAFile:   cfg.LocketCACertFile,
+			})
+			members = append(members, grouper.Member{"locket-cert-rotation", locketRotator})
+
+			locketClient, err := initializeLocketClient(cfg.ClientLocketConfig, locketRotator)
 			if err != nil {
 				logger.Fatal("failed-to-create-locket-client", err)
 			}
@@ -191,7 +442,7 @@ func main() {
 			}
 
 			lockIdentifier := &locketmodels.Resource{
-				Key:      routeEmitterLockKey,
+				Key:      emitterShard.LockKey(routeEmitterLockKey),
 				Owner:    cfg.UUID,
 				TypeCode: locketmodels.LOCK,
 				Type:     locketmodels.LockType,
@@ -209,22 +460,27 @@ func main() {
 
 		members = append(members,
 			grouper.Member{"lock", lockRunner(logger, clock, lockMembers)},
+			grouper.Member{"lock-held", readinessChecker.LockRunner()},
 		)
 	}
 
 	members = append(members,
-		grouper.Member{"watcher", watcher},
-		grouper.Member{"external-scheduler", externalScheduler},
+		grouper.Member{"watcher", routeWatcher},
+	)
+	members = append(members, schedulers...)
+	members = append(members,
 		grouper.Member{"syncer", syncer},
+		grouper.Member{"trigger", routeTrigger},
+		grouper.Member{"config-reloader", reloader},
 	)
 
-	if cfg.EnableInternalEmitter {
-		members = append(members, grouper.Member{"internal-scheduler", internalScheduler})
+	if tcpRouteReconciler != nil {
+		members = append(members, grouper.Member{"tcp-route-reconciler", tcpRouteReconciler})
 	}
 
 	if cfg.DebugAddress != "" {
 		members = append(grouper.Members{
-			{"debug-server", debugserver.Runner(cfg.DebugAddress, reconfigurableSink)},
+			{"debug-server", debugServerRunner(cfg.DebugAddress, reconfigurableSink, debugHandlers)},
 		}, members...)
 	}
 
@@ -266,14 +522,16 @@ func main() {
 			{"nats-client", natsClientRunner},
 			{"consul-down-checker", consulDownChecker},
 			{"consul-down-mode-notifier", consulDownModeNotifier},
-			{"watcher", watcher},
-			{"external-scheduler", externalScheduler},
-			{"syncer", syncer},
-		}
-
-		if cfg.EnableInternalEmitter {
-			members = append(members, grouper.Member{"internal-scheduler", internalScheduler})
+			{"watcher", routeWatcher},
 		}
+		members = append(members, rotators...)
+		members = append(members, schedulers...)
+		members = append(members,
+			grouper.Member{"syncer", syncer},
+			grouper.Member{"trigger-signals", routeTrigger.SignalRunner(triggerSignals)},
+			grouper.Member{"trigger", routeTrigger},
+			grouper.Member{"config-reloader", reloader},
+		)
 
 		group = grouper.NewOrdered(os.Interrupt, members)
 
@@ -292,6 +550,43 @@ func main() {
 	logger.Info("exited")
 }
 
+// checkConfig parses and validates the config file, printing every problem on
+// its own line. It returns the exit code of --validate-config.
+func checkConfig(configPath string, stdout, stderr io.Writer) int {
+	cfg, err := config.NewRouteEmitterConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to parse config %s: %s\n", configPath, err)
+		return 1
+	}
+
+	err = cfg.Validate()
+	if validationErr, ok := err.(config.ValidationError); ok {
+		fmt.Fprintf(stderr, "config %s is invalid:\n", configPath)
+		for _, fieldErr := range validationErr {
+			fmt.Fprintf(stderr, "  %s\n", fieldErr)
+		}
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "config %s is invalid: %s\n", configPath, err)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "config %s is valid\n", configPath)
+	return 0
+}
+
+// debugServerRunner serves the standard debug endpoints together with the
+// emitter specific ones in handlers, keyed by path.
+func debugServerRunner(address string, sink *lager.ReconfigurableSink, handlers map[string]http.Handler) ifrit.Runner {
+	mux := http.NewServeMux()
+	mux.Handle("/", debugserver.Handler(sink))
+	for path, handler := range handlers {
+		mux.Handle(path, handler)
+	}
+	return http_server.New(address, mux)
+}
+
 func lockRunner(logger lager.Logger, clk clock.Clock, locks []grouper.Member) ifrit.Runner {
 	switch len(locks) {
 	case 0:
@@ -352,14 +647,65 @@ func initializeNatsEmitter(
 	natsClient diegonats.NATSClient,
 	routeEmittingWorkers int,
 	metronClient loggingclient.IngressClient,
-	emitInternalRoutes bool,
+	subjects emitter.Subjects,
 ) emitter.NATSEmitter {
 	workPool, err := workpool.NewWorkPool(routeEmittingWorkers)
 	if err != nil {
 		logger.Fatal("failed-to-construct-nats-emitter-workpool", err, lager.Data{"num-workers": routeEmittingWorkers}) // should never happen
 	}
 
-	return emitter.NewNATSEmitter(natsClient, workPool, logger, metronClient, emitInternalRoutes)
+	return emitter.NewNATSEmitterWithSubjects(natsClient, workPool, logger, metronClient, subjects)
+}
+
+// initializeSchedulers creates a route broadcast scheduler for each of the
+// external services. The schedulers of the external routes signal
+// externalChan, externalSliceChan for the periodic emits or externalToChan for
+// targeted emits, and the ones of the internal routes internalChan and
+// internalToChan. The returned subjects are the ones the routes of each type
+// are published to. The services were checked when the config was validated.
+func initializeSchedulers(
+	logger lager.Logger,
+	clock clock.Clock,
+	natsClient diegonats.NATSClient,
+	metronClient loggingclient.IngressClient,
+	cfg config.RouteEmitterConfig,
+	externalChan, externalSliceChan, internalChan chan struct{},
+	externalToChan, internalToChan chan string,
+) (grouper.Members, map[string]http.Handler, emitter.Subjects) {
+	var members grouper.Members
+	handlers := map[string]http.Handler{}
+	subjects := emitter.Subjects{}
+
+	for _, service := range cfg.ExternalServiceConfigs() {
+		data := lager.Data{"name": service.Name, "subject": service.Subject, "route-type": service.RouteType}
+
+		var emitToChan chan string
+		var routeScheduler *scheduler.RouteBroadcastScheduler
+		switch service.RouteType {
+		case config.ExternalRouteType:
+			if service.TargetedStartEmit {
+				emitToChan = externalToChan
+			}
+			routeScheduler = scheduler.NewTargetedRouteBroadcastScheduler(clock, natsClient, logger, metronClient, service.Name, externalChan, externalSliceChan, emitToChan, cfg.RouteEmitSlices)
+			subjects.External = append(subjects.External, service.Subject)
+		case config.InternalRouteType:
+			if service.TargetedStartEmit {
+				emitToChan = internalToChan
+			}
+			routeScheduler = scheduler.NewTargetedRouteBroadcastScheduler(clock, natsClient, logger, metronClient, service.Name, internalChan, nil, emitToChan, 1)
+			subjects.Internal = append(subjects.Internal, service.Subject)
+		}
+
+		logger.Info("broadcasting-routes", data)
+		members = append(members, grouper.Member{service.Name + "-scheduler", routeScheduler})
+		handlers["/routers/"+service.Name] = scheduler.NewRoutersHandler(logger, routeScheduler)
+	}
+
+	if cfg.EnableInternalEmitter && len(subjects.Internal) == 0 {
+		logger.Info("no-external-service-for-internal-routes")
+	}
+
+	return members, handlers, subjects
 }
 
 func initializeConsulClient(logger lager.Logger, consulCluster string) consuladapter.Client {
@@ -388,11 +734,17 @@ func initializeLockMaintainer(
 	return serviceClient.NewRouteEmitterLockRunner(logger, uuid.String(), lockRetryInterval, lockTTL, metronClient)
 }
 
-func initializeBBSClient(
-	logger lager.Logger,
-	cfg config.RouteEmitterConfig,
-) bbs.Client {
-	bbsClient, err := bbs.NewClientWithConfig(bbs.ClientConfig{
+func initializeRouteFilter(cfg config.FilterConfig) filter.Filter {
+	return filter.Filter{
+		Domains:           filter.Rule{Include: cfg.IncludeDomains, Exclude: cfg.ExcludeDomains},
+		ProcessGuidPrefix: filter.Rule{Include: cfg.IncludeProcessGuidPrefixes, Exclude: cfg.ExcludeProcessGuidPrefixes},
+		IsolationSegments: filter.Rule{Include: cfg.IncludeIsolationSegments, Exclude: cfg.ExcludeIsolationSegments},
+		RouterGroups:      filter.Rule{Include: cfg.IncludeRouterGroups, Exclude: cfg.ExcludeRouterGroups},
+	}
+}
+
+func initializeBBSClient(cfg config.RouteEmitterConfig) (bbs.Client, error) {
+	return bbs.NewClientWithConfig(bbs.ClientConfig{
 		URL:                    cfg.BBSAddress,
 		IsTLS:                  true,
 		CAFile:                 cfg.BBSCACertFile,
@@ -402,21 +754,29 @@ func initializeBBSClient(
 		MaxIdleConnsPerHost:    cfg.BBSMaxIdleConnsPerHost,
 		RequestTimeout:         time.Duration(cfg.CommunicationTimeout),
 	})
-	if err != nil {
-		logger.Fatal("Failed to configure secure BBS client", err)
+}
+
+func initializeRoutingAPIClient(logger lager.Logger, cfg config.RouteEmitterConfig, rotator *certrotation.Rotator) routing_api.Client {
+	routingAPIAddress := fmt.Sprintf("%s:%d", cfg.RoutingAPI.URL, cfg.RoutingAPI.Port)
+	logger.Debug("creating-routing-api-client", lager.Data{"api-location": routingAPIAddress})
+
+	if rotator != nil {
+		tlsConfig, err := rotator.ClientTLSConfig(urlHost(cfg.RoutingAPI.URL))
+		if err != nil {
+			logger.Fatal("failed-to-create-routing-api-tls-config", err)
+		}
+		return routing_api.NewClientWithTLSConfig(routingAPIAddress, tlsConfig)
 	}
-	return bbsClient
+
+	return routing_api.NewClient(routingAPIAddress, false)
 }
 
-func initializeNATSClient(logger lager.Logger, tlsEnabled bool, caFile, certFile, keyFile string) (diegonats.NATSClient, error) {
+// initializeNATSClient returns a client that uses TLS with the material of the
+// rotator, or plain connections if the rotator is nil.
+func initializeNATSClient(logger lager.Logger, rotator *certrotation.Rotator, addresses string) (diegonats.NATSClient, error) {
 	var natsClient diegonats.NATSClient
-	if tlsEnabled {
-		tlsConfig, err := tlsconfig.Build(
-			tlsconfig.WithInternalServiceDefaults(),
-			tlsconfig.WithIdentityFromFile(certFile, keyFile),
-		).Client(
-			tlsconfig.WithAuthorityFromFile(caFile),
-		)
+	if rotator != nil {
+		tlsConfig, err := rotator.ClientTLSConfig(addressHosts(addresses)...)
 		if err != nil {
 			return nil, err
 		}
@@ -28,6 +28,7 @@ import (
 	"os/exec"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"code.cloudfoundry.org/bbs/models"
@@ -1278,6 +1279,94 @@ var _ = Describe("Route Emitter", func() {
 			ginkgomon.Kill(emitter, emitterInterruptTimeout)
 		})
 
+		Context("when the config file changes and the emitter receives SIGHUP", func() {
+			reloadConfig := func(modify func(*config.RouteEmitterConfig)) {
+				configPath := runner.Command.Args[2]
+				cfg, err := config.NewRouteEmitterConfig(configPath)
+				Expect(err).NotTo(HaveOccurred())
+				modify(&cfg)
+
+				data, err := json.Marshal(cfg)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.WriteFile(configPath, data, 0600)).To(Succeed())
+				Expect(runner.Command.Process.Signal(syscall.SIGHUP)).To(Succeed())
+			}
+
+			It("applies the live changes and logs the ones that require a restart", func() {
+				reloadConfig(func(cfg *config.RouteEmitterConfig) {
+					cfg.SyncInterval = durationjson.Duration(time.Hour)
+					cfg.RouteEmittingWorkers = 5
+					cfg.CommunicationTimeout = durationjson.Duration(time.Minute)
+				})
+
+				Eventually(runner.Buffer()).Should(gbytes.Say("reload-config.applied.*route_emitting_workers.*sync_interval"))
+				Eventually(runner.Buffer()).Should(gbytes.Say("reload-config.restart-required.*communication_timeout"))
+				Consistently(emitter.Wait()).ShouldNot(Receive())
+			})
+
+			It("applies the log level", func() {
+				reloadConfig(func(cfg *config.RouteEmitterConfig) {
+					cfg.LogLevel = lagerflags.ERROR
+				})
+				Eventually(runner.Buffer()).Should(gbytes.Say("reload-config.applied.*log_level"))
+
+				reloadConfig(func(cfg *config.RouteEmitterConfig) {})
+				Consistently(runner.Buffer()).ShouldNot(gbytes.Say("reload-config.starting"))
+			})
+
+			It("keeps the running config when the new one is invalid", func() {
+				reloadConfig(func(cfg *config.RouteEmitterConfig) {
+					cfg.SyncInterval = durationjson.Duration(-time.Second)
+				})
+
+				Eventually(runner.Buffer()).Should(gbytes.Say("reload-config.invalid-config.*sync_interval"))
+				Consistently(emitter.Wait()).ShouldNot(Receive())
+			})
+		})
+
+		Context("when configured with an additional external service", func() {
+			var edgeRegisteredRoutes <-chan routingtable.RegistryMessage
+
+			BeforeEach(func() {
+				edgeRegisteredRoutes = listenForRoutes("edge-router.routes.register")
+
+				natsClient.Subscribe("edge-router.greet", func(msg *nats.Msg) {
+					defer GinkgoRecover()
+
+					greeting := routingtable.ExternalServiceGreetingMessage{
+						MinimumRegisterInterval: 1,
+						PruneThresholdInSeconds: 6,
+					}
+
+					response, err := json.Marshal(greeting)
+					Expect(err).NotTo(HaveOccurred())
+
+					err = natsClient.Publish(msg.Reply, response)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				cfgs = append(cfgs, func(cfg *config.RouteEmitterConfig) {
+					cfg.ExternalServices = []config.ExternalServiceConfig{
+						{Name: "router"},
+						{Name: "edge-router", Subject: "edge-router.routes"},
+					}
+				})
+			})
+
+			It("emits the routes to the subjects of both services", func() {
+				err := bbsClient.DesireLRP(logger, desiredLRP)
+				Expect(err).NotTo(HaveOccurred())
+				err = bbsClient.StartActualLRP(logger, &lrpKey, &instanceKey, &netInfo)
+				Expect(err).NotTo(HaveOccurred())
+
+				var msg routingtable.RegistryMessage
+				Eventually(registeredRoutes).Should(Receive(&msg))
+				Expect(msg.Host).To(Equal(netInfo.Address))
+				Eventually(edgeRegisteredRoutes).Should(Receive(&msg))
+				Expect(msg.Host).To(Equal(netInfo.Address))
+			})
+		})
+
 		Context("when configured to communicate with nats over TLS", func() {
 			var certDepot string
 
@@ -1807,6 +1896,18 @@ var _ = Describe("Route Emitter", func() {
 					Consistently(secondRunner.Buffer, 5*time.Second).ShouldNot(gbytes.Say("emitter2.started"))
 				})
 
+				It("survives SIGHUP", func() {
+					Expect(secondRunner.Command.Process.Signal(syscall.SIGHUP)).To(Succeed())
+					Consistently(secondEmitter.Wait()).ShouldNot(Receive())
+					Expect(secondRunner.Buffer()).NotTo(gbytes.Say("emitter2.reload-config"))
+				})
+
+				It("ignores the trigger signals", func() {
+					Expect(secondRunner.Command.Process.Signal(syscall.SIGUSR1)).To(Succeed())
+					Eventually(secondRunner.Buffer()).Should(gbytes.Say("emitter2.trigger.trigger-ignored-while-inactive"))
+					Consistently(secondEmitter.Wait()).ShouldNot(Receive())
+				})
+
 				Context("runs in local mode", func() {
 					BeforeEach(func() {
 						port, err := portAllocator.ClaimPorts(1)
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/lager/lagerflags"
+	"code.cloudfoundry.org/route-emitter/cmd/route-emitter/config"
+	"code.cloudfoundry.org/route-emitter/diegonats"
+	"code.cloudfoundry.org/route-emitter/emitter"
+	"code.cloudfoundry.org/route-emitter/syncer"
+	"code.cloudfoundry.org/route-emitter/unregistration"
+)
+
+// configReloader re-reads the config file on SIGHUP and applies the changes
+// that are safe to make while the emitter runs. Changes to any other field
+// are logged as requiring a restart.
+type configReloader struct {
+	logger     lager.Logger
+	configPath string
+
+	// reloadSignals is the channel of notifyReloadSignals
+	reloadSignals <-chan os.Signal
+
+	// cfg is the config in effect, it only takes the new values of the fields
+	// that were applied
+	cfg config.RouteEmitterConfig
+
+	sink                  *lager.ReconfigurableSink
+	syncer                *syncer.NatsSyncer
+	unregistrationSenders []unregistration.Sender
+	natsEmitter           emitter.NATSEmitter
+	natsClientRunner      diegonats.NATSClientRunner
+}
+
+// notifyReloadSignals returns the channel that SIGHUP is delivered on. It is
+// called when the emitter starts, SIGHUP would terminate an emitter that is
+// still waiting for the lock otherwise. The reloader only reads it once the
+// lock is held, a SIGHUP received before is applied then.
+func notifyReloadSignals() chan os.Signal {
+	reloadSignals := make(chan os.Signal, 1)
+	signal.Notify(reloadSignals, syscall.SIGHUP)
+	return reloadSignals
+}
+
+func (r *configReloader) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	close(ready)
+	for {
+		select {
+		case <-r.reloadSignals:
+			r.reload()
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+func (r *configReloader) reload() {
+	logger := r.logger.Session("reload-config", lager.Data{"path": r.configPath})
+	logger.Info("starting")
+	defer logger.Info("finished")
+
+	newCfg, err := config.NewRouteEmitterConfig(r.configPath)
+	if err != nil {
+		logger.Error("failed-to-parse-config", err)
+		return
+	}
+	if err := newCfg.Validate(); err != nil {
+		logger.Error("invalid-config", err)
+		return
+	}
+
+	changed, err := config.ChangedFields(r.cfg, newCfg)
+	if err != nil {
+		logger.Error("failed-to-compare-config", err)
+		return
+	}
+
+	applied := []string{}
+	restartRequired := []string{}
+	unregistrationChanged, natsChanged := false, false
+	for _, field := range changed {
+		switch field {
+		case "sync_interval":
+			r.syncer.SetSyncInterval(time.Duration(newCfg.SyncInterval))
+			r.cfg.SyncInterval = newCfg.SyncInterval
+			applied = append(applied, field)
+		case "unregistration_interval", "unregistration_send_count":
+			unregistrationChanged = true
+		case "route_emitting_workers":
+			err := r.natsEmitter.SetWorkers(newCfg.RouteEmittingWorkers)
+			if err != nil {
+				logger.Error("failed-to-set-route-emitting-workers", err, lager.Data{"num-workers": newCfg.RouteEmittingWorkers})
+				continue
+			}
+			r.cfg.RouteEmittingWorkers = newCfg.RouteEmittingWorkers
+			applied = append(applied, field)
+		case "log_level":
+			level, err := logLevel(newCfg.LogLevel)
+			if err != nil {
+				logger.Error("invalid-log-level", err)
+				continue
+			}
+			r.sink.SetMinLevel(level)
+			r.cfg.LogLevel = newCfg.LogLevel
+			applied = append(applied, field)
+		case "nats_addresses", "nats_username", "nats_password":
+			natsChanged = true
+		default:
+			restartRequired = append(restartRequired, field)
+		}
+	}
+
+	if unregistrationChanged {
+		for _, sender := range r.unregistrationSenders {
+			sender.Reconfigure(time.Duration(newCfg.UnregistrationInterval), newCfg.UnregistrationSendCount)
+		}
+		r.cfg.UnregistrationInterval = newCfg.UnregistrationInterval
+		r.cfg.UnregistrationSendCount = newCfg.UnregistrationSendCount
+		applied = append(applied, "unregistration_interval", "unregistration_send_count")
+	}
+
+	if natsChanged {
+		// the client keeps its connection if the new one fails, which the
+		// runner logs
+		r.natsClientRunner.Reconnect(newCfg.NATSAddresses, newCfg.NATSUsername, newCfg.NATSPassword)
+		r.cfg.NATSAddresses = newCfg.NATSAddresses
+		r.cfg.NATSUsername = newCfg.NATSUsername
+		r.cfg.NATSPassword = newCfg.NATSPassword
+		applied = append(applied, "nats_addresses", "nats_username", "nats_password")
+	}
+
+	if len(applied) > 0 {
+		logger.Info("applied", lager.Data{"fields": applied})
+	}
+	if len(restartRequired) > 0 {
+		logger.Info("restart-required", lager.Data{"fields": restartRequired})
+	}
+}
+
+func logLevel(level string) (lager.LogLevel, error) {
+	switch level {
+	case lagerflags.DEBUG:
+		return lager.DEBUG, nil
+	case lagerflags.INFO:
+		return lager.INFO, nil
+	case lagerflags.ERROR:
+		return lager.ERROR, nil
+	case lagerflags.FATAL:
+		return lager.FATAL, nil
+	}
+	return lager.INFO, fmt.Errorf("unknown log level %q", level)
+}
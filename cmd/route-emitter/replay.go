@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/route-emitter/recording"
+	"code.cloudfoundry.org/route-emitter/routehandlers"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+	"code.cloudfoundry.org/route-emitter/unregistration"
+	tcpmodels "code.cloudfoundry.org/routing-api/models"
+)
+
+// replay feeds a recording made with event_recording_file through a route
+// handler and prints the registrations and unregistrations it would emit as
+// newline-delimited JSON.
+func replay(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	recordingPath := flags.String("recording", "", "Path to the recorded event stream")
+	directInstanceRoutes := flags.Bool("register-direct-instance-routes", false, "Register direct instance routes, as with register_direct_instance_routes")
+	debug := flags.Bool("debug", false, "Write debug logs to stderr")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *recordingPath == "" {
+		return errors.New("-recording is required")
+	}
+
+	minLogLevel := lager.INFO
+	if *debug {
+		minLogLevel = lager.DEBUG
+	}
+	logger := lager.NewLogger("route-emitter")
+	logger.RegisterSink(lager.NewWriterSink(stderr, minLogLevel))
+
+	file, err := os.Open(*recordingPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// metrics are not sent anywhere with the default configuration
+	metronClient, err := loggingclient.NewIngressClient(loggingclient.Config{})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(stdout)
+	table := routingtable.NewRoutingTable(*directInstanceRoutes, metronClient)
+	handler := routehandlers.NewHandler(
+		table,
+		captureNATSEmitter{encoder: encoder},
+		captureRoutingAPIEmitter{encoder: encoder},
+		false,
+		metronClient,
+		unregistration.NewCache(logger),
+		unregistration.NewCache(logger),
+		false,
+		0,
+	)
+
+	return recording.Replay(logger, recording.NewReader(file), handler)
+}
+
+type capturedMessage struct {
+	Action       string                        `json:"action"`
+	Subject      string                        `json:"subject,omitempty"`
+	Message      *routingtable.RegistryMessage `json:"message,omitempty"`
+	RouteMapping *tcpmodels.TcpRouteMapping    `json:"route_mapping,omitempty"`
+}
+
+// captureNATSEmitter prints the messages instead of sending them.
+type captureNATSEmitter struct {
+	encoder *json.Encoder
+}
+
+func (e captureNATSEmitter) Emit(messagesToEmit routingtable.MessagesToEmit) error {
+	for _, batch := range []struct {
+		action   string
+		messages []routingtable.RegistryMessage
+	}{
+		{"register", messagesToEmit.RegistrationMessages},
+		{"unregister", messagesToEmit.UnregistrationMessages},
+		{"register-internal", messagesToEmit.InternalRegistrationMessages},
+		{"unregister-internal", messagesToEmit.InternalUnregistrationMessages},
+	} {
+		for i := range batch.messages {
+			err := e.encoder.Encode(capturedMessage{Action: batch.action, Message: &batch.messages[i]})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e captureNATSEmitter) EmitEach(messagesToEmit routingtable.MessagesToEmit) ([]routingtable.RegistryMessage, error) {
+	return nil, e.Emit(messagesToEmit)
+}
+
+func (e captureNATSEmitter) EmitTo(subject string, messages []routingtable.RegistryMessage) error {
+	for i := range messages {
+		err := e.encoder.Encode(capturedMessage{Action: "register", Subject: subject, Message: &messages[i]})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e captureNATSEmitter) SetWorkers(workers int) error {
+	return nil
+}
+
+// captureRoutingAPIEmitter prints the TCP route mappings instead of sending
+// them.
+type captureRoutingAPIEmitter struct {
+	encoder *json.Encoder
+}
+
+func (e captureRoutingAPIEmitter) Emit(routeMappings routingtable.TCPRouteMappings) error {
+	for _, batch := range []struct {
+		action   string
+		mappings []tcpmodels.TcpRouteMapping
+	}{
+		{"register-tcp", routeMappings.Registrations},
+		{"unregister-tcp", routeMappings.Unregistrations},
+	} {
+		for i := range batch.mappings {
+			err := e.encoder.Encode(capturedMessage{Action: batch.action, RouteMapping: &batch.mappings[i]})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/bbs"
+	"code.cloudfoundry.org/bbs/events"
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/locket"
+	locketmodels "code.cloudfoundry.org/locket/models"
+	"code.cloudfoundry.org/route-emitter/certrotation"
+	"code.cloudfoundry.org/route-emitter/cmd/route-emitter/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+)
+
+// locketDialTimeout matches the timeouts of locket.NewClient.
+const locketDialTimeout = 10 * time.Second
+
+// rotatingBBSClient replaces its BBS client whenever the client certificates
+// are rotated. The BBS client reads the files itself, so picking up new
+// material means building a new one. Event streams that are already open keep
+// the connection of the client they were opened with.
+type rotatingBBSClient struct {
+	logger lager.Logger
+	build  func() (bbs.Client, error)
+
+	lock   sync.RWMutex
+	client bbs.Client
+}
+
+func newRotatingBBSClient(logger lager.Logger, build func() (bbs.Client, error)) (*rotatingBBSClient, error) {
+	client, err := build()
+	if err != nil {
+		return nil, err
+	}
+	return &rotatingBBSClient{logger: logger, build: build, client: client}, nil
+}
+
+// rebuild replaces the client, the current one is kept if the new one cannot
+// be built.
+func (c *rotatingBBSClient) rebuild() {
+	client, err := c.build()
+	if err != nil {
+		c.logger.Error("failed-to-rebuild-bbs-client", err)
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.client = client
+}
+
+func (c *rotatingBBSClient) current() bbs.Client {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.client
+}
+
+func (c *rotatingBBSClient) ActualLRPs(logger lager.Logger, filter models.ActualLRPFilter) ([]*models.ActualLRP, error) {
+	return c.current().ActualLRPs(logger, filter)
+}
+
+func (c *rotatingBBSClient) DesiredLRPs(logger lager.Logger, filter models.DesiredLRPFilter) ([]*models.DesiredLRP, error) {
+	return c.current().DesiredLRPs(logger, filter)
+}
+
+func (c *rotatingBBSClient) Domains(logger lager.Logger) ([]string, error) {
+	return c.current().Domains(logger)
+}
+
+func (c *rotatingBBSClient) SubscribeToInstanceEventsByCellID(logger lager.Logger, cellID string) (events.EventSource, error) {
+	return c.current().SubscribeToInstanceEventsByCellID(logger, cellID)
+}
+
+// initializeLocketClient dials locket with the TLS config of the rotator
+// instead of the files that locket.NewClient reads once, so that new
+// connections present the current certificate through its
+// GetClientCertificate callback. The dial is bounded like the one of
+// locket.NewClient.
+func initializeLocketClient(cfg locket.ClientLocketConfig, rotator *certrotation.Rotator) (locketmodels.LocketClient, error) {
+	tlsConfig, err := rotator.ClientTLSConfig(addressHosts(cfg.LocketAddress)...)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), locketDialTimeout)
+	defer cancel()
+
+	dialer := &net.Dialer{Timeout: locketDialTimeout}
+	conn, err := grpc.DialContext(
+		ctx,
+		cfg.LocketAddress,
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp", addr)
+		}),
+		grpc.WithBlock(),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{Time: locketDialTimeout}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return locketmodels.NewLocketClient(conn), nil
+}
+
+// addressHosts returns the hosts of a comma separated list of host:port
+// addresses.
+func addressHosts(addresses string) []string {
+	hosts := []string{}
+	for _, address := range strings.Split(addresses, ",") {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// urlHost returns the host of a URL such as the routing api URL.
+func urlHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return rawURL
+	}
+	return u.Hostname()
+}
+
+func initializeRotator(
+	logger lager.Logger,
+	clock clock.Clock,
+	metronClient loggingclient.IngressClient,
+	cfg config.RouteEmitterConfig,
+	name, expiryMetric string,
+	files certrotation.Files,
+) *certrotation.Rotator {
+	rotator, err := certrotation.NewRotator(logger, clock, metronClient, name, expiryMetric, files, time.Duration(cfg.CertRotationCheckInterval))
+	if err != nil {
+		logger.Fatal("failed-to-load-client-certs", err, lager.Data{"client": name})
+	}
+	return rotator
+}
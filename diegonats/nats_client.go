@@ -2,12 +2,16 @@ package diegonats
 
 import (
 	"crypto/tls"
+	"sync"
 	"time"
 
 	"github.com/nats-io/nats.go"
 )
 
 type NATSClient interface {
+	// Connect connects to one of the urls. If the client is already connected,
+	// the subscriptions are moved to the new connection before the old one is
+	// closed, e.g. to pick up new credentials.
 	Connect(urls []string) (chan struct{}, error)
 	SetPingInterval(interval time.Duration)
 	Close()
@@ -23,21 +27,35 @@ type NATSClient interface {
 }
 
 type natsClient struct {
-	*nats.Conn
 	pingInterval time.Duration
 	tlsConfig    *tls.Config
+
+	lock sync.RWMutex
+	conn *nats.Conn
+	// subscriptions are keyed by the subscription that was handed out, which
+	// stays valid for Unsubscribe when the connection is replaced
+	subscriptions map[*nats.Subscription]*subscription
+}
+
+type subscription struct {
+	subject string
+	queue   string
+	handler nats.MsgHandler
+	current *nats.Subscription
 }
 
 func NewClient() NATSClient {
 	return &natsClient{
-		pingInterval: nats.DefaultPingInterval,
+		pingInterval:  nats.DefaultPingInterval,
+		subscriptions: map[*nats.Subscription]*subscription{},
 	}
 }
 
 func NewClientWithTLSConfig(tlsConfig *tls.Config) NATSClient {
 	return &natsClient{
-		pingInterval: nats.DefaultPingInterval,
-		tlsConfig:    tlsConfig,
+		pingInterval:  nats.DefaultPingInterval,
+		tlsConfig:     tlsConfig,
+		subscriptions: map[*nats.Subscription]*subscription{},
 	}
 }
 
@@ -63,21 +81,112 @@ func (nc *natsClient) Connect(urls []string) (chan struct{}, error) {
 		return nil, err
 	}
 
-	nc.Conn = natsConnection
+	nc.lock.Lock()
+	defer nc.lock.Unlock()
+
+	for _, sub := range nc.subscriptions {
+		current, err := natsConnection.QueueSubscribe(sub.subject, sub.queue, sub.handler)
+		if err != nil {
+			natsConnection.Close()
+			return nil, err
+		}
+		sub.current = current
+	}
+
+	oldConnection := nc.conn
+	nc.conn = natsConnection
+	if oldConnection != nil {
+		oldConnection.Close()
+	}
+
 	return closedChan, nil
 }
 
 func (nc *natsClient) Close() {
-	if nc.Conn != nil {
-		nc.Conn.Close()
+	nc.lock.Lock()
+	defer nc.lock.Unlock()
+
+	if nc.conn != nil {
+		nc.conn.Close()
 	}
+	nc.subscriptions = map[*nats.Subscription]*subscription{}
 }
 
-func (c *natsClient) Ping() bool {
-	err := c.FlushTimeout(500 * time.Millisecond)
+func (nc *natsClient) Ping() bool {
+	conn := nc.connection()
+	if conn == nil {
+		return false
+	}
+
+	err := conn.FlushTimeout(500 * time.Millisecond)
 	return err == nil
 }
 
 func (nc *natsClient) Unsubscribe(sub *nats.Subscription) error {
-	return sub.Unsubscribe()
+	nc.lock.Lock()
+	defer nc.lock.Unlock()
+
+	tracked, ok := nc.subscriptions[sub]
+	if !ok {
+		return sub.Unsubscribe()
+	}
+
+	delete(nc.subscriptions, sub)
+	return tracked.current.Unsubscribe()
+}
+
+func (nc *natsClient) Publish(subject string, data []byte) error {
+	conn := nc.connection()
+	if conn == nil {
+		return nats.ErrInvalidConnection
+	}
+	return conn.Publish(subject, data)
+}
+
+func (nc *natsClient) PublishRequest(subj, reply string, data []byte) error {
+	conn := nc.connection()
+	if conn == nil {
+		return nats.ErrInvalidConnection
+	}
+	return conn.PublishRequest(subj, reply, data)
+}
+
+func (nc *natsClient) Request(subj string, data []byte, timeout time.Duration) (*nats.Msg, error) {
+	conn := nc.connection()
+	if conn == nil {
+		return nil, nats.ErrInvalidConnection
+	}
+	return conn.Request(subj, data, timeout)
+}
+
+func (nc *natsClient) Subscribe(subject string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	return nc.QueueSubscribe(subject, "", handler)
+}
+
+func (nc *natsClient) QueueSubscribe(subject, queue string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	nc.lock.Lock()
+	defer nc.lock.Unlock()
+
+	if nc.conn == nil {
+		return nil, nats.ErrInvalidConnection
+	}
+
+	sub, err := nc.conn.QueueSubscribe(subject, queue, handler)
+	if err != nil {
+		return nil, err
+	}
+
+	nc.subscriptions[sub] = &subscription{
+		subject: subject,
+		queue:   queue,
+		handler: handler,
+		current: sub,
+	}
+	return sub, nil
+}
+
+func (nc *natsClient) connection() *nats.Conn {
+	nc.lock.RLock()
+	defer nc.lock.RUnlock()
+	return nc.conn
 }
@@ -5,40 +5,65 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"sync"
 
 	"code.cloudfoundry.org/lager"
 )
 
 type NATSClientRunner struct {
+	logger lager.Logger
+	client NATSClient
+
+	// settings are shared by the copies of the runner so that Reconnect works
+	// on the running one
+	settings *runnerSettings
+}
+
+type runnerSettings struct {
+	lock      sync.Mutex
 	addresses string
 	username  string
 	password  string
-	logger    lager.Logger
-	client    NATSClient
+	reconnect chan struct{}
 }
 
 func NewClientRunner(addresses, username, password string, logger lager.Logger, client NATSClient) NATSClientRunner {
 	return NATSClientRunner{
-		addresses: addresses,
-		username:  username,
-		password:  password,
-		logger:    logger.Session("nats-runner"),
-		client:    client,
+		logger: logger.Session("nats-runner"),
+		client: client,
+		settings: &runnerSettings{
+			addresses: addresses,
+			username:  username,
+			password:  password,
+			reconnect: make(chan struct{}, 1),
+		},
 	}
 }
 
-func (runner NATSClientRunner) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
-	natsMembers := []string{}
-	for _, addr := range strings.Split(runner.addresses, ",") {
-		uri := url.URL{
-			Scheme: "nats",
-			User:   url.UserPassword(runner.username, runner.password),
-			Host:   addr,
-		}
-		natsMembers = append(natsMembers, uri.String())
+// Reconnect makes the running client connect to the addresses with the given
+// credentials. The client keeps the old connection if the new one fails.
+func (runner NATSClientRunner) Reconnect(addresses, username, password string) {
+	runner.settings.lock.Lock()
+	runner.settings.addresses = addresses
+	runner.settings.username = username
+	runner.settings.password = password
+	runner.settings.lock.Unlock()
+
+	runner.Refresh()
+}
+
+// Refresh makes the running client connect again with the current settings,
+// e.g. to present a rotated client certificate. The client keeps the old
+// connection if the new one fails.
+func (runner NATSClientRunner) Refresh() {
+	select {
+	case runner.settings.reconnect <- struct{}{}:
+	default:
 	}
+}
 
-	unexpectedConnClosed, err := runner.client.Connect(natsMembers)
+func (runner NATSClientRunner) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	unexpectedConnClosed, err := runner.client.Connect(runner.natsMembers())
 	if err != nil {
 		runner.logger.Error("connecting-to-nats-failed", err)
 		return err
@@ -47,13 +72,39 @@ func (runner NATSClientRunner) Run(signals <-chan os.Signal, ready chan<- struct
 	runner.logger.Info("connecting-to-nats-succeeeded")
 	close(ready)
 
-	select {
-	case <-signals:
-		runner.client.Close()
-		runner.logger.Info("shutting-down")
-		return nil
-	case <-unexpectedConnClosed:
-		runner.logger.Error("unexpected-nats-close", nil)
-		return errors.New("nats closed unexpectedly")
+	for {
+		select {
+		case <-signals:
+			runner.client.Close()
+			runner.logger.Info("shutting-down")
+			return nil
+		case <-runner.settings.reconnect:
+			connClosed, err := runner.client.Connect(runner.natsMembers())
+			if err != nil {
+				runner.logger.Error("reconnecting-to-nats-failed", err)
+				continue
+			}
+			unexpectedConnClosed = connClosed
+			runner.logger.Info("reconnecting-to-nats-succeeded")
+		case <-unexpectedConnClosed:
+			runner.logger.Error("unexpected-nats-close", nil)
+			return errors.New("nats closed unexpectedly")
+		}
+	}
+}
+
+func (runner NATSClientRunner) natsMembers() []string {
+	runner.settings.lock.Lock()
+	defer runner.settings.lock.Unlock()
+
+	natsMembers := []string{}
+	for _, addr := range strings.Split(runner.settings.addresses, ",") {
+		uri := url.URL{
+			Scheme: "nats",
+			User:   url.UserPassword(runner.settings.username, runner.settings.password),
+			Host:   addr,
+		}
+		natsMembers = append(natsMembers, uri.String())
 	}
+	return natsMembers
 }
@@ -9,6 +9,7 @@ import (
 	. "code.cloudfoundry.org/route-emitter/diegonats"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 	"github.com/tedsuo/ifrit"
 )
 
@@ -16,11 +17,13 @@ var _ = Describe("Starting the NatsClientRunner process", func() {
 	var natsClient NATSClient
 	var natsClientRunner ifrit.Runner
 	var natsClientProcess ifrit.Process
+	var logger *lagertest.TestLogger
 
 	BeforeEach(func() {
 		natsAddress := fmt.Sprintf("127.0.0.1:%d", natsPort)
 		natsClient = NewClient()
-		natsClientRunner = NewClientRunner(natsAddress, "nats", "nats", lagertest.NewTestLogger("test"), natsClient)
+		logger = lagertest.NewTestLogger("test")
+		natsClientRunner = NewClientRunner(natsAddress, "nats", "nats", logger, natsClient)
 	})
 
 	AfterEach(func() {
@@ -58,6 +61,37 @@ var _ = Describe("Starting the NatsClientRunner process", func() {
 			Eventually(errorChan).Should(Receive(Equal(errors.New("nats closed unexpectedly"))))
 		})
 
+		Context("when asked to reconnect", func() {
+			It("connects again without exiting", func() {
+				natsAddress := fmt.Sprintf("127.0.0.1:%d", natsPort)
+				natsClientRunner.(NATSClientRunner).Reconnect(natsAddress, "nats", "nats")
+
+				Eventually(logger).Should(gbytes.Say("reconnecting-to-nats-succeeded"))
+				Consistently(natsClientProcess.Wait()).ShouldNot(Receive())
+				Expect(natsClient.Ping()).To(BeTrue())
+			})
+
+			Context("when the new address is unreachable", func() {
+				It("keeps the old connection", func() {
+					natsClientRunner.(NATSClientRunner).Reconnect("127.0.0.1:4223", "nats", "nats")
+
+					Eventually(logger).Should(gbytes.Say("reconnecting-to-nats-failed"))
+					Consistently(natsClientProcess.Wait()).ShouldNot(Receive())
+					Expect(natsClient.Ping()).To(BeTrue())
+				})
+			})
+		})
+
+		Context("when asked to refresh", func() {
+			It("connects again with the same settings", func() {
+				natsClientRunner.(NATSClientRunner).Refresh()
+
+				Eventually(logger).Should(gbytes.Say("reconnecting-to-nats-succeeded"))
+				Consistently(natsClientProcess.Wait()).ShouldNot(Receive())
+				Expect(natsClient.Ping()).To(BeTrue())
+			})
+		})
+
 		It("reconnects when nats server goes down and comes back up", func() {
 			stopNATS()
 			Eventually(natsClient.Ping).Should(BeFalse())
@@ -20,6 +20,42 @@ type FakeNATSEmitter struct {
 	emitReturnsOnCall map[int]struct {
 		result1 error
 	}
+	EmitEachStub        func(routingtable.MessagesToEmit) ([]routingtable.RegistryMessage, error)
+	emitEachMutex       sync.RWMutex
+	emitEachArgsForCall []struct {
+		arg1 routingtable.MessagesToEmit
+	}
+	emitEachReturns struct {
+		result1 []routingtable.RegistryMessage
+		result2 error
+	}
+	emitEachReturnsOnCall map[int]struct {
+		result1 []routingtable.RegistryMessage
+		result2 error
+	}
+	EmitToStub        func(string, []routingtable.RegistryMessage) error
+	emitToMutex       sync.RWMutex
+	emitToArgsForCall []struct {
+		arg1 string
+		arg2 []routingtable.RegistryMessage
+	}
+	emitToReturns struct {
+		result1 error
+	}
+	emitToReturnsOnCall map[int]struct {
+		result1 error
+	}
+	SetWorkersStub        func(int) error
+	setWorkersMutex       sync.RWMutex
+	setWorkersArgsForCall []struct {
+		arg1 int
+	}
+	setWorkersReturns struct {
+		result1 error
+	}
+	setWorkersReturnsOnCall map[int]struct {
+		result1 error
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -84,11 +120,206 @@ func (fake *FakeNATSEmitter) EmitReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeNATSEmitter) EmitEach(arg1 routingtable.MessagesToEmit) ([]routingtable.RegistryMessage, error) {
+	fake.emitEachMutex.Lock()
+	ret, specificReturn := fake.emitEachReturnsOnCall[len(fake.emitEachArgsForCall)]
+	fake.emitEachArgsForCall = append(fake.emitEachArgsForCall, struct {
+		arg1 routingtable.MessagesToEmit
+	}{arg1})
+	fake.recordInvocation("EmitEach", []interface{}{arg1})
+	fake.emitEachMutex.Unlock()
+	if fake.EmitEachStub != nil {
+		return fake.EmitEachStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.emitEachReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeNATSEmitter) EmitEachCallCount() int {
+	fake.emitEachMutex.RLock()
+	defer fake.emitEachMutex.RUnlock()
+	return len(fake.emitEachArgsForCall)
+}
+
+func (fake *FakeNATSEmitter) EmitEachCalls(stub func(routingtable.MessagesToEmit) ([]routingtable.RegistryMessage, error)) {
+	fake.emitEachMutex.Lock()
+	defer fake.emitEachMutex.Unlock()
+	fake.EmitEachStub = stub
+}
+
+func (fake *FakeNATSEmitter) EmitEachArgsForCall(i int) routingtable.MessagesToEmit {
+	fake.emitEachMutex.RLock()
+	defer fake.emitEachMutex.RUnlock()
+	argsForCall := fake.emitEachArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeNATSEmitter) EmitEachReturns(result1 []routingtable.RegistryMessage, result2 error) {
+	fake.emitEachMutex.Lock()
+	defer fake.emitEachMutex.Unlock()
+	fake.EmitEachStub = nil
+	fake.emitEachReturns = struct {
+		result1 []routingtable.RegistryMessage
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeNATSEmitter) EmitEachReturnsOnCall(i int, result1 []routingtable.RegistryMessage, result2 error) {
+	fake.emitEachMutex.Lock()
+	defer fake.emitEachMutex.Unlock()
+	fake.EmitEachStub = nil
+	if fake.emitEachReturnsOnCall == nil {
+		fake.emitEachReturnsOnCall = make(map[int]struct {
+			result1 []routingtable.RegistryMessage
+			result2 error
+		})
+	}
+	fake.emitEachReturnsOnCall[i] = struct {
+		result1 []routingtable.RegistryMessage
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeNATSEmitter) EmitTo(arg1 string, arg2 []routingtable.RegistryMessage) error {
+	var arg2Copy []routingtable.RegistryMessage
+	if arg2 != nil {
+		arg2Copy = make([]routingtable.RegistryMessage, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	fake.emitToMutex.Lock()
+	ret, specificReturn := fake.emitToReturnsOnCall[len(fake.emitToArgsForCall)]
+	fake.emitToArgsForCall = append(fake.emitToArgsForCall, struct {
+		arg1 string
+		arg2 []routingtable.RegistryMessage
+	}{arg1, arg2Copy})
+	fake.recordInvocation("EmitTo", []interface{}{arg1, arg2Copy})
+	fake.emitToMutex.Unlock()
+	if fake.EmitToStub != nil {
+		return fake.EmitToStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.emitToReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeNATSEmitter) EmitToCallCount() int {
+	fake.emitToMutex.RLock()
+	defer fake.emitToMutex.RUnlock()
+	return len(fake.emitToArgsForCall)
+}
+
+func (fake *FakeNATSEmitter) EmitToCalls(stub func(string, []routingtable.RegistryMessage) error) {
+	fake.emitToMutex.Lock()
+	defer fake.emitToMutex.Unlock()
+	fake.EmitToStub = stub
+}
+
+func (fake *FakeNATSEmitter) EmitToArgsForCall(i int) (string, []routingtable.RegistryMessage) {
+	fake.emitToMutex.RLock()
+	defer fake.emitToMutex.RUnlock()
+	argsForCall := fake.emitToArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeNATSEmitter) EmitToReturns(result1 error) {
+	fake.emitToMutex.Lock()
+	defer fake.emitToMutex.Unlock()
+	fake.EmitToStub = nil
+	fake.emitToReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeNATSEmitter) EmitToReturnsOnCall(i int, result1 error) {
+	fake.emitToMutex.Lock()
+	defer fake.emitToMutex.Unlock()
+	fake.EmitToStub = nil
+	if fake.emitToReturnsOnCall == nil {
+		fake.emitToReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.emitToReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeNATSEmitter) SetWorkers(arg1 int) error {
+	fake.setWorkersMutex.Lock()
+	ret, specificReturn := fake.setWorkersReturnsOnCall[len(fake.setWorkersArgsForCall)]
+	fake.setWorkersArgsForCall = append(fake.setWorkersArgsForCall, struct {
+		arg1 int
+	}{arg1})
+	fake.recordInvocation("SetWorkers", []interface{}{arg1})
+	fake.setWorkersMutex.Unlock()
+	if fake.SetWorkersStub != nil {
+		return fake.SetWorkersStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.setWorkersReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeNATSEmitter) SetWorkersCallCount() int {
+	fake.setWorkersMutex.RLock()
+	defer fake.setWorkersMutex.RUnlock()
+	return len(fake.setWorkersArgsForCall)
+}
+
+func (fake *FakeNATSEmitter) SetWorkersCalls(stub func(int) error) {
+	fake.setWorkersMutex.Lock()
+	defer fake.setWorkersMutex.Unlock()
+	fake.SetWorkersStub = stub
+}
+
+func (fake *FakeNATSEmitter) SetWorkersArgsForCall(i int) int {
+	fake.setWorkersMutex.RLock()
+	defer fake.setWorkersMutex.RUnlock()
+	argsForCall := fake.setWorkersArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeNATSEmitter) SetWorkersReturns(result1 error) {
+	fake.setWorkersMutex.Lock()
+	defer fake.setWorkersMutex.Unlock()
+	fake.SetWorkersStub = nil
+	fake.setWorkersReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeNATSEmitter) SetWorkersReturnsOnCall(i int, result1 error) {
+	fake.setWorkersMutex.Lock()
+	defer fake.setWorkersMutex.Unlock()
+	fake.SetWorkersStub = nil
+	if fake.setWorkersReturnsOnCall == nil {
+		fake.setWorkersReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.setWorkersReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeNATSEmitter) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
 	fake.emitMutex.RLock()
 	defer fake.emitMutex.RUnlock()
+	fake.emitEachMutex.RLock()
+	defer fake.emitEachMutex.RUnlock()
+	fake.emitToMutex.RLock()
+	defer fake.emitToMutex.RUnlock()
+	fake.setWorkersMutex.RLock()
+	defer fake.setWorkersMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
@@ -14,68 +14,92 @@ import (
 const (
 	httpRouteNATSMessagesEmittedCounter     = "HTTPRouteNATSMessagesEmitted"
 	internalRouteNATSMessagesEmittedCounter = "InternalRouteNATSMessagesEmitted"
+	targetedRouteNATSMessagesEmittedCounter = "TargetedRouteNATSMessagesEmitted"
 )
 
 //go:generate counterfeiter -o fakes/fake_nats_emitter.go . NATSEmitter
 type NATSEmitter interface {
 	Emit(messagesToEmit routingtable.MessagesToEmit) error
+	// EmitEach publishes the messages like Emit, and returns the ones that
+	// could not be published along with the first error, so that the others
+	// can be counted as sent. A message that failed on several subjects is
+	// returned once for each of them.
+	EmitEach(messagesToEmit routingtable.MessagesToEmit) ([]routingtable.RegistryMessage, error)
+	// EmitTo publishes the registration messages to the given subject only,
+	// e.g. the inbox of a router that just started
+	EmitTo(subject string, messages []routingtable.RegistryMessage) error
+	// SetWorkers changes how many messages are published in parallel
+	SetWorkers(workers int) error
+}
+
+// Subjects are the NATS subjects the routes are published to, messages are
+// published to <subject>.register and <subject>.unregister for each of them.
+// Internal routes are only emitted if there is an internal subject.
+type Subjects struct {
+	External []string
+	Internal []string
 }
 
 type natsEmitter struct {
 	natsClient         diegonats.NATSClient
-	workPool           *workpool.WorkPool
 	logger             lager.Logger
 	metronClient       loggingclient.IngressClient
+	subjects           Subjects
 	emitInternalRoutes bool
+
+	// the work pool is read locked while messages are emitted so that it is
+	// not replaced under them
+	workPoolLock sync.RWMutex
+	workPool     *workpool.WorkPool
 }
 
 func NewNATSEmitter(natsClient diegonats.NATSClient, workPool *workpool.WorkPool, logger lager.Logger, metronClient loggingclient.IngressClient, emitInternalRoutes bool) NATSEmitter {
+	subjects := Subjects{External: []string{"router"}}
+	if emitInternalRoutes {
+		subjects.Internal = []string{"service-discovery"}
+	}
+	return NewNATSEmitterWithSubjects(natsClient, workPool, logger, metronClient, subjects)
+}
+
+func NewNATSEmitterWithSubjects(natsClient diegonats.NATSClient, workPool *workpool.WorkPool, logger lager.Logger, metronClient loggingclient.IngressClient, subjects Subjects) NATSEmitter {
 	return &natsEmitter{
 		natsClient:         natsClient,
 		workPool:           workPool,
 		logger:             logger.Session("nats-emitter"),
 		metronClient:       metronClient,
-		emitInternalRoutes: emitInternalRoutes,
+		subjects:           subjects,
+		emitInternalRoutes: len(subjects.Internal) > 0,
 	}
 }
 
 func (n *natsEmitter) Emit(messagesToEmit routingtable.MessagesToEmit) error {
-	errors := make(chan error, 1)
-	var wg sync.WaitGroup
-	wg.Add(len(messagesToEmit.RegistrationMessages))
-	for _, message := range messagesToEmit.RegistrationMessages {
-		n.emit("router.register", message, &wg, errors)
-	}
+	_, err := n.EmitEach(messagesToEmit)
+	return err
+}
 
-	wg.Add(len(messagesToEmit.UnregistrationMessages))
-	for _, message := range messagesToEmit.UnregistrationMessages {
-		n.emit("router.unregister", message, &wg, errors)
-	}
+func (n *natsEmitter) EmitEach(messagesToEmit routingtable.MessagesToEmit) ([]routingtable.RegistryMessage, error) {
+	n.workPoolLock.RLock()
+	defer n.workPoolLock.RUnlock()
+
+	failures := &publishFailures{}
+	var wg sync.WaitGroup
+	n.emitAll(n.subjects.External, ".register", messagesToEmit.RegistrationMessages, &wg, failures)
+	n.emitAll(n.subjects.External, ".unregister", messagesToEmit.UnregistrationMessages, &wg, failures)
 
+	// every message is published once per subject, and counted as often
 	var numberOfInternalMessages uint64
-	numberOfMessages := uint64(len(messagesToEmit.RegistrationMessages) + len(messagesToEmit.UnregistrationMessages))
-	numberOfHTTPMessages := uint64(len(messagesToEmit.RegistrationMessages) + len(messagesToEmit.UnregistrationMessages))
+	numberOfHTTPMessages := uint64(len(n.subjects.External) * (len(messagesToEmit.RegistrationMessages) + len(messagesToEmit.UnregistrationMessages)))
 	if n.emitInternalRoutes {
-		wg.Add(len(messagesToEmit.InternalRegistrationMessages))
-		for _, message := range messagesToEmit.InternalRegistrationMessages {
-			n.emit("service-discovery.register", message, &wg, errors)
-		}
-
-		wg.Add(len(messagesToEmit.InternalUnregistrationMessages))
-		for _, message := range messagesToEmit.InternalUnregistrationMessages {
-			n.emit("service-discovery.unregister", message, &wg, errors)
-		}
+		n.emitAll(n.subjects.Internal, ".register", messagesToEmit.InternalRegistrationMessages, &wg, failures)
+		n.emitAll(n.subjects.Internal, ".unregister", messagesToEmit.InternalUnregistrationMessages, &wg, failures)
 
-		numberOfInternalMessages = uint64(len(messagesToEmit.InternalRegistrationMessages) + len(messagesToEmit.InternalUnregistrationMessages))
-		numberOfMessages += numberOfInternalMessages
+		numberOfInternalMessages = uint64(len(n.subjects.Internal) * (len(messagesToEmit.InternalRegistrationMessages) + len(messagesToEmit.InternalUnregistrationMessages)))
 	}
 
 	wg.Wait()
 
-	select {
-	case finalError := <-errors:
-		return finalError
-	default:
+	if failures.err != nil {
+		return failures.messages, failures.err
 	}
 
 	err := n.metronClient.IncrementCounterWithDelta(httpRouteNATSMessagesEmittedCounter, numberOfHTTPMessages)
@@ -90,18 +114,84 @@ func (n *natsEmitter) Emit(messagesToEmit routingtable.MessagesToEmit) error {
 		}
 	}
 
+	return nil, nil
+}
+
+func (n *natsEmitter) EmitTo(subject string, messages []routingtable.RegistryMessage) error {
+	n.workPoolLock.RLock()
+	defer n.workPoolLock.RUnlock()
+
+	failures := &publishFailures{}
+	var wg sync.WaitGroup
+	wg.Add(len(messages))
+	for _, message := range messages {
+		n.emit(subject, message, &wg, failures)
+	}
+	wg.Wait()
+
+	if failures.err != nil {
+		return failures.err
+	}
+
+	err := n.metronClient.IncrementCounterWithDelta(targetedRouteNATSMessagesEmittedCounter, uint64(len(messages)))
+	if err != nil {
+		n.logger.Error("cannot-emit-number-of-targeted-messages", err)
+	}
+
+	return nil
+}
+
+// SetWorkers replaces the work pool with one of the given size once the
+// messages that are being emitted were published, and stops the old one.
+func (n *natsEmitter) SetWorkers(workers int) error {
+	workPool, err := workpool.NewWorkPool(workers)
+	if err != nil {
+		return err
+	}
+
+	n.workPoolLock.Lock()
+	oldWorkPool := n.workPool
+	n.workPool = workPool
+	n.workPoolLock.Unlock()
+
+	oldWorkPool.Stop()
+	n.logger.Info("workers-changed", lager.Data{"num-workers": workers})
 	return nil
 }
 
-func (n *natsEmitter) emit(subject string, message routingtable.RegistryMessage, wg *sync.WaitGroup, errors chan error) {
+// publishFailures collects the messages that could not be published, and the
+// first error.
+type publishFailures struct {
+	lock     sync.Mutex
+	err      error
+	messages []routingtable.RegistryMessage
+}
+
+func (f *publishFailures) add(message routingtable.RegistryMessage, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.err == nil {
+		f.err = err
+	}
+	f.messages = append(f.messages, message)
+}
+
+func (n *natsEmitter) emitAll(subjects []string, suffix string, messages []routingtable.RegistryMessage, wg *sync.WaitGroup, failures *publishFailures) {
+	wg.Add(len(subjects) * len(messages))
+	for _, subject := range subjects {
+		for _, message := range messages {
+			n.emit(subject+suffix, message, wg, failures)
+		}
+	}
+}
+
+func (n *natsEmitter) emit(subject string, message routingtable.RegistryMessage, wg *sync.WaitGroup, failures *publishFailures) {
 	n.workPool.Submit(func() {
 		var err error
 		defer func() {
 			if err != nil {
-				select {
-				case errors <- err:
-				default:
-				}
+				failures.add(message, err)
 			}
 			wg.Done()
 		}()
@@ -222,6 +222,46 @@ var _ = Describe("NatsEmitter", func() {
 			})
 		})
 
+		Context("when the nats emitter is configured with subjects", func() {
+			BeforeEach(func() {
+				logger := lagertest.NewTestLogger("test")
+				workPool, err := workpool.NewWorkPool(1)
+				Expect(err).NotTo(HaveOccurred())
+				natsEmitter = emitter.NewNATSEmitterWithSubjects(natsClient, workPool, logger, fakeMetronClient, emitter.Subjects{
+					External: []string{"router", "edge-router.routes"},
+					Internal: []string{"edge-discovery"},
+				})
+			})
+
+			It("emits the routes to every subject of their type", func() {
+				err := natsEmitter.Emit(messagesToEmit)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(natsClient.PublishedMessages("router.register")).To(HaveLen(2))
+				Expect(natsClient.PublishedMessages("router.unregister")).To(HaveLen(2))
+				Expect(natsClient.PublishedMessages("edge-router.routes.register")).To(HaveLen(2))
+				Expect(natsClient.PublishedMessages("edge-router.routes.unregister")).To(HaveLen(2))
+				Expect(natsClient.PublishedMessages("edge-discovery.register")).To(HaveLen(2))
+				Expect(natsClient.PublishedMessages("edge-discovery.unregister")).To(HaveLen(2))
+				Expect(natsClient.PublishedMessages("service-discovery.register")).To(HaveLen(0))
+
+				Expect(natsClient.PublishedMessages("edge-router.routes.register")[0].Data).To(Equal(natsClient.PublishedMessages("router.register")[0].Data))
+			})
+
+			It("counts every message once per subject it was published to", func() {
+				err := natsEmitter.Emit(messagesToEmit)
+				Expect(err).NotTo(HaveOccurred())
+
+				Eventually(fakeMetronClient.IncrementCounterWithDeltaCallCount).Should(Equal(2))
+				name, delta := fakeMetronClient.IncrementCounterWithDeltaArgsForCall(0)
+				Expect(name).To(Equal("HTTPRouteNATSMessagesEmitted"))
+				Expect(delta).To(BeEquivalentTo(8))
+				name, delta = fakeMetronClient.IncrementCounterWithDeltaArgsForCall(1)
+				Expect(name).To(Equal("InternalRouteNATSMessagesEmitted"))
+				Expect(delta).To(BeEquivalentTo(4))
+			})
+		})
+
 		Context("when the nats client errors", func() {
 			BeforeEach(func() {
 				natsClient.WhenPublishing("router.register", func(*nats.Msg) error {
@@ -232,6 +272,15 @@ var _ = Describe("NatsEmitter", func() {
 			It("should error", func() {
 				Expect(natsEmitter.Emit(messagesToEmit)).To(MatchError(errors.New("bam")))
 			})
+
+			It("returns the messages that could not be published", func() {
+				failed, err := natsEmitter.EmitEach(messagesToEmit)
+				Expect(err).To(MatchError("bam"))
+				Expect(failed).To(ConsistOf(messagesToEmit.RegistrationMessages))
+
+				Expect(natsClient.PublishedMessages("router.unregister")).To(HaveLen(2))
+				Expect(fakeMetronClient.IncrementCounterWithDeltaCallCount()).To(Equal(0))
+			})
 		})
 
 		Context("when the metron client errors", func() {
@@ -247,4 +296,57 @@ var _ = Describe("NatsEmitter", func() {
 			})
 		})
 	})
+
+	Describe("EmitTo", func() {
+		It("publishes the messages to the subject only", func() {
+			err := natsEmitter.EmitTo("_INBOX.new-router", messagesToEmit.RegistrationMessages)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(natsClient.PublishedMessages("_INBOX.new-router")).To(HaveLen(2))
+			Expect(natsClient.PublishedMessages("router.register")).To(BeEmpty())
+
+			payloads := [][]byte{
+				natsClient.PublishedMessages("_INBOX.new-router")[0].Data,
+				natsClient.PublishedMessages("_INBOX.new-router")[1].Data,
+			}
+			Expect(payloads).To(ContainElement(MatchJSON(`{"uris":["baz.com"],"host":"2.2.2.2","port":22}`)))
+
+			Expect(fakeMetronClient.IncrementCounterWithDeltaCallCount()).To(Equal(1))
+			name, delta := fakeMetronClient.IncrementCounterWithDeltaArgsForCall(0)
+			Expect(name).To(Equal("TargetedRouteNATSMessagesEmitted"))
+			Expect(delta).To(BeEquivalentTo(2))
+		})
+
+		Context("when the nats client errors", func() {
+			BeforeEach(func() {
+				natsClient.WhenPublishing("_INBOX.new-router", func(*nats.Msg) error {
+					return errors.New("bam")
+				})
+			})
+
+			It("should error", func() {
+				Expect(natsEmitter.EmitTo("_INBOX.new-router", messagesToEmit.RegistrationMessages)).To(MatchError(errors.New("bam")))
+			})
+		})
+	})
+
+	Describe("SetWorkers", func() {
+		It("keeps emitting with the new number of workers", func() {
+			Expect(natsEmitter.SetWorkers(4)).To(Succeed())
+			Expect(logger).To(gbytes.Say("workers-changed.*\"num-workers\":4"))
+
+			Expect(natsEmitter.Emit(messagesToEmit)).To(Succeed())
+			Expect(natsClient.PublishedMessages("router.register")).To(HaveLen(2))
+			Expect(natsClient.PublishedMessages("service-discovery.register")).To(HaveLen(2))
+		})
+
+		Context("when the number of workers is invalid", func() {
+			It("errors and keeps the old workers", func() {
+				Expect(natsEmitter.SetWorkers(0)).To(HaveOccurred())
+
+				Expect(natsEmitter.Emit(messagesToEmit)).To(Succeed())
+				Expect(natsClient.PublishedMessages("router.register")).To(HaveLen(2))
+			})
+		})
+	})
 })
@@ -0,0 +1,121 @@
+package filter
+
+import (
+	"strings"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/routing-info/cfroutes"
+	"code.cloudfoundry.org/routing-info/tcp_routes"
+)
+
+// Rule matches a value when it is in Include, or Include is empty, and it is
+// not in Exclude. Exclude always wins.
+type Rule struct {
+	Include []string
+	Exclude []string
+}
+
+func (r Rule) empty() bool {
+	return len(r.Include) == 0 && len(r.Exclude) == 0
+}
+
+func (r Rule) matches(value string, match func(value, pattern string) bool) bool {
+	for _, pattern := range r.Exclude {
+		if match(value, pattern) {
+			return false
+		}
+	}
+	if len(r.Include) == 0 {
+		return true
+	}
+	for _, pattern := range r.Include {
+		if match(value, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func equal(value, pattern string) bool {
+	return value == pattern
+}
+
+// Filter limits the routes an emitter publishes. Domains and process guid
+// prefixes select whole LRPs, isolation segments and router groups select
+// individual http and tcp routes. The shared isolation segment is matched by
+// the empty string.
+type Filter struct {
+	Domains           Rule
+	ProcessGuidPrefix Rule
+	IsolationSegments Rule
+	RouterGroups      Rule
+}
+
+func (f Filter) Empty() bool {
+	return f.Domains.empty() && f.ProcessGuidPrefix.empty() && f.IsolationSegments.empty() && f.RouterGroups.empty()
+}
+
+// SelectsLRPs returns true when the filter leaves out whole LRPs, as opposed
+// to only some of their routes.
+func (f Filter) SelectsLRPs() bool {
+	return !f.Domains.empty() || !f.ProcessGuidPrefix.empty()
+}
+
+// RouterGroup returns true when the tcp routes of the router group are
+// emitted.
+func (f Filter) RouterGroup(routerGroupGuid string) bool {
+	return f.RouterGroups.matches(routerGroupGuid, equal)
+}
+
+func (f Filter) DesiredLRP(desiredLRP *models.DesiredLRP) bool {
+	return f.lrp(desiredLRP.ProcessGuid, desiredLRP.Domain)
+}
+
+func (f Filter) ActualLRP(actualLRP *models.ActualLRP) bool {
+	return f.lrp(actualLRP.ProcessGuid, actualLRP.Domain)
+}
+
+func (f Filter) lrp(processGuid, domain string) bool {
+	return f.Domains.matches(domain, equal) && f.ProcessGuidPrefix.matches(processGuid, strings.HasPrefix)
+}
+
+// Routes returns a copy of the desired lrp without the http routes of
+// filtered isolation segments and the tcp routes of filtered router groups.
+func (f Filter) Routes(desiredLRP *models.DesiredLRP) *models.DesiredLRP {
+	if desiredLRP == nil || desiredLRP.Routes == nil || (f.IsolationSegments.empty() && f.RouterGroups.empty()) {
+		return desiredLRP
+	}
+
+	routes := models.Routes{}
+	for key, value := range *desiredLRP.Routes {
+		routes[key] = value
+	}
+
+	if !f.IsolationSegments.empty() {
+		if httpRoutes, err := cfroutes.CFRoutesFromRoutingInfo(routes); err == nil && len(httpRoutes) > 0 {
+			filtered := cfroutes.CFRoutes{}
+			for _, route := range httpRoutes {
+				if f.IsolationSegments.matches(route.IsolationSegment, equal) {
+					filtered = append(filtered, route)
+				}
+			}
+			routes[cfroutes.CF_ROUTER] = filtered.RoutingInfo()[cfroutes.CF_ROUTER]
+		}
+	}
+
+	if !f.RouterGroups.empty() {
+		if tcpRoutes, err := tcp_routes.TCPRoutesFromRoutingInfo(&routes); err == nil && len(tcpRoutes) > 0 {
+			filtered := tcp_routes.TCPRoutes{}
+			for _, route := range tcpRoutes {
+				if f.RouterGroups.matches(route.RouterGroupGuid, equal) {
+					filtered = append(filtered, route)
+				}
+			}
+			routes[tcp_routes.TCP_ROUTER] = (*filtered.RoutingInfo())[tcp_routes.TCP_ROUTER]
+		}
+	}
+
+	filteredLRP := *desiredLRP
+	filteredLRP.Routes = &routes
+	return &filteredLRP
+}
@@ -0,0 +1,145 @@
+package filter_test
+
+import (
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/route-emitter/filter"
+	"code.cloudfoundry.org/routing-info/cfroutes"
+	"code.cloudfoundry.org/routing-info/tcp_routes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Filter", func() {
+	var (
+		f          filter.Filter
+		desiredLRP *models.DesiredLRP
+		actualLRP  *models.ActualLRP
+	)
+
+	BeforeEach(func() {
+		f = filter.Filter{}
+
+		routes := cfroutes.CFRoutes{
+			{Hostnames: []string{"shared.example.com"}, Port: 8080},
+			{Hostnames: []string{"segment-a.example.com"}, Port: 8080, IsolationSegment: "segment-a"},
+			{Hostnames: []string{"segment-b.example.com"}, Port: 8080, IsolationSegment: "segment-b"},
+		}.RoutingInfo()
+		tcpRoutes := tcp_routes.TCPRoutes{
+			{RouterGroupGuid: "router-group-1", ExternalPort: 61000, ContainerPort: 5222},
+			{RouterGroupGuid: "router-group-2", ExternalPort: 61001, ContainerPort: 5222},
+		}.RoutingInfo()
+		routes[tcp_routes.TCP_ROUTER] = (*tcpRoutes)[tcp_routes.TCP_ROUTER]
+
+		desiredLRP = &models.DesiredLRP{
+			ProcessGuid: "app-process-guid",
+			Domain:      "cf-apps",
+			Routes:      &routes,
+		}
+		actualLRP = &models.ActualLRP{
+			ActualLRPKey: models.NewActualLRPKey("app-process-guid", 0, "cf-apps"),
+		}
+	})
+
+	hostnames := func(desiredLRP *models.DesiredLRP) []string {
+		routes, err := cfroutes.CFRoutesFromRoutingInfo(*desiredLRP.Routes)
+		Expect(err).NotTo(HaveOccurred())
+		hostnames := []string{}
+		for _, route := range routes {
+			hostnames = append(hostnames, route.Hostnames...)
+		}
+		return hostnames
+	}
+
+	routerGroups := func(desiredLRP *models.DesiredLRP) []string {
+		routes, err := tcp_routes.TCPRoutesFromRoutingInfo(desiredLRP.Routes)
+		Expect(err).NotTo(HaveOccurred())
+		routerGroups := []string{}
+		for _, route := range routes {
+			routerGroups = append(routerGroups, route.RouterGroupGuid)
+		}
+		return routerGroups
+	}
+
+	Context("when empty", func() {
+		It("accepts everything", func() {
+			Expect(f.Empty()).To(BeTrue())
+			Expect(f.DesiredLRP(desiredLRP)).To(BeTrue())
+			Expect(f.ActualLRP(actualLRP)).To(BeTrue())
+			Expect(f.Routes(desiredLRP)).To(BeIdenticalTo(desiredLRP))
+		})
+	})
+
+	Describe("domains", func() {
+		It("only accepts included domains", func() {
+			f.Domains.Include = []string{"other"}
+			Expect(f.DesiredLRP(desiredLRP)).To(BeFalse())
+			Expect(f.ActualLRP(actualLRP)).To(BeFalse())
+
+			f.Domains.Include = []string{"other", "cf-apps"}
+			Expect(f.DesiredLRP(desiredLRP)).To(BeTrue())
+			Expect(f.ActualLRP(actualLRP)).To(BeTrue())
+		})
+
+		It("lets excludes win over includes", func() {
+			f.Domains = filter.Rule{Include: []string{"cf-apps"}, Exclude: []string{"cf-apps"}}
+			Expect(f.DesiredLRP(desiredLRP)).To(BeFalse())
+		})
+	})
+
+	Describe("process guid prefixes", func() {
+		It("matches the start of the process guid", func() {
+			f.ProcessGuidPrefix.Exclude = []string{"app-"}
+			Expect(f.DesiredLRP(desiredLRP)).To(BeFalse())
+			Expect(f.ActualLRP(actualLRP)).To(BeFalse())
+
+			f.ProcessGuidPrefix.Exclude = []string{"process-guid"}
+			Expect(f.DesiredLRP(desiredLRP)).To(BeTrue())
+		})
+
+		It("selects lrps", func() {
+			f.ProcessGuidPrefix.Include = []string{"app-"}
+			Expect(f.SelectsLRPs()).To(BeTrue())
+		})
+	})
+
+	Describe("isolation segments", func() {
+		It("removes the http routes of other isolation segments", func() {
+			f.IsolationSegments.Include = []string{"segment-a"}
+			Expect(f.SelectsLRPs()).To(BeFalse())
+			Expect(f.DesiredLRP(desiredLRP)).To(BeTrue())
+
+			filtered := f.Routes(desiredLRP)
+			Expect(hostnames(filtered)).To(ConsistOf("segment-a.example.com"))
+			Expect(routerGroups(filtered)).To(ConsistOf("router-group-1", "router-group-2"))
+		})
+
+		It("matches the shared segment with an empty string", func() {
+			f.IsolationSegments.Exclude = []string{""}
+			Expect(hostnames(f.Routes(desiredLRP))).To(ConsistOf("segment-a.example.com", "segment-b.example.com"))
+		})
+
+		It("does not modify the original desired lrp", func() {
+			f.IsolationSegments.Include = []string{"segment-a"}
+			f.Routes(desiredLRP)
+			Expect(hostnames(desiredLRP)).To(HaveLen(3))
+		})
+	})
+
+	Describe("router groups", func() {
+		It("removes the tcp routes of other router groups", func() {
+			f.RouterGroups.Exclude = []string{"router-group-1"}
+
+			filtered := f.Routes(desiredLRP)
+			Expect(routerGroups(filtered)).To(ConsistOf("router-group-2"))
+			Expect(hostnames(filtered)).To(HaveLen(3))
+		})
+
+		It("selects the router groups that are not excluded", func() {
+			f.RouterGroups.Exclude = []string{"router-group-1"}
+
+			Expect(f.RouterGroup("router-group-1")).To(BeFalse())
+			Expect(f.RouterGroup("router-group-2")).To(BeTrue())
+		})
+	})
+})
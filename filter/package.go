@@ -0,0 +1 @@
+package filter // import "code.cloudfoundry.org/route-emitter/filter"
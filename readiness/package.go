@@ -0,0 +1 @@
+package readiness // import "code.cloudfoundry.org/route-emitter/readiness"
@@ -0,0 +1,176 @@
+package readiness
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/route-emitter/watcher"
+	"github.com/tedsuo/ifrit"
+)
+
+// DefaultPingInterval is how often the ping runner checks the NATS
+// connection.
+const DefaultPingInterval = 5 * time.Second
+
+type NATSPinger interface {
+	Ping() bool
+}
+
+type WatcherStatus interface {
+	Status() watcher.Status
+}
+
+// Check is the state of one of the conditions the emitter needs to emit
+// routes. LastSuccess is omitted if the condition was never met.
+type Check struct {
+	Ready       bool       `json:"ready"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+}
+
+// Report is the readiness of the emitter, it is ready once all of its checks
+// are. Lock is only reported if the emitter has to hold the lock.
+type Report struct {
+	Ready           bool   `json:"ready"`
+	NATS            Check  `json:"nats"`
+	BBSSubscription Check  `json:"bbs_subscription"`
+	FirstSync       Check  `json:"first_sync"`
+	Lock            *Check `json:"lock,omitempty"`
+}
+
+// Checker reports whether the emitter can emit routes: NATS is connected, the
+// BBS event subscription is active, the first sync has completed and, in
+// global mode, the lock is held. NATS is pinged by the ping runner, a report
+// only reads the result of its last ping so that probes never wait on NATS.
+type Checker struct {
+	logger       lager.Logger
+	clock        clock.Clock
+	natsClient   NATSPinger
+	watcher      WatcherStatus
+	lockRequired bool
+
+	lock       sync.Mutex
+	pinged     bool
+	lastPinged time.Time
+	lockHeld   bool
+	lastLocked time.Time
+}
+
+func NewChecker(logger lager.Logger, clock clock.Clock, natsClient NATSPinger, watcher WatcherStatus, lockRequired bool) *Checker {
+	return &Checker{
+		logger:       logger.Session("readiness"),
+		clock:        clock,
+		natsClient:   natsClient,
+		watcher:      watcher,
+		lockRequired: lockRequired,
+	}
+}
+
+func (c *Checker) Report() Report {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	status := c.watcher.Status()
+	report := Report{
+		NATS:            newCheck(c.pinged, c.lastPinged),
+		BBSSubscription: newCheck(status.Subscribed, status.LastSubscribed),
+		FirstSync:       newCheck(status.Synced, status.LastSynced),
+	}
+	report.Ready = report.NATS.Ready && report.BBSSubscription.Ready && report.FirstSync.Ready
+
+	if c.lockRequired {
+		lock := newCheck(c.lockHeld, c.lastLocked)
+		report.Lock = &lock
+		report.Ready = report.Ready && lock.Ready
+	}
+
+	return report
+}
+
+// ServeHTTP responds with the report as JSON, the status is 503 unless the
+// emitter is ready.
+func (c *Checker) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	report := c.Report()
+
+	resp.Header().Set("Content-Type", "application/json")
+	if !report.Ready {
+		resp.WriteHeader(http.StatusServiceUnavailable)
+	}
+	err := json.NewEncoder(resp).Encode(report)
+	if err != nil {
+		c.logger.Error("failed-to-encode-report", err)
+	}
+}
+
+// PingRunner returns a runner that pings NATS right away and then on every
+// interval, and records the result for the reports. NATS is not ready until
+// the runner has pinged it.
+func (c *Checker) PingRunner(interval time.Duration) ifrit.Runner {
+	return ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+		c.ping()
+		close(ready)
+
+		ticker := c.clock.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C():
+				c.ping()
+			case <-signals:
+				return nil
+			}
+		}
+	})
+}
+
+func (c *Checker) ping() {
+	pinged := c.natsClient.Ping()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if pinged != c.pinged {
+		c.logger.Info("nats-ping-changed", lager.Data{"pinged": pinged})
+	}
+	c.pinged = pinged
+	if pinged {
+		c.lastPinged = c.clock.Now()
+	}
+}
+
+// LockRunner returns a runner that marks the lock as held while it is
+// running. It is meant to be started right after the lock in an ordered
+// group, which only happens once the lock is acquired.
+func (c *Checker) LockRunner() ifrit.Runner {
+	return ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+		c.setLockHeld(true)
+		defer c.setLockHeld(false)
+
+		close(ready)
+		<-signals
+		return nil
+	})
+}
+
+func (c *Checker) setLockHeld(held bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.lockHeld = held
+	if held {
+		c.lastLocked = c.clock.Now()
+	}
+}
+
+func newCheck(ready bool, lastSuccess time.Time) Check {
+	check := Check{Ready: ready}
+	if !lastSuccess.IsZero() {
+		check.LastSuccess = &lastSuccess
+	}
+	return check
+}
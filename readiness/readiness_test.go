@@ -0,0 +1,194 @@
+package readiness_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/route-emitter/readiness"
+	"code.cloudfoundry.org/route-emitter/watcher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+type fakePinger struct {
+	lock  sync.Mutex
+	pong  bool
+	pings int
+}
+
+func (p *fakePinger) Ping() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.pings++
+	return p.pong
+}
+
+func (p *fakePinger) setPong(pong bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.pong = pong
+}
+
+func (p *fakePinger) pingCount() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.pings
+}
+
+type fakeWatcher struct {
+	status watcher.Status
+}
+
+func (w *fakeWatcher) Status() watcher.Status {
+	return w.status
+}
+
+var _ = Describe("Checker", func() {
+	var (
+		clock        *fakeclock.FakeClock
+		pinger       *fakePinger
+		routeWatcher *fakeWatcher
+		lockRequired bool
+		checker      *readiness.Checker
+		pingProcess  ifrit.Process
+		subscribedAt time.Time
+		syncedAt     time.Time
+	)
+
+	BeforeEach(func() {
+		clock = fakeclock.NewFakeClock(time.Now())
+		subscribedAt = clock.Now().Add(-time.Minute)
+		syncedAt = clock.Now().Add(-time.Second)
+		pinger = &fakePinger{pong: true}
+		routeWatcher = &fakeWatcher{status: watcher.Status{
+			Subscribed:     true,
+			LastSubscribed: subscribedAt,
+			Synced:         true,
+			LastSynced:     syncedAt,
+		}}
+		lockRequired = false
+	})
+
+	JustBeforeEach(func() {
+		checker = readiness.NewChecker(lagertest.NewTestLogger("test"), clock, pinger, routeWatcher, lockRequired)
+		pingProcess = ifrit.Invoke(checker.PingRunner(time.Second))
+	})
+
+	AfterEach(func() {
+		pingProcess.Signal(os.Interrupt)
+		Eventually(pingProcess.Wait()).Should(Receive(BeNil()))
+	})
+
+	It("is ready when nats is connected, the watcher is subscribed and has synced", func() {
+		report := checker.Report()
+		Expect(report.Ready).To(BeTrue())
+		Expect(report.NATS.Ready).To(BeTrue())
+		Expect(*report.NATS.LastSuccess).To(Equal(clock.Now()))
+		Expect(*report.BBSSubscription.LastSuccess).To(Equal(subscribedAt))
+		Expect(*report.FirstSync.LastSuccess).To(Equal(syncedAt))
+		Expect(report.Lock).To(BeNil())
+	})
+
+	It("does not ping nats for a report", func() {
+		Expect(pinger.pingCount()).To(Equal(1))
+		checker.Report()
+		checker.Report()
+		Expect(pinger.pingCount()).To(Equal(1))
+
+		clock.WaitForWatcherAndIncrement(time.Second)
+		Eventually(pinger.pingCount).Should(Equal(2))
+	})
+
+	Context("when nats is not connected", func() {
+		It("is not ready and reports the last successful ping", func() {
+			pingedAt := clock.Now()
+
+			pinger.setPong(false)
+			clock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(func() bool { return checker.Report().NATS.Ready }).Should(BeFalse())
+
+			report := checker.Report()
+			Expect(report.Ready).To(BeFalse())
+			Expect(*report.NATS.LastSuccess).To(Equal(pingedAt))
+		})
+	})
+
+	Context("when the watcher has not synced yet", func() {
+		BeforeEach(func() {
+			routeWatcher.status.Synced = false
+			routeWatcher.status.LastSynced = time.Time{}
+		})
+
+		It("is not ready", func() {
+			report := checker.Report()
+			Expect(report.Ready).To(BeFalse())
+			Expect(report.FirstSync.Ready).To(BeFalse())
+			Expect(report.FirstSync.LastSuccess).To(BeNil())
+		})
+	})
+
+	Context("when the watcher is not subscribed", func() {
+		BeforeEach(func() {
+			routeWatcher.status.Subscribed = false
+		})
+
+		It("is not ready", func() {
+			report := checker.Report()
+			Expect(report.Ready).To(BeFalse())
+			Expect(report.BBSSubscription.Ready).To(BeFalse())
+			Expect(*report.BBSSubscription.LastSuccess).To(Equal(subscribedAt))
+		})
+	})
+
+	Context("when the lock is required", func() {
+		BeforeEach(func() {
+			lockRequired = true
+		})
+
+		It("is only ready while the lock runner is running", func() {
+			Expect(checker.Report().Ready).To(BeFalse())
+			Expect(checker.Report().Lock.Ready).To(BeFalse())
+
+			process := ifrit.Invoke(checker.LockRunner())
+			report := checker.Report()
+			Expect(report.Ready).To(BeTrue())
+			Expect(*report.Lock.LastSuccess).To(Equal(clock.Now()))
+
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+			Expect(checker.Report().Ready).To(BeFalse())
+		})
+	})
+
+	Describe("ServeHTTP", func() {
+		It("responds with the report", func() {
+			resp := httptest.NewRecorder()
+			checker.ServeHTTP(resp, httptest.NewRequest("GET", "/ready", nil))
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			var report readiness.Report
+			Expect(json.Unmarshal(resp.Body.Bytes(), &report)).To(Succeed())
+			Expect(report.Ready).To(BeTrue())
+		})
+
+		Context("when the emitter is not ready", func() {
+			BeforeEach(func() {
+				pinger.setPong(false)
+			})
+
+			It("responds with service unavailable", func() {
+				resp := httptest.NewRecorder()
+				checker.ServeHTTP(resp, httptest.NewRequest("GET", "/ready", nil))
+				Expect(resp.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(resp.Body.String()).To(ContainSubstring(`"ready":false`))
+			})
+		})
+	})
+})
@@ -0,0 +1 @@
+package reconciler // import "code.cloudfoundry.org/route-emitter/reconciler"
@@ -0,0 +1,190 @@
+package reconciler
+
+import (
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/route-emitter/filter"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+	"code.cloudfoundry.org/routing-api"
+	tcpmodels "code.cloudfoundry.org/routing-api/models"
+	uaaclient "code.cloudfoundry.org/uaa-go-client"
+)
+
+const (
+	staleTCPRouteMappingsCounter        = "StaleTCPRouteMappings"
+	staleTCPRouteMappingsDeletedCounter = "StaleTCPRouteMappingsDeleted"
+)
+
+// TCPRouteReconciler periodically removes TCP route mappings from the Routing
+// API that are no longer backed by an endpoint in the routing table. Only the
+// router groups that the route filter lets the emitter publish to are
+// reconciled, so mappings owned by other emitters are left alone. A router
+// group without any route in the table is reconciled as well, e.g. after its
+// apps were deleted while the emitter was down.
+type TCPRouteReconciler struct {
+	logger           lager.Logger
+	clock            clock.Clock
+	routingTable     routingtable.RoutingTable
+	routingAPIClient routing_api.Client
+	uaaClient        uaaclient.Client
+	metronClient     loggingclient.IngressClient
+	routeFilter      filter.Filter
+	interval         time.Duration
+	dryRun           bool
+}
+
+func NewTCPRouteReconciler(
+	logger lager.Logger,
+	clock clock.Clock,
+	routingTable routingtable.RoutingTable,
+	routingAPIClient routing_api.Client,
+	uaaClient uaaclient.Client,
+	metronClient loggingclient.IngressClient,
+	routeFilter filter.Filter,
+	interval time.Duration,
+	dryRun bool,
+) *TCPRouteReconciler {
+	return &TCPRouteReconciler{
+		logger:           logger.Session("tcp-route-reconciler"),
+		clock:            clock,
+		routingTable:     routingTable,
+		routingAPIClient: routingAPIClient,
+		uaaClient:        uaaClient,
+		metronClient:     metronClient,
+		routeFilter:      routeFilter,
+		interval:         interval,
+		dryRun:           dryRun,
+	}
+}
+
+func (r *TCPRouteReconciler) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	r.logger.Info("starting", lager.Data{"interval": r.interval.String(), "dry-run": r.dryRun})
+	close(ready)
+	defer r.logger.Info("exiting")
+
+	ticker := r.clock.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-signals:
+			r.logger.Info("stopping")
+			return nil
+		case <-ticker.C():
+			logger := r.logger.Session("reconcile")
+			_, err := r.Reconcile(logger)
+			if err != nil {
+				logger.Error("failed-to-reconcile", err)
+			}
+		}
+	}
+}
+
+// Reconcile lists the TCP route mappings known to the Routing API and deletes
+// the ones of the emitter's router groups that are missing from the routing
+// table. In dry-run mode nothing is deleted. The stale mappings are returned in
+// both modes.
+func (r *TCPRouteReconciler) Reconcile(logger lager.Logger) ([]tcpmodels.TcpRouteMapping, error) {
+	// list the routing api before looking at the table, mappings registered in
+	// between are then never considered stale
+	var existing []tcpmodels.TcpRouteMapping
+	err := r.withToken(func() error {
+		var err error
+		existing, err = r.routingAPIClient.TcpRouteMappings()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	current, _ := r.routingTable.GetExternalRoutingEvents()
+	stale := staleMappings(existing, current.Registrations, r.routeFilter.RouterGroup)
+	if len(stale) == 0 {
+		logger.Debug("no-stale-tcp-route-mappings", lager.Data{"num-existing-mappings": len(existing)})
+		return nil, nil
+	}
+
+	err = r.metronClient.IncrementCounterWithDelta(staleTCPRouteMappingsCounter, uint64(len(stale)))
+	if err != nil {
+		logger.Error("failed-to-send-stale-tcp-route-mappings-metric", err)
+	}
+
+	if r.dryRun {
+		logger.Info("would-delete-stale-tcp-route-mappings", lager.Data{"count": len(stale), "mappings": stale})
+		return stale, nil
+	}
+
+	logger.Info("deleting-stale-tcp-route-mappings", lager.Data{"count": len(stale), "mappings": stale})
+	err = r.withToken(func() error {
+		return r.routingAPIClient.DeleteTcpRouteMappings(stale)
+	})
+	if err != nil {
+		return stale, err
+	}
+
+	err = r.metronClient.IncrementCounterWithDelta(staleTCPRouteMappingsDeletedCounter, uint64(len(stale)))
+	if err != nil {
+		logger.Error("failed-to-send-stale-tcp-route-mappings-deleted-metric", err)
+	}
+	logger.Info("deleted-stale-tcp-route-mappings", lager.Data{"count": len(stale)})
+
+	return stale, nil
+}
+
+// withToken calls f with a cached token and retries once with a fresh token,
+// the same way the routing api emitter does.
+func (r *TCPRouteReconciler) withToken(f func() error) error {
+	var err error
+	for count := 0; count < 2; count++ {
+		token, tokenErr := r.uaaClient.FetchToken(count > 0)
+		if tokenErr != nil {
+			return tokenErr
+		}
+		r.routingAPIClient.SetToken(token.AccessToken)
+
+		err = f()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+type mappingKey struct {
+	routerGroupGUID string
+	externalPort    uint16
+	hostIP          string
+	hostPort        uint16
+}
+
+func keyFor(mapping tcpmodels.TcpRouteMapping) mappingKey {
+	return mappingKey{
+		routerGroupGUID: mapping.RouterGroupGuid,
+		externalPort:    mapping.ExternalPort,
+		hostIP:          mapping.HostIP,
+		hostPort:        mapping.HostPort,
+	}
+}
+
+func staleMappings(existing, current []tcpmodels.TcpRouteMapping, ownRouterGroup func(string) bool) []tcpmodels.TcpRouteMapping {
+	known := make(map[mappingKey]struct{}, len(current))
+	for _, mapping := range current {
+		known[keyFor(mapping)] = struct{}{}
+	}
+
+	var stale []tcpmodels.TcpRouteMapping
+	for _, mapping := range existing {
+		if !ownRouterGroup(mapping.RouterGroupGuid) {
+			continue
+		}
+		if _, ok := known[keyFor(mapping)]; ok {
+			continue
+		}
+		stale = append(stale, mapping)
+	}
+	return stale
+}
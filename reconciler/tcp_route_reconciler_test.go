@@ -0,0 +1,229 @@
+package reconciler_test
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/route-emitter/filter"
+	"code.cloudfoundry.org/route-emitter/reconciler"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+	"code.cloudfoundry.org/route-emitter/routingtable/fakeroutingtable"
+	"code.cloudfoundry.org/routing-api/fake_routing_api"
+	apimodels "code.cloudfoundry.org/routing-api/models"
+	fakeuaa "code.cloudfoundry.org/uaa-go-client/fakes"
+	"code.cloudfoundry.org/uaa-go-client/schema"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TCPRouteReconciler", func() {
+	var (
+		logger           *lagertest.TestLogger
+		clock            *fakeclock.FakeClock
+		routingTable     *fakeroutingtable.FakeRoutingTable
+		routingAPIClient *fake_routing_api.FakeClient
+		uaaClient        *fakeuaa.FakeClient
+		fakeMetronClient *mfakes.FakeIngressClient
+		routeFilter      filter.Filter
+		dryRun           bool
+		interval         time.Duration
+		tcpReconciler    *reconciler.TCPRouteReconciler
+
+		liveMapping, staleMapping, foreignMapping apimodels.TcpRouteMapping
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		clock = fakeclock.NewFakeClock(time.Now())
+		routingTable = &fakeroutingtable.FakeRoutingTable{}
+		routingAPIClient = &fake_routing_api.FakeClient{}
+		uaaClient = &fakeuaa.FakeClient{}
+		fakeMetronClient = &mfakes.FakeIngressClient{}
+		routeFilter = filter.Filter{RouterGroups: filter.Rule{Include: []string{"router-group-1"}}}
+		dryRun = false
+		interval = time.Minute
+
+		uaaClient.FetchTokenReturns(&schema.Token{AccessToken: "accesstoken"}, nil)
+
+		liveMapping = apimodels.NewTcpRouteMapping("router-group-1", 61000, "1.1.1.1", 62000, 0)
+		staleMapping = apimodels.NewTcpRouteMapping("router-group-1", 61001, "2.2.2.2", 62001, 0)
+		foreignMapping = apimodels.NewTcpRouteMapping("router-group-2", 61002, "3.3.3.3", 62002, 0)
+
+		routingTable.GetExternalRoutingEventsReturns(routingtable.TCPRouteMappings{
+			Registrations: []apimodels.TcpRouteMapping{liveMapping},
+		}, routingtable.MessagesToEmit{})
+		routingAPIClient.TcpRouteMappingsReturns([]apimodels.TcpRouteMapping{
+			liveMapping, staleMapping, foreignMapping,
+		}, nil)
+	})
+
+	JustBeforeEach(func() {
+		tcpReconciler = reconciler.NewTCPRouteReconciler(
+			logger,
+			clock,
+			routingTable,
+			routingAPIClient,
+			uaaClient,
+			fakeMetronClient,
+			routeFilter,
+			interval,
+			dryRun,
+		)
+	})
+
+	Describe("Reconcile", func() {
+		It("deletes mappings in the emitter's router groups that have no endpoint", func() {
+			stale, err := tcpReconciler.Reconcile(logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stale).To(ConsistOf(staleMapping))
+
+			Expect(routingAPIClient.DeleteTcpRouteMappingsCallCount()).To(Equal(1))
+			Expect(routingAPIClient.DeleteTcpRouteMappingsArgsForCall(0)).To(ConsistOf(staleMapping))
+		})
+
+		It("authorizes the routing API calls with a token", func() {
+			_, err := tcpReconciler.Reconcile(logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(routingAPIClient.SetTokenCallCount()).To(Equal(2))
+			Expect(routingAPIClient.SetTokenArgsForCall(0)).To(Equal("accesstoken"))
+		})
+
+		It("emits metrics for stale and deleted mappings", func() {
+			_, err := tcpReconciler.Reconcile(logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeMetronClient.IncrementCounterWithDeltaCallCount()).To(Equal(2))
+			name, delta := fakeMetronClient.IncrementCounterWithDeltaArgsForCall(0)
+			Expect(name).To(Equal("StaleTCPRouteMappings"))
+			Expect(delta).To(BeEquivalentTo(1))
+			name, delta = fakeMetronClient.IncrementCounterWithDeltaArgsForCall(1)
+			Expect(name).To(Equal("StaleTCPRouteMappingsDeleted"))
+			Expect(delta).To(BeEquivalentTo(1))
+		})
+
+		Context("when every mapping has an endpoint", func() {
+			BeforeEach(func() {
+				routingAPIClient.TcpRouteMappingsReturns([]apimodels.TcpRouteMapping{liveMapping}, nil)
+			})
+
+			It("does not delete anything", func() {
+				stale, err := tcpReconciler.Reconcile(logger)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stale).To(BeEmpty())
+				Expect(routingAPIClient.DeleteTcpRouteMappingsCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the routing table is empty", func() {
+			BeforeEach(func() {
+				routingTable.GetExternalRoutingEventsReturns(routingtable.TCPRouteMappings{}, routingtable.MessagesToEmit{})
+			})
+
+			It("deletes every mapping of the emitter's router groups", func() {
+				stale, err := tcpReconciler.Reconcile(logger)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stale).To(ConsistOf(liveMapping, staleMapping))
+
+				Expect(routingAPIClient.DeleteTcpRouteMappingsCallCount()).To(Equal(1))
+				Expect(routingAPIClient.DeleteTcpRouteMappingsArgsForCall(0)).To(ConsistOf(liveMapping, staleMapping))
+			})
+
+			Context("and the routing API only has a stale mapping", func() {
+				BeforeEach(func() {
+					routingAPIClient.TcpRouteMappingsReturns([]apimodels.TcpRouteMapping{staleMapping}, nil)
+				})
+
+				It("deletes it", func() {
+					stale, err := tcpReconciler.Reconcile(logger)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(stale).To(ConsistOf(staleMapping))
+
+					Expect(routingAPIClient.DeleteTcpRouteMappingsCallCount()).To(Equal(1))
+					Expect(routingAPIClient.DeleteTcpRouteMappingsArgsForCall(0)).To(ConsistOf(staleMapping))
+				})
+			})
+		})
+
+		Context("when the route filter does not select router groups", func() {
+			BeforeEach(func() {
+				routeFilter = filter.Filter{}
+			})
+
+			It("reconciles every router group", func() {
+				stale, err := tcpReconciler.Reconcile(logger)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stale).To(ConsistOf(staleMapping, foreignMapping))
+			})
+		})
+
+		Context("when dry run is enabled", func() {
+			BeforeEach(func() {
+				dryRun = true
+			})
+
+			It("reports the stale mappings without deleting them", func() {
+				stale, err := tcpReconciler.Reconcile(logger)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stale).To(ConsistOf(staleMapping))
+				Expect(routingAPIClient.DeleteTcpRouteMappingsCallCount()).To(Equal(0))
+				Expect(logger).To(gbytes.Say("would-delete-stale-tcp-route-mappings"))
+			})
+		})
+
+		Context("when listing the mappings fails", func() {
+			BeforeEach(func() {
+				routingAPIClient.TcpRouteMappingsReturns(nil, errors.New("boom"))
+			})
+
+			It("retries with a fresh token and returns the error", func() {
+				_, err := tcpReconciler.Reconcile(logger)
+				Expect(err).To(MatchError("boom"))
+				Expect(uaaClient.FetchTokenCallCount()).To(Equal(2))
+				Expect(uaaClient.FetchTokenArgsForCall(1)).To(BeTrue())
+				Expect(routingAPIClient.DeleteTcpRouteMappingsCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when fetching a token fails", func() {
+			BeforeEach(func() {
+				uaaClient.FetchTokenReturns(nil, errors.New("no token"))
+			})
+
+			It("returns an error", func() {
+				_, err := tcpReconciler.Reconcile(logger)
+				Expect(err).To(MatchError("no token"))
+				Expect(routingAPIClient.TcpRouteMappingsCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("Run", func() {
+		var process ifrit.Process
+
+		JustBeforeEach(func() {
+			process = ifrit.Invoke(tcpReconciler)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+		})
+
+		It("reconciles on every interval", func() {
+			Consistently(routingAPIClient.TcpRouteMappingsCallCount).Should(Equal(0))
+
+			clock.WaitForWatcherAndIncrement(interval)
+			Eventually(routingAPIClient.DeleteTcpRouteMappingsCallCount).Should(Equal(1))
+
+			clock.WaitForWatcherAndIncrement(interval)
+			Eventually(routingAPIClient.DeleteTcpRouteMappingsCallCount).Should(Equal(2))
+		})
+	})
+})
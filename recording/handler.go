@@ -0,0 +1,88 @@
+package recording
+
+import (
+	"io"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/route-emitter/watcher"
+)
+
+// Handler records the events and sync snapshots that the watcher passes to
+// the route handler it wraps.
+type Handler struct {
+	watcher.RouteHandler
+	recorder *Recorder
+}
+
+var _ watcher.RouteHandler = new(Handler)
+
+func NewHandler(routeHandler watcher.RouteHandler, recorder *Recorder) *Handler {
+	return &Handler{
+		RouteHandler: routeHandler,
+		recorder:     recorder,
+	}
+}
+
+func (h *Handler) HandleEvent(logger lager.Logger, event models.Event) {
+	h.record(logger, Entry{Type: EntryTypeEvent, Event: event})
+	h.RouteHandler.HandleEvent(logger, event)
+}
+
+func (h *Handler) Sync(
+	logger lager.Logger,
+	desired []*models.DesiredLRP,
+	runningActual []*models.ActualLRP,
+	domains models.DomainSet,
+	cachedEvents map[string]models.Event,
+) {
+	h.record(logger, Entry{
+		Type:         EntryTypeSync,
+		DesiredLRPs:  desired,
+		ActualLRPs:   runningActual,
+		Domains:      domains,
+		CachedEvents: cachedEvents,
+	})
+	h.RouteHandler.Sync(logger, desired, runningActual, domains, cachedEvents)
+}
+
+func (h *Handler) RefreshDesired(logger lager.Logger, desiredLRPs []*models.DesiredLRP) {
+	h.record(logger, Entry{Type: EntryTypeRefreshDesired, DesiredLRPs: desiredLRPs})
+	h.RouteHandler.RefreshDesired(logger, desiredLRPs)
+}
+
+func (h *Handler) record(logger lager.Logger, entry Entry) {
+	err := h.recorder.Record(entry)
+	if err != nil {
+		logger.Error("failed-to-record", err, lager.Data{"type": entry.Type})
+	}
+}
+
+// Replay passes the recorded entries to the route handler in order, and
+// flushes it once the recording is exhausted.
+func Replay(logger lager.Logger, reader *Reader, routeHandler watcher.RouteHandler) error {
+	logger = logger.Session("replay")
+	defer routeHandler.Flush(logger)
+
+	for {
+		entry, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		logger.Debug("replaying", lager.Data{"type": entry.Type, "time": entry.Time})
+		switch entry.Type {
+		case EntryTypeEvent:
+			routeHandler.HandleEvent(logger, entry.Event)
+		case EntryTypeSync:
+			routeHandler.Sync(logger, entry.DesiredLRPs, entry.ActualLRPs, entry.Domains, entry.CachedEvents)
+		case EntryTypeRefreshDesired:
+			routeHandler.RefreshDesired(logger, entry.DesiredLRPs)
+		default:
+			logger.Info("skipping-unknown-entry", lager.Data{"type": entry.Type})
+		}
+	}
+}
@@ -0,0 +1 @@
+package recording // import "code.cloudfoundry.org/route-emitter/recording"
@@ -0,0 +1,237 @@
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock"
+	"github.com/gogo/protobuf/proto"
+)
+
+type EntryType string
+
+const (
+	EntryTypeEvent          EntryType = "event"
+	EntryTypeSync           EntryType = "sync"
+	EntryTypeRefreshDesired EntryType = "refresh_desired"
+)
+
+// Entry is one call to the route handler. Only the fields of its type are set.
+type Entry struct {
+	Time time.Time
+	Type EntryType
+
+	// Event is set for events
+	Event models.Event
+
+	// DesiredLRPs are set for syncs and refreshes
+	DesiredLRPs []*models.DesiredLRP
+
+	// ActualLRPs, Domains and CachedEvents are set for syncs
+	ActualLRPs   []*models.ActualLRP
+	Domains      models.DomainSet
+	CachedEvents map[string]models.Event
+}
+
+// rawEntry is the JSON form of an Entry, LRPs and events are encoded with
+// protobuf so that they are read back exactly as the BBS sent them.
+type rawEntry struct {
+	Time         time.Time  `json:"time"`
+	Type         EntryType  `json:"type"`
+	Event        *rawEvent  `json:"event,omitempty"`
+	DesiredLRPs  [][]byte   `json:"desired_lrps,omitempty"`
+	ActualLRPs   [][]byte   `json:"actual_lrps,omitempty"`
+	Domains      []string   `json:"domains,omitempty"`
+	CachedEvents []rawEvent `json:"cached_events,omitempty"`
+}
+
+type rawEvent struct {
+	Type    string `json:"type"`
+	Payload []byte `json:"payload"`
+}
+
+var eventTypes = map[string]func() models.Event{}
+
+func init() {
+	for _, newEvent := range []func() models.Event{
+		func() models.Event { return &models.DesiredLRPCreatedEvent{} },
+		func() models.Event { return &models.DesiredLRPChangedEvent{} },
+		func() models.Event { return &models.DesiredLRPRemovedEvent{} },
+		func() models.Event { return &models.ActualLRPInstanceCreatedEvent{} },
+		func() models.Event { return &models.ActualLRPInstanceChangedEvent{} },
+		func() models.Event { return &models.ActualLRPInstanceRemovedEvent{} },
+	} {
+		eventTypes[newEvent().EventType()] = newEvent
+	}
+}
+
+// Recorder writes entries to a newline-delimited JSON stream. It is safe for
+// concurrent use.
+type Recorder struct {
+	lock    sync.Mutex
+	clock   clock.Clock
+	encoder *json.Encoder
+}
+
+func NewRecorder(clock clock.Clock, w io.Writer) *Recorder {
+	return &Recorder{
+		clock:   clock,
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// Record writes the entry, it is timestamped with the current time unless it
+// already has one.
+func (r *Recorder) Record(entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = r.clock.Now()
+	}
+
+	raw, err := encodeEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.encoder.Encode(raw)
+}
+
+// Reader reads the entries written by a Recorder.
+type Reader struct {
+	decoder *json.Decoder
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{decoder: json.NewDecoder(r)}
+}
+
+// Next returns the next entry, or io.EOF at the end of the recording.
+func (r *Reader) Next() (Entry, error) {
+	var raw rawEntry
+	err := r.decoder.Decode(&raw)
+	if err != nil {
+		return Entry{}, err
+	}
+	return decodeEntry(raw)
+}
+
+func encodeEntry(entry Entry) (rawEntry, error) {
+	raw := rawEntry{
+		Time: entry.Time,
+		Type: entry.Type,
+	}
+
+	if entry.Event != nil {
+		event, err := encodeEvent(entry.Event)
+		if err != nil {
+			return rawEntry{}, err
+		}
+		raw.Event = &event
+	}
+
+	for _, lrp := range entry.DesiredLRPs {
+		payload, err := proto.Marshal(lrp)
+		if err != nil {
+			return rawEntry{}, err
+		}
+		raw.DesiredLRPs = append(raw.DesiredLRPs, payload)
+	}
+
+	for _, lrp := range entry.ActualLRPs {
+		payload, err := proto.Marshal(lrp)
+		if err != nil {
+			return rawEntry{}, err
+		}
+		raw.ActualLRPs = append(raw.ActualLRPs, payload)
+	}
+
+	for domain := range entry.Domains {
+		raw.Domains = append(raw.Domains, domain)
+	}
+
+	for _, cachedEvent := range entry.CachedEvents {
+		event, err := encodeEvent(cachedEvent)
+		if err != nil {
+			return rawEntry{}, err
+		}
+		raw.CachedEvents = append(raw.CachedEvents, event)
+	}
+
+	return raw, nil
+}
+
+func decodeEntry(raw rawEntry) (Entry, error) {
+	entry := Entry{
+		Time: raw.Time,
+		Type: raw.Type,
+	}
+
+	if raw.Event != nil {
+		event, err := decodeEvent(*raw.Event)
+		if err != nil {
+			return Entry{}, err
+		}
+		entry.Event = event
+	}
+
+	for _, payload := range raw.DesiredLRPs {
+		lrp := &models.DesiredLRP{}
+		err := proto.Unmarshal(payload, lrp)
+		if err != nil {
+			return Entry{}, err
+		}
+		entry.DesiredLRPs = append(entry.DesiredLRPs, lrp)
+	}
+
+	for _, payload := range raw.ActualLRPs {
+		lrp := &models.ActualLRP{}
+		err := proto.Unmarshal(payload, lrp)
+		if err != nil {
+			return Entry{}, err
+		}
+		entry.ActualLRPs = append(entry.ActualLRPs, lrp)
+	}
+
+	if raw.Type != EntryTypeSync {
+		return entry, nil
+	}
+
+	entry.Domains = models.NewDomainSet(raw.Domains)
+	entry.CachedEvents = map[string]models.Event{}
+	for _, rawEvent := range raw.CachedEvents {
+		event, err := decodeEvent(rawEvent)
+		if err != nil {
+			return Entry{}, err
+		}
+		entry.CachedEvents[event.Key()] = event
+	}
+
+	return entry, nil
+}
+
+func encodeEvent(event models.Event) (rawEvent, error) {
+	payload, err := proto.Marshal(event)
+	if err != nil {
+		return rawEvent{}, err
+	}
+	return rawEvent{Type: event.EventType(), Payload: payload}, nil
+}
+
+func decodeEvent(raw rawEvent) (models.Event, error) {
+	newEvent, ok := eventTypes[raw.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown event type %q", raw.Type)
+	}
+
+	event := newEvent()
+	err := proto.Unmarshal(raw.Payload, event)
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
@@ -0,0 +1,145 @@
+package recording_test
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/route-emitter/recording"
+	"code.cloudfoundry.org/route-emitter/watcher/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Recording", func() {
+	var (
+		logger       *lagertest.TestLogger
+		clock        *fakeclock.FakeClock
+		buffer       *bytes.Buffer
+		routeHandler *fakes.FakeRouteHandler
+		handler      *recording.Handler
+
+		desiredLRP *models.DesiredLRP
+		actualLRP  *models.ActualLRP
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("recording")
+		clock = fakeclock.NewFakeClock(time.Unix(1000, 0).UTC())
+		buffer = &bytes.Buffer{}
+		routeHandler = &fakes.FakeRouteHandler{}
+		handler = recording.NewHandler(routeHandler, recording.NewRecorder(clock, buffer))
+
+		desiredLRP = &models.DesiredLRP{
+			ProcessGuid: "process-guid",
+			Domain:      "domain",
+			Instances:   1,
+		}
+		actualLRP = &models.ActualLRP{
+			ActualLRPKey:         models.NewActualLRPKey("process-guid", 0, "domain"),
+			ActualLRPInstanceKey: models.NewActualLRPInstanceKey("instance-guid", "cell-id"),
+			State:                models.ActualLRPStateRunning,
+		}
+	})
+
+	readAll := func() []recording.Entry {
+		reader := recording.NewReader(bytes.NewReader(buffer.Bytes()))
+		entries := []recording.Entry{}
+		for {
+			entry, err := reader.Next()
+			if err == io.EOF {
+				return entries
+			}
+			Expect(err).NotTo(HaveOccurred())
+			entries = append(entries, entry)
+		}
+	}
+
+	It("passes calls on to the route handler", func() {
+		event := models.NewDesiredLRPCreatedEvent(desiredLRP)
+		handler.HandleEvent(logger, event)
+		Expect(routeHandler.HandleEventCallCount()).To(Equal(1))
+		_, handledEvent := routeHandler.HandleEventArgsForCall(0)
+		Expect(handledEvent).To(Equal(event))
+
+		handler.EmitExternal(logger)
+		Expect(routeHandler.EmitExternalCallCount()).To(Equal(1))
+	})
+
+	It("records events", func() {
+		handler.HandleEvent(logger, models.NewDesiredLRPCreatedEvent(desiredLRP))
+		clock.Increment(time.Second)
+		handler.HandleEvent(logger, models.NewActualLRPInstanceCreatedEvent(actualLRP))
+
+		entries := readAll()
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Type).To(Equal(recording.EntryTypeEvent))
+		Expect(entries[0].Time).To(BeTemporally("==", time.Unix(1000, 0)))
+		Expect(entries[0].Event).To(Equal(models.NewDesiredLRPCreatedEvent(desiredLRP)))
+		Expect(entries[1].Time).To(BeTemporally("==", time.Unix(1001, 0)))
+		Expect(entries[1].Event).To(Equal(models.NewActualLRPInstanceCreatedEvent(actualLRP)))
+	})
+
+	It("records sync snapshots", func() {
+		cachedEvent := models.NewActualLRPInstanceRemovedEvent(actualLRP)
+		handler.Sync(logger,
+			[]*models.DesiredLRP{desiredLRP},
+			[]*models.ActualLRP{actualLRP},
+			models.NewDomainSet([]string{"domain"}),
+			map[string]models.Event{cachedEvent.Key(): cachedEvent},
+		)
+		Expect(routeHandler.SyncCallCount()).To(Equal(1))
+
+		entries := readAll()
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Type).To(Equal(recording.EntryTypeSync))
+		Expect(entries[0].DesiredLRPs).To(Equal([]*models.DesiredLRP{desiredLRP}))
+		Expect(entries[0].ActualLRPs).To(Equal([]*models.ActualLRP{actualLRP}))
+		Expect(entries[0].Domains).To(Equal(models.NewDomainSet([]string{"domain"})))
+		Expect(entries[0].CachedEvents).To(Equal(map[string]models.Event{cachedEvent.Key(): cachedEvent}))
+	})
+
+	Describe("Replay", func() {
+		BeforeEach(func() {
+			handler.Sync(logger, []*models.DesiredLRP{desiredLRP}, nil, models.NewDomainSet([]string{"domain"}), nil)
+			handler.RefreshDesired(logger, []*models.DesiredLRP{desiredLRP})
+			handler.HandleEvent(logger, models.NewActualLRPInstanceCreatedEvent(actualLRP))
+		})
+
+		It("passes the recorded calls to the route handler in order", func() {
+			calls := []string{}
+			replayHandler := &fakes.FakeRouteHandler{}
+			replayHandler.SyncStub = func(lager.Logger, []*models.DesiredLRP, []*models.ActualLRP, models.DomainSet, map[string]models.Event) {
+				calls = append(calls, "sync")
+			}
+			replayHandler.RefreshDesiredStub = func(lager.Logger, []*models.DesiredLRP) {
+				calls = append(calls, "refresh-desired")
+			}
+			replayHandler.HandleEventStub = func(lager.Logger, models.Event) {
+				calls = append(calls, "handle-event")
+			}
+
+			err := recording.Replay(logger, recording.NewReader(bytes.NewReader(buffer.Bytes())), replayHandler)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(replayHandler.SyncCallCount()).To(Equal(1))
+			_, desired, _, domains, _ := replayHandler.SyncArgsForCall(0)
+			Expect(desired).To(Equal([]*models.DesiredLRP{desiredLRP}))
+			Expect(domains).To(Equal(models.NewDomainSet([]string{"domain"})))
+
+			Expect(replayHandler.FlushCallCount()).To(Equal(1))
+			Expect(calls).To(Equal([]string{"sync", "refresh-desired", "handle-event"}))
+		})
+
+		It("fails on a corrupt recording", func() {
+			buffer.WriteString(`{"type":"event","event":{"type":"unknown","payload":""}}` + "\n")
+			err := recording.Replay(logger, recording.NewReader(bytes.NewReader(buffer.Bytes())), &fakes.FakeRouteHandler{})
+			Expect(err).To(MatchError(ContainSubstring("unknown event type")))
+		})
+	})
+})
@@ -0,0 +1,59 @@
+package routehandlers
+
+import (
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+)
+
+// syncDrift counts the registry messages of a sync that were not caused by
+// the events cached while syncing. These are the changes that the handled
+// events had missed.
+func syncDrift(messages routingtable.MessagesToEmit, cachedEvents map[string]models.Event) (registrations, unregistrations int) {
+	instanceGuids := map[string]struct{}{}
+	logGuids := map[string]struct{}{}
+	for _, event := range cachedEvents {
+		switch event := event.(type) {
+		case *models.DesiredLRPCreatedEvent:
+			addLogGuid(logGuids, event.DesiredLrp)
+		case *models.DesiredLRPChangedEvent:
+			addLogGuid(logGuids, event.Before)
+			addLogGuid(logGuids, event.After)
+		case *models.DesiredLRPRemovedEvent:
+			addLogGuid(logGuids, event.DesiredLrp)
+		case *models.ActualLRPInstanceCreatedEvent:
+			if event.ActualLrp != nil {
+				instanceGuids[event.ActualLrp.InstanceGuid] = struct{}{}
+			}
+		case *models.ActualLRPInstanceChangedEvent:
+			instanceGuids[event.ActualLRPInstanceKey.InstanceGuid] = struct{}{}
+		case *models.ActualLRPInstanceRemovedEvent:
+			if event.ActualLrp != nil {
+				instanceGuids[event.ActualLrp.InstanceGuid] = struct{}{}
+			}
+		}
+	}
+
+	count := func(messages []routingtable.RegistryMessage) int {
+		drift := 0
+		for _, message := range messages {
+			if _, ok := instanceGuids[message.PrivateInstanceId]; ok {
+				continue
+			}
+			if _, ok := logGuids[message.App]; ok {
+				continue
+			}
+			drift++
+		}
+		return drift
+	}
+
+	registrations = count(messages.RegistrationMessages) + count(messages.InternalRegistrationMessages)
+	unregistrations = count(messages.UnregistrationMessages) + count(messages.InternalUnregistrationMessages)
+	return registrations, unregistrations
+}
+
+func addLogGuid(logGuids map[string]struct{}, desiredLRP *models.DesiredLRP) {
+	if desiredLRP != nil {
+		logGuids[desiredLRP.LogGuid] = struct{}{}
+	}
+}
@@ -19,6 +19,11 @@ const (
 	routesUnregisteredCounter = "RoutesUnregistered"
 	httpRouteCount            = "HTTPRouteCount"
 	tcpRouteCount             = "TCPRouteCount"
+
+	routeMessagesCoalescedCounter = "RouteMessagesCoalesced"
+
+	syncDriftRegistrationsCounter   = "SyncDriftRegistrations"
+	syncDriftUnregistrationsCounter = "SyncDriftUnregistrations"
 )
 
 type Handler struct {
@@ -28,6 +33,22 @@ type Handler struct {
 	localMode           bool
 	metronClient        loggingclient.IngressClient
 	unregistrationCache unregistration.Cache
+
+	// internalUnregistrationCache is nil when internal routes are not emitted
+	internalUnregistrationCache unregistration.Cache
+
+	// pending holds the messages that are emitted on the next Flush, it is nil
+	// when messages are emitted as soon as the table changes
+	pending *pendingMessages
+
+	// synced is set after the first sync, whose changes are not drift
+	synced bool
+
+	// emitSlices is the number of slices the external routes are split into,
+	// each EmitExternalSlice emits the next slice. The whole table is emitted
+	// at once when it is 1 or less.
+	emitSlices int
+	emitSlice  int
 }
 
 var _ watcher.RouteHandler = new(Handler)
@@ -39,14 +60,25 @@ func NewHandler(
 	localMode bool,
 	metronClient loggingclient.IngressClient,
 	unregistrationCache unregistration.Cache,
+	internalUnregistrationCache unregistration.Cache,
+	coalesceMessages bool,
+	emitSlices int,
 ) *Handler {
+	var pending *pendingMessages
+	if coalesceMessages {
+		pending = newPendingMessages()
+	}
+
 	return &Handler{
-		routingTable:        routingTable,
-		natsEmitter:         natsEmitter,
-		routingAPIEmitter:   routingAPIEmitter,
-		localMode:           localMode,
-		metronClient:        metronClient,
-		unregistrationCache: unregistrationCache,
+		routingTable:                routingTable,
+		natsEmitter:                 natsEmitter,
+		routingAPIEmitter:           routingAPIEmitter,
+		localMode:                   localMode,
+		metronClient:                metronClient,
+		unregistrationCache:         unregistrationCache,
+		internalUnregistrationCache: internalUnregistrationCache,
+		pending:                     pending,
+		emitSlices:                  emitSlices,
 	}
 }
 
@@ -94,7 +126,24 @@ func (handler *Handler) HandleEvent(logger lager.Logger, event models.Event) {
 
 func (handler *Handler) EmitExternal(logger lager.Logger) {
 	routingEvents, messagesToEmit := handler.routingTable.GetExternalRoutingEvents()
+	handler.emitExternal(logger, routingEvents, messagesToEmit)
+}
+
+// EmitExternalSlice emits the next slice of the external table. It is used for
+// the periodic emits only, the whole table is emitted when it is not split.
+func (handler *Handler) EmitExternalSlice(logger lager.Logger) {
+	if handler.emitSlices <= 1 {
+		handler.EmitExternal(logger)
+		return
+	}
 
+	logger.Debug("emitting-slice", lager.Data{"slice": handler.emitSlice, "slices": handler.emitSlices})
+	routingEvents, messagesToEmit := handler.routingTable.GetExternalRoutingEventsSlice(handler.emitSlice, handler.emitSlices)
+	handler.emitSlice = (handler.emitSlice + 1) % handler.emitSlices
+	handler.emitExternal(logger, routingEvents, messagesToEmit)
+}
+
+func (handler *Handler) emitExternal(logger lager.Logger, routingEvents routingtable.TCPRouteMappings, messagesToEmit routingtable.MessagesToEmit) {
 	logger.Debug("emitting-nats-messages", lager.Data{"messages": messagesToEmit})
 	if handler.natsEmitter != nil {
 		err := handler.natsEmitter.Emit(messagesToEmit)
@@ -133,6 +182,33 @@ func (handler *Handler) EmitInternal(logger lager.Logger) {
 	}
 }
 
+// EmitExternalTo publishes the registrations of the whole external table to
+// the given subject only. It is used to bring a router that just started up to
+// date without emitting the routes to all other routers.
+func (handler *Handler) EmitExternalTo(logger lager.Logger, subject string) {
+	_, messagesToEmit := handler.routingTable.GetExternalRoutingEvents()
+	handler.emitTo(logger, subject, messagesToEmit.RegistrationMessages)
+}
+
+// EmitInternalTo publishes the registrations of the whole internal table to
+// the given subject only.
+func (handler *Handler) EmitInternalTo(logger lager.Logger, subject string) {
+	_, messagesToEmit := handler.routingTable.GetInternalRoutingEvents()
+	handler.emitTo(logger, subject, messagesToEmit.InternalRegistrationMessages)
+}
+
+func (handler *Handler) emitTo(logger lager.Logger, subject string, messages []routingtable.RegistryMessage) {
+	if handler.natsEmitter == nil {
+		return
+	}
+
+	logger.Debug("emitting-nats-messages", lager.Data{"subject": subject, "messages": messages})
+	err := handler.natsEmitter.EmitTo(subject, messages)
+	if err != nil {
+		logger.Error("failed-to-emit-nats-routes", err, lager.Data{"subject": subject})
+	}
+}
+
 func (handler *Handler) Sync(
 	logger lager.Logger,
 	desired []*models.DesiredLRP,
@@ -144,24 +220,17 @@ func (handler *Handler) Sync(
 	logger.Debug("starting")
 	defer logger.Debug("completed")
 
-	nullLogger := lager.NewLogger("null-logger") // ignore log messsages from the routing table
-	newTable := routingtable.NewRoutingTable(false, handler.metronClient)
-
-	for _, lrp := range desired {
-		newTable.SetRoutes(nullLogger, nil, lrp)
-	}
-
-	for _, lrp := range actuals {
-		newTable.AddEndpoint(nullLogger, lrp)
-	}
+	newTable := handler.newTable(desired, actuals)
 
 	natsEmitter := handler.natsEmitter
 	routingAPIEmitter := handler.routingAPIEmitter
 	table := handler.routingTable
+	pending := handler.pending
 
 	handler.natsEmitter = nil
 	handler.routingAPIEmitter = nil
 	handler.routingTable = newTable
+	handler.pending = nil
 
 	for _, event := range cachedEvents {
 		handler.HandleEvent(logger, event)
@@ -170,7 +239,13 @@ func (handler *Handler) Sync(
 	handler.routingTable = table
 	handler.natsEmitter = natsEmitter
 	handler.routingAPIEmitter = routingAPIEmitter
+	handler.pending = pending
+
+	// changes made before the sync are emitted first so that they cannot undo
+	// the changes of the sync
+	handler.Flush(logger)
 
+	nullLogger := lager.NewLogger("null-logger") // ignore log messsages from the routing table
 	routeMappings, messages := handler.routingTable.Swap(nullLogger, newTable, domains)
 	logger.Debug("start-emitting-messages", lager.Data{
 		"num-registration-messages":            len(messages.RegistrationMessages),
@@ -178,15 +253,21 @@ func (handler *Handler) Sync(
 		"num-internal-registration-messages":   len(messages.InternalRegistrationMessages),
 		"num-internal-unregistration-messages": len(messages.InternalUnregistrationMessages),
 	})
-	err := handler.unregistrationCache.Add(messages.UnregistrationMessages)
+	err := handler.cacheUnregistrations(messages)
 	if err != nil {
-		logger.Error("failed-to-add-messages-to-cache", err, lager.Data{"messages": messages.UnregistrationMessages})
+		logger.Error("failed-to-add-messages-to-cache", err, lager.Data{
+			"messages":          messages.UnregistrationMessages,
+			"internal-messages": messages.InternalUnregistrationMessages,
+		})
 	}
-	err = handler.unregistrationCache.Remove(messages.RegistrationMessages)
+	err = handler.uncacheRegistrations(messages)
 	if err != nil {
-		logger.Error("failed-to-remove-messages-from-cache", err, lager.Data{"messages": messages.RegistrationMessages})
+		logger.Error("failed-to-remove-messages-from-cache", err, lager.Data{
+			"messages":          messages.RegistrationMessages,
+			"internal-messages": messages.InternalRegistrationMessages,
+		})
 	}
-	handler.emitMessages(logger, messages, routeMappings)
+	handler.sendMessages(logger, messages, routeMappings)
 	logger.Debug("done-emitting-messages", lager.Data{
 		"num-registration-messages":            len(messages.RegistrationMessages),
 		"num-unregistration-messages":          len(messages.UnregistrationMessages),
@@ -194,6 +275,11 @@ func (handler *Handler) Sync(
 		"num-internal-unregistration-messages": len(messages.InternalUnregistrationMessages),
 	})
 
+	if handler.synced {
+		handler.sendDrift(logger, messages, cachedEvents)
+	}
+	handler.synced = true
+
 	if handler.localMode {
 		err := handler.metronClient.SendMetric(httpRouteCount, handler.routingTable.HTTPAssociationsCount())
 		if err != nil {
@@ -206,6 +292,75 @@ func (handler *Handler) Sync(
 	}
 }
 
+// Flush emits the messages of the table changes since the last flush in one
+// batch. It does nothing unless the handler coalesces messages.
+func (handler *Handler) Flush(logger lager.Logger) {
+	if handler.pending == nil || handler.pending.empty() {
+		return
+	}
+
+	messagesToEmit, routeMappings, coalesced := handler.pending.take()
+	logger.Debug("flushing-coalesced-messages", lager.Data{
+		"num-registration-messages":            len(messagesToEmit.RegistrationMessages),
+		"num-unregistration-messages":          len(messagesToEmit.UnregistrationMessages),
+		"num-internal-registration-messages":   len(messagesToEmit.InternalRegistrationMessages),
+		"num-internal-unregistration-messages": len(messagesToEmit.InternalUnregistrationMessages),
+		"num-coalesced-messages":               coalesced,
+	})
+	handler.sendMessages(logger, messagesToEmit, routeMappings)
+
+	err := handler.metronClient.IncrementCounterWithDelta(routeMessagesCoalescedCounter, uint64(coalesced))
+	if err != nil {
+		logger.Error("failed-to-send-route-messages-coalesced-metric", err)
+	}
+}
+
+// DiffSync returns the messages that syncing with the given LRPs would emit,
+// without changing the routing table or emitting anything.
+func (handler *Handler) DiffSync(
+	logger lager.Logger,
+	desired []*models.DesiredLRP,
+	actuals []*models.ActualLRP,
+	domains models.DomainSet,
+) (routingtable.TCPRouteMappings, routingtable.MessagesToEmit) {
+	logger = logger.Session("diff-sync")
+	return handler.routingTable.Diff(logger, handler.newTable(desired, actuals), domains)
+}
+
+func (handler *Handler) newTable(desired []*models.DesiredLRP, actuals []*models.ActualLRP) routingtable.RoutingTable {
+	nullLogger := lager.NewLogger("null-logger") // ignore log messsages from the routing table
+	newTable := routingtable.NewRoutingTable(false, handler.metronClient)
+
+	for _, lrp := range desired {
+		newTable.SetRoutes(nullLogger, nil, lrp)
+	}
+
+	for _, lrp := range actuals {
+		newTable.AddEndpoint(nullLogger, lrp)
+	}
+
+	return newTable
+}
+
+func (handler *Handler) sendDrift(logger lager.Logger, messages routingtable.MessagesToEmit, cachedEvents map[string]models.Event) {
+	registrations, unregistrations := syncDrift(messages, cachedEvents)
+	if registrations > 0 || unregistrations > 0 {
+		logger.Info("sync-found-drift", lager.Data{
+			"num-registration-messages":   registrations,
+			"num-unregistration-messages": unregistrations,
+		})
+	}
+
+	err := handler.metronClient.IncrementCounterWithDelta(syncDriftRegistrationsCounter, uint64(registrations))
+	if err != nil {
+		logger.Error("failed-to-send-sync-drift-registrations-metric", err)
+	}
+	err = handler.metronClient.IncrementCounterWithDelta(syncDriftUnregistrationsCounter, uint64(unregistrations))
+	if err != nil {
+		logger.Error("failed-to-send-sync-drift-unregistrations-metric", err)
+	}
+}
+
 func (handler *Handler) RefreshDesired(logger lager.Logger, desiredLRPs []*models.DesiredLRP) {
 	for _, desiredLRP := range desiredLRPs {
 		routeMappings, messagesToEmit := handler.routingTable.SetRoutes(logger, nil, desiredLRP)
@@ -224,11 +379,11 @@ func (handler *Handler) handleDesiredCreate(logger lager.Logger, desiredLRP *mod
 
 func (handler *Handler) handleDesiredUpdate(logger lager.Logger, before, after *models.DesiredLRP) error {
 	routeMappings, messagesToEmit := handler.routingTable.SetRoutes(logger, before, after)
-	err := handler.unregistrationCache.Add(messagesToEmit.UnregistrationMessages)
+	err := handler.cacheUnregistrations(messagesToEmit)
 	if err != nil {
 		return err
 	}
-	err = handler.unregistrationCache.Remove(messagesToEmit.RegistrationMessages)
+	err = handler.uncacheRegistrations(messagesToEmit)
 	if err != nil {
 		return err
 	}
@@ -266,7 +421,7 @@ func (handler *Handler) handleActualUpdate(logger lager.Logger, before, after *m
 	case before.State == models.ActualLRPStateRunning && after.State != models.ActualLRPStateRunning:
 		routeMappings, messagesToEmit = handler.routingTable.RemoveEndpoint(logger, before)
 	}
-	err := handler.unregistrationCache.Remove(messagesToEmit.RegistrationMessages)
+	err := handler.uncacheRegistrations(messagesToEmit)
 	if err != nil {
 		return err
 	}
@@ -282,7 +437,41 @@ func (handler *Handler) handleActualDelete(logger lager.Logger, actualLRP *model
 	handler.emitMessages(logger, messagesToEmit, routeMappings)
 }
 
+// cacheUnregistrations adds the unregistrations to the caches so that they are
+// sent repeatedly, in case the first message gets lost.
+func (handler *Handler) cacheUnregistrations(messagesToEmit routingtable.MessagesToEmit) error {
+	err := handler.unregistrationCache.Add(messagesToEmit.UnregistrationMessages)
+	if err != nil {
+		return err
+	}
+	if handler.internalUnregistrationCache != nil {
+		return handler.internalUnregistrationCache.Add(messagesToEmit.InternalUnregistrationMessages)
+	}
+	return nil
+}
+
+// uncacheRegistrations stops repeating unregistrations for routes that are
+// registered again.
+func (handler *Handler) uncacheRegistrations(messagesToEmit routingtable.MessagesToEmit) error {
+	err := handler.unregistrationCache.Remove(messagesToEmit.RegistrationMessages)
+	if err != nil {
+		return err
+	}
+	if handler.internalUnregistrationCache != nil {
+		return handler.internalUnregistrationCache.Remove(messagesToEmit.InternalRegistrationMessages)
+	}
+	return nil
+}
+
 func (handler *Handler) emitMessages(logger lager.Logger, messagesToEmit routingtable.MessagesToEmit, routeMappings routingtable.TCPRouteMappings) {
+	if handler.pending != nil {
+		handler.pending.add(messagesToEmit, routeMappings)
+		return
+	}
+	handler.sendMessages(logger, messagesToEmit, routeMappings)
+}
+
+func (handler *Handler) sendMessages(logger lager.Logger, messagesToEmit routingtable.MessagesToEmit, routeMappings routingtable.TCPRouteMappings) {
 	if handler.natsEmitter != nil {
 		logger.Debug("emit-messages", lager.Data{"messages": messagesToEmit})
 		err := handler.natsEmitter.Emit(messagesToEmit)
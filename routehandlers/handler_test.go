@@ -121,7 +121,7 @@ var _ = Describe("Handler", func() {
 
 		fakeUnregistrationCache = &ufakes.FakeCache{}
 
-		routeHandler = routehandlers.NewHandler(fakeTable, natsEmitter, fakeRoutingAPIEmitter, false, fakeMetronClient, fakeUnregistrationCache)
+		routeHandler = routehandlers.NewHandler(fakeTable, natsEmitter, fakeRoutingAPIEmitter, false, fakeMetronClient, fakeUnregistrationCache, nil, false, 0)
 	})
 
 	Context("when an unrecognized event is received", func() {
@@ -308,6 +308,31 @@ var _ = Describe("Handler", func() {
 				})
 			})
 
+			Context("when messages to emit contain internal unregistrations and registrations", func() {
+				var fakeInternalUnregistrationCache *ufakes.FakeCache
+
+				BeforeEach(func() {
+					fakeInternalUnregistrationCache = &ufakes.FakeCache{}
+					routeHandler = routehandlers.NewHandler(fakeTable, natsEmitter, fakeRoutingAPIEmitter, false, fakeMetronClient, fakeUnregistrationCache, fakeInternalUnregistrationCache, false, 0)
+
+					messagesToEmit := routingtable.MessagesToEmit{
+						InternalUnregistrationMessages: []routingtable.RegistryMessage{dummyMessageFoo, dummyMessageBar},
+						InternalRegistrationMessages:   []routingtable.RegistryMessage{dummyMessageFoo},
+					}
+					fakeTable.SetRoutesReturns(emptyTCPRouteMappings, messagesToEmit)
+				})
+
+				It("adds and removes them from the internal unregistration cache only", func() {
+					Eventually(fakeInternalUnregistrationCache.AddCallCount).Should(Equal(1))
+					Eventually(fakeInternalUnregistrationCache.RemoveCallCount).Should(Equal(1))
+					Expect(fakeInternalUnregistrationCache.AddArgsForCall(0)).Should(ConsistOf(dummyMessageFoo, dummyMessageBar))
+					Expect(fakeInternalUnregistrationCache.RemoveArgsForCall(0)).Should(ConsistOf(dummyMessageFoo))
+
+					Expect(fakeUnregistrationCache.AddArgsForCall(0)).Should(BeEmpty())
+					Expect(fakeUnregistrationCache.RemoveArgsForCall(0)).Should(BeEmpty())
+				})
+			})
+
 			Context("when there are diego ssh-keys on the route", func() {
 				BeforeEach(func() {
 					diegoSSHInfo := json.RawMessage([]byte(`{"ssh-key": "ssh-value"}`))
@@ -1138,7 +1163,7 @@ var _ = Describe("Handler", func() {
 
 			Context("when emitting metrics in localMode", func() {
 				BeforeEach(func() {
-					routeHandler = routehandlers.NewHandler(fakeTable, natsEmitter, nil, true, fakeMetronClient, fakeUnregistrationCache)
+					routeHandler = routehandlers.NewHandler(fakeTable, natsEmitter, nil, true, fakeMetronClient, fakeUnregistrationCache, nil, false, 0)
 					fakeTable.HTTPAssociationsCountReturns(5)
 				})
 
@@ -1205,6 +1230,78 @@ var _ = Describe("Handler", func() {
 		})
 	})
 
+	Describe("sync drift", func() {
+		var cachedEvents map[string]models.Event
+
+		BeforeEach(func() {
+			otherEndpoint := routingtable.Endpoint{
+				InstanceGUID: "other-instance-guid",
+				Host:         "3.3.3.3",
+				Port:         33,
+			}
+			fakeTable.SwapReturns(emptyTCPRouteMappings, routingtable.MessagesToEmit{
+				RegistrationMessages: []routingtable.RegistryMessage{
+					dummyMessageFoo,
+					routingtable.RegistryMessageFor(otherEndpoint, routingtable.Route{Hostname: "foo.com", LogGUID: "other-log-guid"}, true),
+				},
+				UnregistrationMessages: []routingtable.RegistryMessage{dummyMessageBar},
+			})
+
+			actualLRP := &models.ActualLRP{
+				ActualLRPKey:         models.NewActualLRPKey(expectedProcessGuid, expectedIndex, "domain"),
+				ActualLRPInstanceKey: models.NewActualLRPInstanceKey(expectedInstanceGUID, "cell-id"),
+			}
+			event := models.NewActualLRPInstanceRemovedEvent(actualLRP)
+			cachedEvents = map[string]models.Event{event.Key(): event}
+		})
+
+		It("is not reported for the first sync", func() {
+			routeHandler.Sync(logger, nil, nil, nil, cachedEvents)
+			for i := 0; i < fakeMetronClient.IncrementCounterWithDeltaCallCount(); i++ {
+				name, _ := fakeMetronClient.IncrementCounterWithDeltaArgsForCall(i)
+				Expect(name).NotTo(HavePrefix("SyncDrift"))
+			}
+		})
+
+		It("counts the changes that were not caused by cached events", func() {
+			routeHandler.Sync(logger, nil, nil, nil, nil)
+			routeHandler.Sync(logger, nil, nil, nil, cachedEvents)
+
+			Eventually(counterChan).Should(Receive(Equal(counter{
+				name:  "SyncDriftRegistrations",
+				delta: 1,
+			})))
+			Eventually(counterChan).Should(Receive(Equal(counter{
+				name:  "SyncDriftUnregistrations",
+				delta: 0,
+			})))
+			Expect(logger).To(gbytes.Say("sync-found-drift"))
+		})
+	})
+
+	Describe("DiffSync", func() {
+		It("diffs a table of the lrps against the routing table", func() {
+			desiredLRP := &models.DesiredLRP{
+				ProcessGuid: expectedProcessGuid,
+				Domain:      "domain",
+				Instances:   1,
+			}
+			fakeTable.DiffReturns(emptyTCPRouteMappings, dummyMessagesToEmit)
+			domains := models.NewDomainSet([]string{"domain"})
+
+			routeMappings, messages := routeHandler.DiffSync(logger, []*models.DesiredLRP{desiredLRP}, nil, domains)
+			Expect(routeMappings).To(Equal(emptyTCPRouteMappings))
+			Expect(messages).To(Equal(dummyMessagesToEmit))
+
+			Expect(fakeTable.DiffCallCount()).To(Equal(1))
+			_, _, diffDomains := fakeTable.DiffArgsForCall(0)
+			Expect(diffDomains).To(Equal(domains))
+			Expect(fakeTable.SwapCallCount()).To(BeZero())
+			Expect(natsEmitter.EmitCallCount()).To(BeZero())
+			Expect(fakeRoutingAPIEmitter.EmitCallCount()).To(BeZero())
+		})
+	})
+
 	Describe("EmitExternal", func() {
 		var registrationMsgs routingtable.MessagesToEmit
 		BeforeEach(func() {
@@ -1270,6 +1367,57 @@ var _ = Describe("Handler", func() {
 				delta: 3,
 			})))
 		})
+
+		Context("when emits are split into slices", func() {
+			BeforeEach(func() {
+				routeHandler = routehandlers.NewHandler(fakeTable, natsEmitter, fakeRoutingAPIEmitter, false, fakeMetronClient, fakeUnregistrationCache, nil, false, 3)
+				fakeTable.GetExternalRoutingEventsSliceReturns(emptyTCPRouteMappings, registrationMsgs)
+			})
+
+			It("emits the whole table", func() {
+				routeHandler.EmitExternal(logger)
+				Expect(fakeTable.GetExternalRoutingEventsCallCount()).To(Equal(1))
+				Expect(fakeTable.GetExternalRoutingEventsSliceCallCount()).To(BeZero())
+			})
+
+			It("emits the next slice of the table on each periodic emit", func() {
+				for i := 0; i < 4; i++ {
+					routeHandler.EmitExternalSlice(logger)
+				}
+				Expect(fakeTable.GetExternalRoutingEventsCallCount()).To(BeZero())
+				Expect(fakeTable.GetExternalRoutingEventsSliceCallCount()).To(Equal(4))
+				for i, expectedSlice := range []int{0, 1, 2, 0} {
+					slice, slices := fakeTable.GetExternalRoutingEventsSliceArgsForCall(i)
+					Expect(slice).To(Equal(expectedSlice))
+					Expect(slices).To(Equal(3))
+				}
+
+				Expect(natsEmitter.EmitCallCount()).To(Equal(4))
+				Expect(natsEmitter.EmitArgsForCall(0)).To(Equal(registrationMsgs))
+			})
+
+			It("emits the whole table to a single subject", func() {
+				routeHandler.EmitExternalTo(logger, "_INBOX.new-router")
+				Expect(fakeTable.GetExternalRoutingEventsCallCount()).To(Equal(1))
+				Expect(fakeTable.GetExternalRoutingEventsSliceCallCount()).To(BeZero())
+			})
+		})
+
+		Describe("EmitExternalTo", func() {
+			It("emits the registrations to the subject only", func() {
+				routeHandler.EmitExternalTo(logger, "_INBOX.new-router")
+				Expect(natsEmitter.EmitCallCount()).To(BeZero())
+				Expect(natsEmitter.EmitToCallCount()).To(Equal(1))
+				subject, messages := natsEmitter.EmitToArgsForCall(0)
+				Expect(subject).To(Equal("_INBOX.new-router"))
+				Expect(messages).To(Equal(registrationMsgs.RegistrationMessages))
+			})
+
+			It("does not emit to the routing api", func() {
+				routeHandler.EmitExternalTo(logger, "_INBOX.new-router")
+				Expect(fakeRoutingAPIEmitter.EmitCallCount()).To(BeZero())
+			})
+		})
 	})
 
 	Describe("EmitInternal", func() {
@@ -1326,6 +1474,17 @@ var _ = Describe("Handler", func() {
 			Expect(natsEmitter.EmitCallCount()).To(Equal(1))
 			Expect(natsEmitter.EmitArgsForCall(0)).To(Equal(registrationMsgs))
 		})
+
+		Describe("EmitInternalTo", func() {
+			It("emits the internal registrations to the subject only", func() {
+				routeHandler.EmitInternalTo(logger, "_INBOX.new-service-discovery")
+				Expect(natsEmitter.EmitCallCount()).To(BeZero())
+				Expect(natsEmitter.EmitToCallCount()).To(Equal(1))
+				subject, messages := natsEmitter.EmitToArgsForCall(0)
+				Expect(subject).To(Equal("_INBOX.new-service-discovery"))
+				Expect(messages).To(Equal(registrationMsgs.InternalRegistrationMessages))
+			})
+		})
 	})
 
 	Describe("RefreshDesired", func() {
@@ -1358,6 +1517,128 @@ var _ = Describe("Handler", func() {
 		})
 	})
 
+	Describe("Flush", func() {
+		var actualLRP *models.ActualLRP
+
+		BeforeEach(func() {
+			actualLRP = &models.ActualLRP{
+				ActualLRPKey:         models.NewActualLRPKey(expectedProcessGuid, expectedIndex, "domain"),
+				ActualLRPInstanceKey: models.NewActualLRPInstanceKey(expectedInstanceGUID, "cell-id"),
+				ActualLRPNetInfo: models.NewActualLRPNetInfo(
+					expectedHost,
+					expectedInstanceAddress,
+					models.ActualLRPNetInfo_PreferredAddressHost,
+					models.NewPortMapping(expectedExternalPort, expectedContainerPort),
+				),
+				State: models.ActualLRPStateRunning,
+			}
+		})
+
+		Context("when messages are not coalesced", func() {
+			It("emits nothing", func() {
+				fakeTable.AddEndpointReturns(emptyTCPRouteMappings, dummyMessagesToEmit)
+				routeHandler.HandleEvent(logger, models.NewActualLRPInstanceCreatedEvent(actualLRP))
+				Expect(natsEmitter.EmitCallCount()).To(Equal(1))
+
+				routeHandler.Flush(logger)
+				Expect(natsEmitter.EmitCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when messages are coalesced", func() {
+			BeforeEach(func() {
+				routeHandler = routehandlers.NewHandler(fakeTable, natsEmitter, fakeRoutingAPIEmitter, false, fakeMetronClient, fakeUnregistrationCache, nil, true, 0)
+			})
+
+			It("emits the messages of all table changes at once", func() {
+				fakeTable.AddEndpointReturnsOnCall(0, emptyTCPRouteMappings, routingtable.MessagesToEmit{
+					RegistrationMessages: []routingtable.RegistryMessage{dummyMessageFoo},
+				})
+				fakeTable.AddEndpointReturnsOnCall(1, emptyTCPRouteMappings, routingtable.MessagesToEmit{
+					RegistrationMessages: []routingtable.RegistryMessage{dummyMessageBar},
+				})
+				routeHandler.HandleEvent(logger, models.NewActualLRPInstanceCreatedEvent(actualLRP))
+				routeHandler.HandleEvent(logger, models.NewActualLRPInstanceCreatedEvent(actualLRP))
+				Expect(natsEmitter.EmitCallCount()).To(BeZero())
+
+				routeHandler.Flush(logger)
+				Expect(natsEmitter.EmitCallCount()).To(Equal(1))
+				Expect(natsEmitter.EmitArgsForCall(0)).To(Equal(dummyMessagesToEmit))
+
+				routeHandler.Flush(logger)
+				Expect(natsEmitter.EmitCallCount()).To(Equal(1))
+			})
+
+			It("drops registrations that are unregistered again", func() {
+				fakeTable.AddEndpointReturns(emptyTCPRouteMappings, dummyMessagesToEmit)
+				fakeTable.RemoveEndpointReturns(emptyTCPRouteMappings, routingtable.MessagesToEmit{
+					UnregistrationMessages: []routingtable.RegistryMessage{dummyMessageFoo},
+				})
+				routeHandler.HandleEvent(logger, models.NewActualLRPInstanceCreatedEvent(actualLRP))
+				routeHandler.HandleEvent(logger, models.NewActualLRPInstanceRemovedEvent(actualLRP))
+
+				routeHandler.Flush(logger)
+				Expect(natsEmitter.EmitCallCount()).To(Equal(1))
+				Expect(natsEmitter.EmitArgsForCall(0)).To(Equal(routingtable.MessagesToEmit{
+					RegistrationMessages: []routingtable.RegistryMessage{dummyMessageBar},
+				}))
+				Eventually(counterChan).Should(Receive(Equal(counter{
+					name:  "RouteMessagesCoalesced",
+					delta: 2,
+				})))
+			})
+
+			It("keeps the last change of a route", func() {
+				fakeTable.RemoveEndpointReturns(emptyTCPRouteMappings, routingtable.MessagesToEmit{
+					UnregistrationMessages: []routingtable.RegistryMessage{dummyMessageFoo},
+				})
+				fakeTable.AddEndpointReturns(emptyTCPRouteMappings, routingtable.MessagesToEmit{
+					RegistrationMessages: []routingtable.RegistryMessage{dummyMessageFoo},
+				})
+				routeHandler.HandleEvent(logger, models.NewActualLRPInstanceRemovedEvent(actualLRP))
+				routeHandler.HandleEvent(logger, models.NewActualLRPInstanceCreatedEvent(actualLRP))
+
+				routeHandler.Flush(logger)
+				Expect(natsEmitter.EmitArgsForCall(0)).To(Equal(routingtable.MessagesToEmit{
+					RegistrationMessages: []routingtable.RegistryMessage{dummyMessageFoo},
+				}))
+			})
+
+			It("identifies routes like the unregistration cache", func() {
+				changedMessageFoo := dummyMessageFoo
+				changedMessageFoo.RouteServiceUrl = "https://rs.example.com"
+				otherPortMessageFoo := dummyMessageFoo
+				otherPortMessageFoo.Port = dummyMessageFoo.Port + 1
+				fakeTable.AddEndpointReturns(emptyTCPRouteMappings, routingtable.MessagesToEmit{
+					RegistrationMessages:   []routingtable.RegistryMessage{changedMessageFoo, otherPortMessageFoo},
+					UnregistrationMessages: []routingtable.RegistryMessage{dummyMessageFoo},
+				})
+				routeHandler.HandleEvent(logger, models.NewActualLRPInstanceCreatedEvent(actualLRP))
+
+				routeHandler.Flush(logger)
+				Expect(natsEmitter.EmitArgsForCall(0)).To(Equal(routingtable.MessagesToEmit{
+					RegistrationMessages: []routingtable.RegistryMessage{changedMessageFoo, otherPortMessageFoo},
+				}))
+			})
+
+			It("emits pending messages before syncing", func() {
+				fakeTable.AddEndpointReturns(emptyTCPRouteMappings, dummyMessagesToEmit)
+				routeHandler.HandleEvent(logger, models.NewActualLRPInstanceCreatedEvent(actualLRP))
+				Expect(natsEmitter.EmitCallCount()).To(BeZero())
+
+				fakeTable.SwapReturns(emptyTCPRouteMappings, routingtable.MessagesToEmit{
+					UnregistrationMessages: []routingtable.RegistryMessage{dummyMessageFoo},
+				})
+				routeHandler.Sync(logger, nil, nil, nil, nil)
+				Expect(natsEmitter.EmitCallCount()).To(Equal(2))
+				Expect(natsEmitter.EmitArgsForCall(0)).To(Equal(dummyMessagesToEmit))
+				Expect(natsEmitter.EmitArgsForCall(1)).To(Equal(routingtable.MessagesToEmit{
+					UnregistrationMessages: []routingtable.RegistryMessage{dummyMessageFoo},
+				}))
+			})
+		})
+	})
+
 	Describe("ShouldRefreshDesired", func() {
 		var (
 			actualLRP *models.ActualLRP
@@ -0,0 +1,126 @@
+package routehandlers
+
+import (
+	"code.cloudfoundry.org/route-emitter/routingtable"
+	"github.com/mitchellh/hashstructure"
+)
+
+// pendingMessages accumulates the messages of several table changes so that
+// they can be emitted as one batch. Only the last change of each registry
+// message is kept, and a registration that is followed by an unregistration
+// is dropped together with it. TCP route mappings are passed on unchanged.
+type pendingMessages struct {
+	external      *registryMessageChanges
+	internal      *registryMessageChanges
+	routeMappings routingtable.TCPRouteMappings
+
+	// received counts the registry messages that were added since the last
+	// flush
+	received int
+}
+
+func newPendingMessages() *pendingMessages {
+	return &pendingMessages{
+		external: newRegistryMessageChanges(),
+		internal: newRegistryMessageChanges(),
+	}
+}
+
+func (p *pendingMessages) add(messagesToEmit routingtable.MessagesToEmit, routeMappings routingtable.TCPRouteMappings) {
+	// a route whose attributes changed is unregistered and registered again in
+	// the same batch, so unregistrations are applied first
+	p.external.add(messagesToEmit.UnregistrationMessages, false)
+	p.external.add(messagesToEmit.RegistrationMessages, true)
+	p.internal.add(messagesToEmit.InternalUnregistrationMessages, false)
+	p.internal.add(messagesToEmit.InternalRegistrationMessages, true)
+	p.routeMappings = p.routeMappings.Merge(routeMappings)
+
+	p.received += len(messagesToEmit.RegistrationMessages) +
+		len(messagesToEmit.UnregistrationMessages) +
+		len(messagesToEmit.InternalRegistrationMessages) +
+		len(messagesToEmit.InternalUnregistrationMessages)
+}
+
+func (p *pendingMessages) empty() bool {
+	return p.received == 0 && len(p.routeMappings.Registrations) == 0 && len(p.routeMappings.Unregistrations) == 0
+}
+
+// take returns the merged messages and the number of registry messages that
+// were coalesced away, and resets the pending messages.
+func (p *pendingMessages) take() (routingtable.MessagesToEmit, routingtable.TCPRouteMappings, int) {
+	var messagesToEmit routingtable.MessagesToEmit
+	messagesToEmit.RegistrationMessages, messagesToEmit.UnregistrationMessages = p.external.messages()
+	messagesToEmit.InternalRegistrationMessages, messagesToEmit.InternalUnregistrationMessages = p.internal.messages()
+	routeMappings := p.routeMappings
+
+	sent := len(messagesToEmit.RegistrationMessages) +
+		len(messagesToEmit.UnregistrationMessages) +
+		len(messagesToEmit.InternalRegistrationMessages) +
+		len(messagesToEmit.InternalUnregistrationMessages)
+	coalesced := p.received - sent
+
+	*p = *newPendingMessages()
+	return messagesToEmit, routeMappings, coalesced
+}
+
+type registryMessageChange struct {
+	// firstRegistered is set if the first change since the last flush was a
+	// registration, i.e. the route was not registered before
+	firstRegistered bool
+	registered      bool
+	message         routingtable.RegistryMessage
+}
+
+// registryMessageChanges keys the changes by the hashstructure hash of the
+// registry message, which is how the unregistration cache identifies messages.
+// Fields tagged hash:"ignore" do not change the key, so a route whose route
+// service or tags changed is coalesced into its last change.
+type registryMessageChanges struct {
+	// order keeps the order in which the messages first changed
+	order   []*registryMessageChange
+	changes map[uint64]*registryMessageChange
+}
+
+func newRegistryMessageChanges() *registryMessageChanges {
+	return &registryMessageChanges{
+		changes: map[uint64]*registryMessageChange{},
+	}
+}
+
+func (c *registryMessageChanges) add(messages []routingtable.RegistryMessage, registered bool) {
+	for _, message := range messages {
+		hash, err := hashstructure.Hash(message, nil)
+		if err != nil {
+			// cannot be coalesced, emit it as is
+			c.order = append(c.order, &registryMessageChange{
+				firstRegistered: registered,
+				registered:      registered,
+				message:         message,
+			})
+			continue
+		}
+
+		change, ok := c.changes[hash]
+		if !ok {
+			change = &registryMessageChange{firstRegistered: registered}
+			c.changes[hash] = change
+			c.order = append(c.order, change)
+		}
+		change.registered = registered
+		change.message = message
+	}
+}
+
+func (c *registryMessageChanges) messages() (registrations, unregistrations []routingtable.RegistryMessage) {
+	for _, change := range c.order {
+		switch {
+		case change.registered:
+			registrations = append(registrations, change.message)
+		case change.firstRegistered:
+			// registered and unregistered again before it was emitted
+		default:
+			unregistrations = append(unregistrations, change.message)
+		}
+	}
+	return registrations, unregistrations
+}
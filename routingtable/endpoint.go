@@ -2,6 +2,8 @@ package routingtable
 
 import (
 	"fmt"
+	"hash/fnv"
+	"strconv"
 
 	"code.cloudfoundry.org/bbs/models"
 	"code.cloudfoundry.org/lager"
@@ -280,6 +282,17 @@ func NewRoutingKey(processGUID string, containerPort uint32) RoutingKey {
 	}
 }
 
+// Slice returns which of the given number of slices the key hashes into.
+func (key RoutingKey) Slice(slices int) int {
+	if slices <= 1 {
+		return 0
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(key.ProcessGUID))
+	hash.Write([]byte(strconv.FormatUint(uint64(key.ContainerPort), 10)))
+	return int(hash.Sum32() % uint32(slices))
+}
+
 func (e ExternalEndpointInfos) ContainsExternalPort(port uint32) bool {
 	for _, existing := range e {
 		if existing.Port == port {
@@ -24,6 +24,21 @@ type FakeRoutingTable struct {
 		result1 routingtable.TCPRouteMappings
 		result2 routingtable.MessagesToEmit
 	}
+	DiffStub        func(lager.Logger, routingtable.RoutingTable, models.DomainSet) (routingtable.TCPRouteMappings, routingtable.MessagesToEmit)
+	diffMutex       sync.RWMutex
+	diffArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 routingtable.RoutingTable
+		arg3 models.DomainSet
+	}
+	diffReturns struct {
+		result1 routingtable.TCPRouteMappings
+		result2 routingtable.MessagesToEmit
+	}
+	diffReturnsOnCall map[int]struct {
+		result1 routingtable.TCPRouteMappings
+		result2 routingtable.MessagesToEmit
+	}
 	GetExternalRoutingEventsStub        func() (routingtable.TCPRouteMappings, routingtable.MessagesToEmit)
 	getExternalRoutingEventsMutex       sync.RWMutex
 	getExternalRoutingEventsArgsForCall []struct {
@@ -36,6 +51,20 @@ type FakeRoutingTable struct {
 		result1 routingtable.TCPRouteMappings
 		result2 routingtable.MessagesToEmit
 	}
+	GetExternalRoutingEventsSliceStub        func(int, int) (routingtable.TCPRouteMappings, routingtable.MessagesToEmit)
+	getExternalRoutingEventsSliceMutex       sync.RWMutex
+	getExternalRoutingEventsSliceArgsForCall []struct {
+		arg1 int
+		arg2 int
+	}
+	getExternalRoutingEventsSliceReturns struct {
+		result1 routingtable.TCPRouteMappings
+		result2 routingtable.MessagesToEmit
+	}
+	getExternalRoutingEventsSliceReturnsOnCall map[int]struct {
+		result1 routingtable.TCPRouteMappings
+		result2 routingtable.MessagesToEmit
+	}
 	GetInternalRoutingEventsStub        func() (routingtable.TCPRouteMappings, routingtable.MessagesToEmit)
 	getInternalRoutingEventsMutex       sync.RWMutex
 	getInternalRoutingEventsArgsForCall []struct {
@@ -225,6 +254,71 @@ func (fake *FakeRoutingTable) AddEndpointReturnsOnCall(i int, result1 routingtab
 	}{result1, result2}
 }
 
+func (fake *FakeRoutingTable) Diff(arg1 lager.Logger, arg2 routingtable.RoutingTable, arg3 models.DomainSet) (routingtable.TCPRouteMappings, routingtable.MessagesToEmit) {
+	fake.diffMutex.Lock()
+	ret, specificReturn := fake.diffReturnsOnCall[len(fake.diffArgsForCall)]
+	fake.diffArgsForCall = append(fake.diffArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 routingtable.RoutingTable
+		arg3 models.DomainSet
+	}{arg1, arg2, arg3})
+	fake.recordInvocation("Diff", []interface{}{arg1, arg2, arg3})
+	fake.diffMutex.Unlock()
+	if fake.DiffStub != nil {
+		return fake.DiffStub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.diffReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeRoutingTable) DiffCallCount() int {
+	fake.diffMutex.RLock()
+	defer fake.diffMutex.RUnlock()
+	return len(fake.diffArgsForCall)
+}
+
+func (fake *FakeRoutingTable) DiffCalls(stub func(lager.Logger, routingtable.RoutingTable, models.DomainSet) (routingtable.TCPRouteMappings, routingtable.MessagesToEmit)) {
+	fake.diffMutex.Lock()
+	defer fake.diffMutex.Unlock()
+	fake.DiffStub = stub
+}
+
+func (fake *FakeRoutingTable) DiffArgsForCall(i int) (lager.Logger, routingtable.RoutingTable, models.DomainSet) {
+	fake.diffMutex.RLock()
+	defer fake.diffMutex.RUnlock()
+	argsForCall := fake.diffArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeRoutingTable) DiffReturns(result1 routingtable.TCPRouteMappings, result2 routingtable.MessagesToEmit) {
+	fake.diffMutex.Lock()
+	defer fake.diffMutex.Unlock()
+	fake.DiffStub = nil
+	fake.diffReturns = struct {
+		result1 routingtable.TCPRouteMappings
+		result2 routingtable.MessagesToEmit
+	}{result1, result2}
+}
+
+func (fake *FakeRoutingTable) DiffReturnsOnCall(i int, result1 routingtable.TCPRouteMappings, result2 routingtable.MessagesToEmit) {
+	fake.diffMutex.Lock()
+	defer fake.diffMutex.Unlock()
+	fake.DiffStub = nil
+	if fake.diffReturnsOnCall == nil {
+		fake.diffReturnsOnCall = make(map[int]struct {
+			result1 routingtable.TCPRouteMappings
+			result2 routingtable.MessagesToEmit
+		})
+	}
+	fake.diffReturnsOnCall[i] = struct {
+		result1 routingtable.TCPRouteMappings
+		result2 routingtable.MessagesToEmit
+	}{result1, result2}
+}
+
 func (fake *FakeRoutingTable) GetExternalRoutingEvents() (routingtable.TCPRouteMappings, routingtable.MessagesToEmit) {
 	fake.getExternalRoutingEventsMutex.Lock()
 	ret, specificReturn := fake.getExternalRoutingEventsReturnsOnCall[len(fake.getExternalRoutingEventsArgsForCall)]
@@ -280,6 +374,70 @@ func (fake *FakeRoutingTable) GetExternalRoutingEventsReturnsOnCall(i int, resul
 	}{result1, result2}
 }
 
+func (fake *FakeRoutingTable) GetExternalRoutingEventsSlice(arg1 int, arg2 int) (routingtable.TCPRouteMappings, routingtable.MessagesToEmit) {
+	fake.getExternalRoutingEventsSliceMutex.Lock()
+	ret, specificReturn := fake.getExternalRoutingEventsSliceReturnsOnCall[len(fake.getExternalRoutingEventsSliceArgsForCall)]
+	fake.getExternalRoutingEventsSliceArgsForCall = append(fake.getExternalRoutingEventsSliceArgsForCall, struct {
+		arg1 int
+		arg2 int
+	}{arg1, arg2})
+	fake.recordInvocation("GetExternalRoutingEventsSlice", []interface{}{arg1, arg2})
+	fake.getExternalRoutingEventsSliceMutex.Unlock()
+	if fake.GetExternalRoutingEventsSliceStub != nil {
+		return fake.GetExternalRoutingEventsSliceStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getExternalRoutingEventsSliceReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeRoutingTable) GetExternalRoutingEventsSliceCallCount() int {
+	fake.getExternalRoutingEventsSliceMutex.RLock()
+	defer fake.getExternalRoutingEventsSliceMutex.RUnlock()
+	return len(fake.getExternalRoutingEventsSliceArgsForCall)
+}
+
+func (fake *FakeRoutingTable) GetExternalRoutingEventsSliceCalls(stub func(int, int) (routingtable.TCPRouteMappings, routingtable.MessagesToEmit)) {
+	fake.getExternalRoutingEventsSliceMutex.Lock()
+	defer fake.getExternalRoutingEventsSliceMutex.Unlock()
+	fake.GetExternalRoutingEventsSliceStub = stub
+}
+
+func (fake *FakeRoutingTable) GetExternalRoutingEventsSliceArgsForCall(i int) (int, int) {
+	fake.getExternalRoutingEventsSliceMutex.RLock()
+	defer fake.getExternalRoutingEventsSliceMutex.RUnlock()
+	argsForCall := fake.getExternalRoutingEventsSliceArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeRoutingTable) GetExternalRoutingEventsSliceReturns(result1 routingtable.TCPRouteMappings, result2 routingtable.MessagesToEmit) {
+	fake.getExternalRoutingEventsSliceMutex.Lock()
+	defer fake.getExternalRoutingEventsSliceMutex.Unlock()
+	fake.GetExternalRoutingEventsSliceStub = nil
+	fake.getExternalRoutingEventsSliceReturns = struct {
+		result1 routingtable.TCPRouteMappings
+		result2 routingtable.MessagesToEmit
+	}{result1, result2}
+}
+
+func (fake *FakeRoutingTable) GetExternalRoutingEventsSliceReturnsOnCall(i int, result1 routingtable.TCPRouteMappings, result2 routingtable.MessagesToEmit) {
+	fake.getExternalRoutingEventsSliceMutex.Lock()
+	defer fake.getExternalRoutingEventsSliceMutex.Unlock()
+	fake.GetExternalRoutingEventsSliceStub = nil
+	if fake.getExternalRoutingEventsSliceReturnsOnCall == nil {
+		fake.getExternalRoutingEventsSliceReturnsOnCall = make(map[int]struct {
+			result1 routingtable.TCPRouteMappings
+			result2 routingtable.MessagesToEmit
+		})
+	}
+	fake.getExternalRoutingEventsSliceReturnsOnCall[i] = struct {
+		result1 routingtable.TCPRouteMappings
+		result2 routingtable.MessagesToEmit
+	}{result1, result2}
+}
+
 func (fake *FakeRoutingTable) GetInternalRoutingEvents() (routingtable.TCPRouteMappings, routingtable.MessagesToEmit) {
 	fake.getInternalRoutingEventsMutex.Lock()
 	ret, specificReturn := fake.getInternalRoutingEventsReturnsOnCall[len(fake.getInternalRoutingEventsArgsForCall)]
@@ -866,8 +1024,12 @@ func (fake *FakeRoutingTable) Invocations() map[string][][]interface{} {
 	defer fake.invocationsMutex.RUnlock()
 	fake.addEndpointMutex.RLock()
 	defer fake.addEndpointMutex.RUnlock()
+	fake.diffMutex.RLock()
+	defer fake.diffMutex.RUnlock()
 	fake.getExternalRoutingEventsMutex.RLock()
 	defer fake.getExternalRoutingEventsMutex.RUnlock()
+	fake.getExternalRoutingEventsSliceMutex.RLock()
+	defer fake.getExternalRoutingEventsSliceMutex.RUnlock()
 	fake.getInternalRoutingEventsMutex.RLock()
 	defer fake.getInternalRoutingEventsMutex.RUnlock()
 	fake.hTTPAssociationsCountMutex.RLock()
@@ -2,7 +2,9 @@ package routingtable_test
 
 import (
 	"fmt"
+	"time"
 
+	"code.cloudfoundry.org/clock/fakeclock"
 	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
 
 	"code.cloudfoundry.org/bbs/models"
@@ -280,6 +282,89 @@ var _ = Describe("RoutingTable", func() {
 	})
 
 	Describe("Swap", func() {
+		Context("when a domain stays stale", func() {
+			var (
+				clock        *fakeclock.FakeClock
+				swapUnfresh  func()
+				maxStaleness time.Duration
+			)
+
+			BeforeEach(func() {
+				clock = fakeclock.NewFakeClock(time.Now())
+				maxStaleness = time.Hour
+			})
+
+			JustBeforeEach(func() {
+				table = routingtable.NewRoutingTableWithStaleDomainCutoff(logger, false, fakeMetronClient, clock, maxStaleness)
+
+				tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+				desiredLRP := createDesiredLRP(key.ProcessGUID, int32(3), key.ContainerPort, logGuid, "", *currentTag, models.DesiredLRPRunInfo{}, hostname1)
+				tempTable.SetRoutes(logger, nil, desiredLRP)
+				tempTable.AddEndpoint(logger, createActualLRP(key, endpoint1, domain))
+				table.Swap(logger, tempTable, domains)
+
+				// the desired lrp is missing, but its domain is not fresh
+				swapUnfresh = func() {
+					tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+					tempTable.AddEndpoint(logger, createActualLRP(key, endpoint1, domain))
+					_, messagesToEmit = table.Swap(logger, tempTable, noFreshDomains)
+				}
+			})
+
+			It("keeps the routes and reports for how long the domain has been stale", func() {
+				swapUnfresh()
+				clock.Increment(30 * time.Minute)
+				swapUnfresh()
+				Expect(messagesToEmit.UnregistrationMessages).To(BeEmpty())
+
+				Expect(fakeMetronClient.SendDurationCallCount()).To(Equal(2))
+				name, duration, _ := fakeMetronClient.SendDurationArgsForCall(1)
+				Expect(name).To(Equal("StaleDomainDuration"))
+				Expect(duration).To(Equal(30 * time.Minute))
+
+				name, value, _ := fakeMetronClient.SendMetricArgsForCall(fakeMetronClient.SendMetricCallCount() - 1)
+				Expect(name).To(Equal("StaleDomains"))
+				Expect(value).To(Equal(1))
+			})
+
+			It("prunes the routes once the domain has been stale for too long", func() {
+				swapUnfresh()
+				clock.Increment(time.Hour)
+				swapUnfresh()
+
+				expected := []routingtable.RegistryMessage{
+					routingtable.RegistryMessageFor(endpoint1, routingtable.Route{Hostname: hostname1, LogGUID: logGuid}, false),
+				}
+				Expect(messagesToEmit.UnregistrationMessages).To(Equal(expected))
+				Expect(logger).To(Say("pruning-routes-of-stale-domain"))
+
+				Expect(fakeMetronClient.IncrementCounterCallCount()).To(Equal(1))
+				Expect(fakeMetronClient.IncrementCounterArgsForCall(0)).To(Equal("StaleDomainsPruned"))
+			})
+
+			It("forgets the domain once it is fresh again", func() {
+				swapUnfresh()
+				_, messagesToEmit = table.Swap(logger, routingtable.NewRoutingTable(false, fakeMetronClient), domains)
+
+				name, value, _ := fakeMetronClient.SendMetricArgsForCall(fakeMetronClient.SendMetricCallCount() - 1)
+				Expect(name).To(Equal("StaleDomains"))
+				Expect(value).To(Equal(0))
+			})
+
+			Context("when there is no maximum staleness", func() {
+				BeforeEach(func() {
+					maxStaleness = 0
+				})
+
+				It("keeps the routes forever", func() {
+					swapUnfresh()
+					clock.Increment(24 * time.Hour)
+					swapUnfresh()
+					Expect(messagesToEmit.UnregistrationMessages).To(BeEmpty())
+				})
+			})
+		})
+
 		Context("when we have existing stuff in the table and an unfresh domain", func() {
 			BeforeEach(func() {
 				tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
@@ -98,8 +98,13 @@ func InternalEndpointRegistryMessageFor(endpoint Endpoint, route InternalRoute,
 }
 
 type ExternalServiceGreetingMessage struct {
-	MinimumRegisterInterval int `json:"minimumRegisterIntervalInSeconds"`
-	PruneThresholdInSeconds int `json:"pruneThresholdInSeconds"`
+	ID                      string   `json:"id,omitempty"`
+	Hosts                   []string `json:"hosts,omitempty"`
+	MinimumRegisterInterval int      `json:"minimumRegisterIntervalInSeconds"`
+	PruneThresholdInSeconds int      `json:"pruneThresholdInSeconds"`
+	// Inbox is the subject a starting router wants the whole routing table
+	// published to, instead of having it broadcast to all routers
+	Inbox string `json:"inbox,omitempty"`
 }
 
 func populateMetricTags(input map[string]*models.MetricTagValue, endpoint Endpoint) map[string]string {
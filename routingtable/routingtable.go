@@ -2,8 +2,10 @@ package routingtable
 
 import (
 	"sync"
+	"time"
 
 	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/clock"
 	loggingclient "code.cloudfoundry.org/diego-logging-client"
 	"code.cloudfoundry.org/lager"
 	tcpmodels "code.cloudfoundry.org/routing-api/models"
@@ -34,8 +36,14 @@ type RoutingTable interface {
 	AddEndpoint(logger lager.Logger, actualLRP *models.ActualLRP) (TCPRouteMappings, MessagesToEmit)
 	RemoveEndpoint(logger lager.Logger, actualLRP *models.ActualLRP) (TCPRouteMappings, MessagesToEmit)
 	Swap(logger lager.Logger, t RoutingTable, domains models.DomainSet) (TCPRouteMappings, MessagesToEmit)
+	// Diff returns the messages that swapping with t would emit, without
+	// changing either table
+	Diff(logger lager.Logger, t RoutingTable, domains models.DomainSet) (TCPRouteMappings, MessagesToEmit)
 	GetInternalRoutingEvents() (TCPRouteMappings, MessagesToEmit)
 	GetExternalRoutingEvents() (TCPRouteMappings, MessagesToEmit)
+	// GetExternalRoutingEventsSlice returns the external routes of the routing
+	// keys that hash into the given slice of the table
+	GetExternalRoutingEventsSlice(slice, slices int) (TCPRouteMappings, MessagesToEmit)
 
 	// routes
 
@@ -62,9 +70,31 @@ type routingTable struct {
 	tcpRoutesRoutingTable      *internalRoutingTable
 	httpRoutesRoutingTable     *internalRoutingTable
 	internalRoutesRoutingTable *internalRoutingTable
+
+	logger             lager.Logger
+	clock              clock.Clock
+	metronClient       loggingclient.IngressClient
+	maxDomainStaleness time.Duration
+	staleDomains       map[string]time.Time
+	prunedDomains      map[string]struct{}
+	staleDomainsLock   sync.Mutex
 }
 
 func NewRoutingTable(directInstanceRoute bool, metronClient loggingclient.IngressClient) RoutingTable {
+	return NewRoutingTableWithStaleDomainCutoff(lager.NewLogger("null-logger"), directInstanceRoute, metronClient, clock.NewClock(), 0)
+}
+
+// NewRoutingTableWithStaleDomainCutoff returns a routing table that stops
+// keeping the routes of a domain that has not been fresh for longer than
+// maxDomainStaleness. A zero maxDomainStaleness keeps them forever. The
+// logger is only used for the stale domain decisions.
+func NewRoutingTableWithStaleDomainCutoff(
+	logger lager.Logger,
+	directInstanceRoute bool,
+	metronClient loggingclient.IngressClient,
+	clock clock.Clock,
+	maxDomainStaleness time.Duration,
+) RoutingTable {
 	addressGenerator := func(endpoint Endpoint) Address {
 		if endpoint.IsDirectInstanceRoute(directInstanceRoute) {
 			return Address{Host: endpoint.ContainerIP, Port: endpoint.ContainerPort}
@@ -109,6 +139,12 @@ func NewRoutingTable(directInstanceRoute bool, metronClient loggingclient.Ingres
 		tcpRoutesRoutingTable:      tcpRoutingTable,
 		httpRoutesRoutingTable:     httpRoutingTable,
 		internalRoutesRoutingTable: internalRoutingTable,
+		logger:                     logger.Session("stale-domains"),
+		clock:                      clock,
+		metronClient:               metronClient,
+		maxDomainStaleness:         maxDomainStaleness,
+		staleDomains:               map[string]time.Time{},
+		prunedDomains:              map[string]struct{}{},
 	}
 }
 
@@ -168,9 +204,29 @@ func (t *routingTable) Swap(logger lager.Logger, other RoutingTable, domains mod
 	logger.Info("starting", lager.Data{"domains": domains})
 	defer logger.Info("finished")
 
-	httpMappings, httpMessages := t.httpRoutesRoutingTable.Swap(table.httpRoutesRoutingTable, domains)
-	tcpMappings, tcpMessages := t.tcpRoutesRoutingTable.Swap(table.tcpRoutesRoutingTable, domains)
-	internalMappings, internalMessages := t.internalRoutesRoutingTable.Swap(table.internalRoutesRoutingTable, domains)
+	freshDomains := t.updateStaleDomains(domains)
+
+	httpMappings, httpMessages := t.httpRoutesRoutingTable.Swap(table.httpRoutesRoutingTable, freshDomains)
+	tcpMappings, tcpMessages := t.tcpRoutesRoutingTable.Swap(table.tcpRoutesRoutingTable, freshDomains)
+	internalMappings, internalMessages := t.internalRoutesRoutingTable.Swap(table.internalRoutesRoutingTable, freshDomains)
+
+	mappings := httpMappings.Merge(tcpMappings).Merge(internalMappings)
+	messages := httpMessages.Merge(tcpMessages).Merge(internalMessages)
+	return mappings, messages
+}
+
+func (t *routingTable) Diff(logger lager.Logger, other RoutingTable, domains models.DomainSet) (TCPRouteMappings, MessagesToEmit) {
+	table, ok := other.(*routingTable)
+	if !ok {
+		logger.Error("failed-to-convert-to-routing-table", nil)
+		return TCPRouteMappings{}, MessagesToEmit{}
+	}
+
+	freshDomains := t.prunedAsFresh(domains)
+
+	httpMappings, httpMessages := t.httpRoutesRoutingTable.Diff(table.httpRoutesRoutingTable, freshDomains)
+	tcpMappings, tcpMessages := t.tcpRoutesRoutingTable.Diff(table.tcpRoutesRoutingTable, freshDomains)
+	internalMappings, internalMessages := t.internalRoutesRoutingTable.Diff(table.internalRoutesRoutingTable, freshDomains)
 
 	mappings := httpMappings.Merge(tcpMappings).Merge(internalMappings)
 	messages := httpMessages.Merge(tcpMessages).Merge(internalMessages)
@@ -186,6 +242,18 @@ func (t *routingTable) GetExternalRoutingEvents() (TCPRouteMappings, MessagesToE
 	return mappings, messages
 }
 
+func (t *routingTable) GetExternalRoutingEventsSlice(slice, slices int) (TCPRouteMappings, MessagesToEmit) {
+	inSlice := func(key RoutingKey) bool {
+		return key.Slice(slices) == slice
+	}
+	httpMappings, httpMessages := t.httpRoutesRoutingTable.getRoutingEvents(inSlice)
+	tcpMappings, tcpMessages := t.tcpRoutesRoutingTable.getRoutingEvents(inSlice)
+
+	mappings := httpMappings.Merge(tcpMappings)
+	messages := httpMessages.Merge(tcpMessages)
+	return mappings, messages
+}
+
 func (t *routingTable) GetInternalRoutingEvents() (TCPRouteMappings, MessagesToEmit) {
 	return t.internalRoutesRoutingTable.GetRoutingEvents()
 }
@@ -341,8 +409,24 @@ func (t *internalRoutingTable) Swap(otherTable *internalRoutingTable, domains mo
 	t.Lock()
 	defer t.Unlock()
 
+	mappings, messagesToEmit := t.diff(otherTable, domains)
+
 	t.addressEntries = otherTable.addressEntries
+	t.entries = otherTable.entries
 
+	return mappings, messagesToEmit
+}
+
+// Diff returns the messages of a swap. It merges the unfresh routes of this
+// table into the other table, but does not change this table.
+func (t *internalRoutingTable) Diff(otherTable *internalRoutingTable, domains models.DomainSet) (TCPRouteMappings, MessagesToEmit) {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.diff(otherTable, domains)
+}
+
+func (t *internalRoutingTable) diff(otherTable *internalRoutingTable, domains models.DomainSet) (TCPRouteMappings, MessagesToEmit) {
 	var messagesToEmit MessagesToEmit
 	var mappings TCPRouteMappings
 
@@ -374,8 +458,6 @@ func (t *internalRoutingTable) Swap(otherTable *internalRoutingTable, domains mo
 		mappings = mappings.Merge(mapping)
 	}
 
-	t.entries = otherTable.entries
-
 	return mappings, messagesToEmit
 }
 
@@ -405,12 +487,19 @@ func mergeUnfreshRoutes(before, after RoutableEndpoints, domains models.DomainSe
 }
 
 func (t *internalRoutingTable) GetRoutingEvents() (TCPRouteMappings, MessagesToEmit) {
+	return t.getRoutingEvents(func(RoutingKey) bool { return true })
+}
+
+func (t *internalRoutingTable) getRoutingEvents(include func(RoutingKey) bool) (TCPRouteMappings, MessagesToEmit) {
 	t.Lock()
 	defer t.Unlock()
 
 	var messagesToEmit MessagesToEmit
 	var mappings TCPRouteMappings
 	for key, route := range t.entries {
+		if !include(key) {
+			continue
+		}
 		mapping, message, _ := t.emitDiffMessages(key, RoutableEndpoints{}, route)
 
 		mappings = mappings.Merge(mapping)
@@ -488,6 +488,38 @@ var _ = Describe("RoutingTable", func() {
 		})
 	})
 
+	Describe("Diff", func() {
+		BeforeEach(func() {
+			routingInfo := createRoutingInfo(key.ContainerPort, []string{hostname1}, []string{}, "", []uint32{}, "")
+			desiredLRP := createDesiredLRPWithRoutes(key.ProcessGUID, 3, routingInfo, logGuid, *currentTag, runInfo)
+			table.SetRoutes(logger, nil, desiredLRP)
+			table.AddEndpoint(logger, createActualLRP(key, endpoint1, domain))
+		})
+
+		It("returns the messages of a swap without changing the table", func() {
+			tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+			_, messagesToEmit = table.Diff(logger, tempTable, freshDomains)
+
+			expected := routingtable.MessagesToEmit{
+				UnregistrationMessages: []routingtable.RegistryMessage{
+					routingtable.InternalAddressRegistryMessageFor(endpoint1, routingtable.Route{Hostname: hostname1, LogGUID: logGuid}, false),
+				},
+			}
+			Expect(messagesToEmit).To(MatchMessagesToEmit(expected))
+
+			_, messagesToEmit = table.GetExternalRoutingEvents()
+			Expect(messagesToEmit.RegistrationMessages).To(ConsistOf(
+				routingtable.InternalAddressRegistryMessageFor(endpoint1, routingtable.Route{Hostname: hostname1, LogGUID: logGuid}, false),
+			))
+		})
+
+		It("does not unregister the routes of unfresh domains", func() {
+			tempTable := routingtable.NewRoutingTable(false, fakeMetronClient)
+			_, messagesToEmit = table.Diff(logger, tempTable, noFreshDomains)
+			Expect(messagesToEmit.UnregistrationMessages).To(BeEmpty())
+		})
+	})
+
 	Describe("Swap", func() {
 		It("preserves the desired LRP domain", func() {
 			By("creating a routing table with a route and endpoint")
@@ -1037,6 +1069,36 @@ var _ = Describe("RoutingTable", func() {
 		})
 	})
 
+	Describe("GetExternalRoutingEventsSlice", func() {
+		BeforeEach(func() {
+			for i := 0; i < 10; i++ {
+				sliceKey := routingtable.RoutingKey{ProcessGUID: fmt.Sprintf("process-guid-%d", i), ContainerPort: 8080}
+				routes := createRoutingInfo(sliceKey.ContainerPort, []string{fmt.Sprintf("host-%d.example.com", i)}, []string{}, "", []uint32{}, "")
+				table.SetRoutes(logger, nil, createDesiredLRPWithRoutes(sliceKey.ProcessGUID, 1, routes, logGuid, *currentTag, runInfo))
+				table.AddEndpoint(logger, createActualLRP(sliceKey, endpoint1, domain))
+			}
+		})
+
+		It("splits the external routes of the table between the slices", func() {
+			_, all := table.GetExternalRoutingEvents()
+			Expect(all.RegistrationMessages).To(HaveLen(10))
+
+			var sliced []routingtable.RegistryMessage
+			for slice := 0; slice < 3; slice++ {
+				_, messagesToEmit = table.GetExternalRoutingEventsSlice(slice, 3)
+				Expect(len(messagesToEmit.RegistrationMessages)).To(BeNumerically("<", 10))
+				sliced = append(sliced, messagesToEmit.RegistrationMessages...)
+			}
+			Expect(sliced).To(ConsistOf(all.RegistrationMessages))
+		})
+
+		It("returns the routes of a key in the same slice every time", func() {
+			_, first := table.GetExternalRoutingEventsSlice(1, 3)
+			_, second := table.GetExternalRoutingEventsSlice(1, 3)
+			Expect(second.RegistrationMessages).To(ConsistOf(first.RegistrationMessages))
+		})
+	})
+
 	Describe("GetExternalRoutingEvents", func() {
 		It("returns an empty array", func() {
 			tcpRouteMappings, messagesToEmit = table.GetExternalRoutingEvents()
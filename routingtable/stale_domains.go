@@ -0,0 +1,125 @@
+package routingtable
+
+import (
+	"errors"
+
+	"code.cloudfoundry.org/bbs/models"
+	loggregator "code.cloudfoundry.org/go-loggregator/v8"
+	"code.cloudfoundry.org/lager"
+)
+
+const (
+	staleDomainsMetric        = "StaleDomains"
+	staleDomainDurationMetric = "StaleDomainDuration"
+	staleDomainsPrunedCounter = "StaleDomainsPruned"
+)
+
+var ErrDomainStaleTooLong = errors.New("domain has been stale for longer than the maximum staleness")
+
+// updateStaleDomains records for how long each domain with routes in the table
+// has not been fresh, and reports it. It returns the fresh domains to swap
+// with, which also contain the domains that have been stale for longer than
+// maxDomainStaleness so that their routes are no longer kept.
+func (t *routingTable) updateStaleDomains(domains models.DomainSet) models.DomainSet {
+	t.staleDomainsLock.Lock()
+	defer t.staleDomainsLock.Unlock()
+
+	now := t.clock.Now()
+
+	referenced := map[string]struct{}{}
+	for _, table := range []*internalRoutingTable{t.httpRoutesRoutingTable, t.tcpRoutesRoutingTable, t.internalRoutesRoutingTable} {
+		for domain := range table.domains() {
+			referenced[domain] = struct{}{}
+		}
+	}
+
+	for domain := range t.staleDomains {
+		if _, ok := referenced[domain]; !ok || domains.Contains(domain) {
+			t.logger.Info("domain-no-longer-stale", lager.Data{"domain": domain, "stale-since": t.staleDomains[domain]})
+			delete(t.staleDomains, domain)
+			delete(t.prunedDomains, domain)
+		}
+	}
+
+	freshDomains := models.DomainSet{}
+	for domain := range domains {
+		freshDomains[domain] = struct{}{}
+	}
+
+	for domain := range referenced {
+		if domains.Contains(domain) {
+			continue
+		}
+
+		staleSince, ok := t.staleDomains[domain]
+		if !ok {
+			staleSince = now
+			t.staleDomains[domain] = now
+			t.logger.Info("domain-became-stale", lager.Data{"domain": domain})
+		}
+
+		staleFor := now.Sub(staleSince)
+		err := t.metronClient.SendDuration(staleDomainDurationMetric, staleFor, loggregator.WithEnvelopeTag("domain", domain))
+		if err != nil {
+			t.logger.Error("failed-to-send-stale-domain-duration-metric", err, lager.Data{"domain": domain})
+		}
+
+		if t.maxDomainStaleness <= 0 || staleFor < t.maxDomainStaleness {
+			continue
+		}
+
+		// treating the domain as fresh drops every route that is not in the
+		// new table
+		freshDomains[domain] = struct{}{}
+		if _, ok := t.prunedDomains[domain]; ok {
+			continue
+		}
+		t.prunedDomains[domain] = struct{}{}
+		t.logger.Error("pruning-routes-of-stale-domain", ErrDomainStaleTooLong, lager.Data{
+			"domain":        domain,
+			"stale-since":   staleSince,
+			"stale-for":     staleFor.String(),
+			"max-staleness": t.maxDomainStaleness.String(),
+		})
+		err = t.metronClient.IncrementCounter(staleDomainsPrunedCounter)
+		if err != nil {
+			t.logger.Error("failed-to-send-stale-domains-pruned-metric", err)
+		}
+	}
+
+	err := t.metronClient.SendMetric(staleDomainsMetric, len(t.staleDomains))
+	if err != nil {
+		t.logger.Error("failed-to-send-stale-domains-metric", err)
+	}
+
+	return freshDomains
+}
+
+// prunedAsFresh returns the domains plus the stale domains whose routes are
+// already being pruned, without updating how long domains have been stale.
+func (t *routingTable) prunedAsFresh(domains models.DomainSet) models.DomainSet {
+	t.staleDomainsLock.Lock()
+	defer t.staleDomainsLock.Unlock()
+
+	freshDomains := models.DomainSet{}
+	for domain := range domains {
+		freshDomains[domain] = struct{}{}
+	}
+	for domain := range t.prunedDomains {
+		freshDomains[domain] = struct{}{}
+	}
+	return freshDomains
+}
+
+func (t *internalRoutingTable) domains() map[string]struct{} {
+	t.Lock()
+	defer t.Unlock()
+
+	domains := map[string]struct{}{}
+	for _, entry := range t.entries {
+		if entry.Domain != "" {
+			domains[entry.Domain] = struct{}{}
+		}
+	}
+	return domains
+}
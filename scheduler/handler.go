@@ -0,0 +1,22 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// NewRoutersHandler returns an http.Handler that lists the routers that
+// greeted the scheduler as JSON.
+func NewRoutersHandler(logger lager.Logger, scheduler *RouteBroadcastScheduler) http.Handler {
+	logger = logger.Session("routers-handler")
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		routers := scheduler.Routers()
+		resp.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(resp).Encode(routers)
+		if err != nil {
+			logger.Error("failed-to-encode-routers", err)
+		}
+	})
+}
@@ -2,12 +2,15 @@ package scheduler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
+	"strings"
 	"time"
 
 	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/route-emitter/diegonats"
 	"code.cloudfoundry.org/route-emitter/routingtable"
@@ -15,31 +18,117 @@ import (
 	uuid "github.com/nu7hatch/gouuid"
 )
 
+const (
+	// routers are stale once they missed this many greetings, and forgotten
+	// once they missed forgetAfterGreetings
+	staleAfterGreetings  = 2
+	forgetAfterGreetings = 10
+
+	// greetIntervalsPerRegisterInterval is used for routers that do not
+	// advertise a prune threshold, it is the ratio the gorouter uses by default
+	greetIntervalsPerRegisterInterval = 6
+
+	// minEmitInterval is the shortest time between the periodic emits, however
+	// many slices the register interval is split into
+	minEmitInterval = 100 * time.Millisecond
+)
+
 type RouteBroadcastScheduler struct {
 	natsClient           diegonats.NATSClient
 	externalServiceName  string
 	clock                clock.Clock
+	metronClient         loggingclient.IngressClient
 	emitCh               chan struct{}
-	externalServiceStart chan time.Duration
+	externalServiceStart chan registerIntervalUpdate
+	routers              *routers
+
+	// emitToCh receives the inboxes of starting routers that get the routes
+	// published to them only, it is nil if the routes are always broadcast
+	emitToCh chan<- string
+
+	routerCountMetric      string
+	staleRouterCountMetric string
+
+	// slices is how many emits are spread across the register interval, the
+	// route handler emits a different slice of the table on each of them.
+	// The periodic emits signal emitSliceCh when it is set, the emits of
+	// starting routers always signal emitCh for the whole table.
+	slices      int
+	emitSliceCh chan struct{}
 
 	logger lager.Logger
 }
 
+// registerIntervalUpdate is sent to the run loop when a router greets the
+// emitter. broadcast is false if the router was already sent the routes.
+type registerIntervalUpdate struct {
+	interval  time.Duration
+	broadcast bool
+}
+
 func NewRouteBroadcastScheduler(
 	clock clock.Clock,
 	natsClient diegonats.NATSClient,
 	logger lager.Logger,
+	metronClient loggingclient.IngressClient,
+	externalServiceName string,
+	emitCh chan struct{},
+) *RouteBroadcastScheduler {
+	return NewSmearedRouteBroadcastScheduler(clock, natsClient, logger, metronClient, externalServiceName, emitCh, nil, 1)
+}
+
+// NewSmearedRouteBroadcastScheduler returns a scheduler that signals the
+// given number of periodic emits on emitSliceCh evenly across each register
+// interval instead of one.
+func NewSmearedRouteBroadcastScheduler(
+	clock clock.Clock,
+	natsClient diegonats.NATSClient,
+	logger lager.Logger,
+	metronClient loggingclient.IngressClient,
+	externalServiceName string,
+	emitCh chan struct{},
+	emitSliceCh chan struct{},
+	slices int,
+) *RouteBroadcastScheduler {
+	return NewTargetedRouteBroadcastScheduler(clock, natsClient, logger, metronClient, externalServiceName, emitCh, emitSliceCh, nil, slices)
+}
+
+// NewTargetedRouteBroadcastScheduler returns a scheduler that sends the inbox
+// of a starting router to emitToCh instead of signalling an emit to all
+// routers. Routers that do not provide an inbox still get the routes
+// broadcast.
+func NewTargetedRouteBroadcastScheduler(
+	clock clock.Clock,
+	natsClient diegonats.NATSClient,
+	logger lager.Logger,
+	metronClient loggingclient.IngressClient,
 	externalServiceName string,
 	emitCh chan struct{},
+	emitSliceCh chan struct{},
+	emitToCh chan<- string,
+	slices int,
 ) *RouteBroadcastScheduler {
+	if slices < 1 {
+		slices = 1
+	}
+
+	metricName := metricName(externalServiceName)
 	return &RouteBroadcastScheduler{
 		natsClient:          natsClient,
 		externalServiceName: externalServiceName,
 
-		clock:  clock,
-		emitCh: emitCh,
+		clock:        clock,
+		metronClient: metronClient,
+		emitCh:       emitCh,
+
+		externalServiceStart: make(chan registerIntervalUpdate),
+		routers:              newRouters(),
+		emitToCh:             emitToCh,
+		slices:               slices,
+		emitSliceCh:          emitSliceCh,
 
-		externalServiceStart: make(chan time.Duration),
+		routerCountMetric:      metricName + "InstanceCount",
+		staleRouterCountMetric: "Stale" + metricName + "InstanceCount",
 
 		logger: logger.Session("route-broadcast-scheduler", lager.Data{"name": externalServiceName}),
 	}
@@ -74,7 +163,8 @@ GREET_LOOP:
 		}
 
 		select {
-		case registerInterval = <-s.externalServiceStart:
+		case update := <-s.externalServiceStart:
+			registerInterval = update.interval
 			s.logger.Info("received-external-service-registry-interval", lager.Data{"interval": registerInterval.String()})
 			break GREET_LOOP
 		case <-retryGreetingTicker.C():
@@ -87,25 +177,57 @@ GREET_LOOP:
 	retryGreetingTicker.Stop()
 
 	// now keep emitting at the desired interval
-	emitTicker := s.clock.NewTicker(registerInterval)
+	emitTicker := s.clock.NewTicker(s.emitInterval(registerInterval))
+
+	// and keep greeting the routers to notice when they disappear
+	greetInterval := s.routers.greetInterval()
+	if greetInterval <= 0 {
+		greetInterval = greetIntervalsPerRegisterInterval * registerInterval
+	}
+	greetTicker := s.clock.NewTicker(greetInterval)
 
 	randSource := rand.New(rand.NewSource(time.Now().UnixNano()))
 	s.logger.Info("for loop")
 	for {
 		select {
-		case registerInterval = <-s.externalServiceStart:
+		case update := <-s.externalServiceStart:
+			registerInterval = update.interval
 			s.logger.Info("received-new-external-service-prune-interval", lager.Data{"interval": registerInterval.String()})
-			jitterInterval := randSource.Int63n(int64(0.2 * float64(registerInterval)))
-			s.clock.Sleep(time.Duration(jitterInterval))
+			if update.broadcast {
+				jitterInterval := randSource.Int63n(int64(0.2 * float64(registerInterval)))
+				s.clock.Sleep(time.Duration(jitterInterval))
+			}
 			emitTicker.Stop()
-			emitTicker = s.clock.NewTicker(registerInterval)
-			s.emit()
+			emitTicker = s.clock.NewTicker(s.emitInterval(registerInterval))
+			if update.broadcast {
+				s.emit()
+			}
 		case <-emitTicker.C():
 			s.logger.Info("emitting-routes")
-			s.emit()
+			s.emitSlice()
+		case <-greetTicker.C():
+			interval := s.expireRouters(greetInterval)
+			if interval > 0 && interval != registerInterval {
+				registerInterval = interval
+				s.logger.Info("register-interval-changed", lager.Data{"interval": registerInterval.String()})
+				emitTicker.Stop()
+				emitTicker = s.clock.NewTicker(s.emitInterval(registerInterval))
+			}
+
+			err := s.greetExternalService(replyUuid.String())
+			if err != nil {
+				s.logger.Error("failed-to-greet-external-service", err)
+			}
+
+			if interval := s.routers.greetInterval(); interval > 0 && interval != greetInterval {
+				greetInterval = interval
+				greetTicker.Stop()
+				greetTicker = s.clock.NewTicker(greetInterval)
+			}
 		case <-signals:
 			s.logger.Info("stopping")
 			emitTicker.Stop()
+			greetTicker.Stop()
 			return nil
 		}
 	}
@@ -113,25 +235,87 @@ GREET_LOOP:
 	return nil
 }
 
+// emitInterval is the time between emits, every slice of the table is
+// emitted once per register interval.
+func (s *RouteBroadcastScheduler) emitInterval(registerInterval time.Duration) time.Duration {
+	interval := registerInterval / time.Duration(s.slices)
+	if interval < minEmitInterval {
+		return minEmitInterval
+	}
+	return interval
+}
+
 func (s *RouteBroadcastScheduler) emit() {
+	s.signal(s.emitCh)
+}
+
+// emitSlice signals a periodic emit, which may emit a slice of the table only.
+func (s *RouteBroadcastScheduler) emitSlice() {
+	if s.emitSliceCh == nil {
+		s.emit()
+		return
+	}
+	s.signal(s.emitSliceCh)
+}
+
+func (s *RouteBroadcastScheduler) signal(ch chan struct{}) {
 	select {
-	case s.emitCh <- struct{}{}:
+	case ch <- struct{}{}:
 	default:
 		s.logger.Debug("emit-already-in-progress")
 	}
 }
 
+// expireRouters marks the routers that stopped answering greetings as stale
+// and returns the register interval of the remaining ones.
+func (s *RouteBroadcastScheduler) expireRouters(greetInterval time.Duration) time.Duration {
+	now := s.clock.Now()
+	stale, registerInterval := s.routers.expire(
+		now.Add(-staleAfterGreetings*greetInterval),
+		now.Add(-forgetAfterGreetings*greetInterval),
+	)
+	for _, router := range stale {
+		s.logger.Info("router-disappeared", lager.Data{"id": router.ID, "hosts": router.Hosts, "last-seen": router.LastSeen})
+	}
+
+	s.sendRouterMetrics()
+	return registerInterval
+}
+
+func (s *RouteBroadcastScheduler) sendRouterMetrics() {
+	active, stale := s.routers.counts()
+	err := s.metronClient.SendMetric(s.routerCountMetric, active)
+	if err != nil {
+		s.logger.Error("failed-to-send-router-count-metric", err)
+	}
+	err = s.metronClient.SendMetric(s.staleRouterCountMetric, stale)
+	if err != nil {
+		s.logger.Error("failed-to-send-stale-router-count-metric", err)
+	}
+}
+
+// Routers returns the routers that greeted the emitter, including the stale
+// ones that were not forgotten yet.
+func (s *RouteBroadcastScheduler) Routers() []Router {
+	return s.routers.list()
+}
+
 func (s *RouteBroadcastScheduler) listenForExternalService(replyUUID string) error {
-	_, err := s.natsClient.Subscribe(fmt.Sprintf("%s.start", s.externalServiceName), s.handleExternalServiceStart)
+	_, err := s.natsClient.Subscribe(fmt.Sprintf("%s.start", s.externalServiceName), func(msg *nats.Msg) {
+		s.handleExternalServiceStart(msg, true)
+	})
 	if err != nil {
 		return err
 	}
 
-	sub, err := s.natsClient.Subscribe(replyUUID, s.handleExternalServiceStart)
+	// replies to the periodic greetings only show that the routers are
+	// still there, so the subscription is kept
+	_, err = s.natsClient.Subscribe(replyUUID, func(msg *nats.Msg) {
+		s.handleExternalServiceStart(msg, false)
+	})
 	if err != nil {
 		return err
 	}
-	sub.AutoUnsubscribe(1)
 
 	return nil
 }
@@ -145,7 +329,11 @@ func (s *RouteBroadcastScheduler) greetExternalService(replyUUID string) error {
 	return nil
 }
 
-func (s *RouteBroadcastScheduler) handleExternalServiceStart(msg *nats.Msg) {
+// handleExternalServiceStart records the greeting of a router. The routes are
+// emitted right away if the router just started, was not seen before or
+// changed the register interval. A router that just started and provided an
+// inbox only gets the routes sent to it, if targeted emits are enabled.
+func (s *RouteBroadcastScheduler) handleExternalServiceStart(msg *nats.Msg, started bool) {
 	var response routingtable.ExternalServiceGreetingMessage
 
 	err := json.Unmarshal(msg.Data, &response)
@@ -156,8 +344,101 @@ func (s *RouteBroadcastScheduler) handleExternalServiceStart(msg *nats.Msg) {
 		return
 	}
 
-	greetInterval := response.MinimumRegisterInterval
-	s.externalServiceStart <- time.Duration(greetInterval) * time.Second
+	registerInterval, err := validateGreeting(s.logger, response)
+	if err != nil {
+		s.logger.Error("received-invalid-external-service-start", err, lager.Data{
+			"payload": msg.Data,
+		})
+		return
+	}
+
+	id := routerID(response)
+	pruneThreshold := time.Duration(response.PruneThresholdInSeconds) * time.Second
+	interval, isNew, intervalChanged := s.routers.seen(id, response.Hosts, registerInterval, pruneThreshold, s.clock.Now())
+	if isNew {
+		s.logger.Info("router-appeared", lager.Data{"id": id, "hosts": response.Hosts})
+		s.sendRouterMetrics()
+	}
+
+	switch {
+	case started && s.emitTo(response.Inbox):
+		if intervalChanged {
+			s.externalServiceStart <- registerIntervalUpdate{interval: interval}
+		}
+	case started || isNew || intervalChanged:
+		s.externalServiceStart <- registerIntervalUpdate{interval: interval, broadcast: true}
+	}
+}
+
+// emitTo asks for the routes to be published to the inbox of a starting
+// router. Only routers that set the inbox field of their greeting opt into
+// targeted emits; the reply subject of a start message is not used. It returns
+// false if the routes have to be broadcast instead, because targeted emits are
+// disabled, the router provided no inbox or too many targeted emits are
+// pending.
+func (s *RouteBroadcastScheduler) emitTo(inbox string) bool {
+	if s.emitToCh == nil {
+		return false
+	}
+	if inbox == "" {
+		s.logger.Info("router-without-inbox-falling-back-to-broadcast")
+		return false
+	}
+
+	select {
+	case s.emitToCh <- inbox:
+		s.logger.Info("emitting-routes-to-router", lager.Data{"inbox": inbox})
+		return true
+	default:
+		s.logger.Info("targeted-emits-pending-falling-back-to-broadcast", lager.Data{"inbox": inbox})
+		return false
+	}
+}
+
+// validateGreeting returns the interval to emit routes at for the greeting of
+// an external service. The interval is clamped to half of the prune
+// threshold, so that routes survive a late or lost emit. If the greeting has
+// no register interval, half of the prune threshold is used.
+func validateGreeting(logger lager.Logger, greeting routingtable.ExternalServiceGreetingMessage) (time.Duration, error) {
+	registerInterval := time.Duration(greeting.MinimumRegisterInterval) * time.Second
+	pruneThreshold := time.Duration(greeting.PruneThresholdInSeconds) * time.Second
+	data := lager.Data{"register-interval": registerInterval.String(), "prune-threshold": pruneThreshold.String()}
+
+	if registerInterval < 0 || pruneThreshold < 0 {
+		return 0, errors.New("negative register interval or prune threshold")
+	}
+
+	if pruneThreshold == 0 {
+		if registerInterval == 0 {
+			return 0, errors.New("no register interval or prune threshold")
+		}
+		logger.Info("external-service-start-without-prune-threshold", data)
+		return registerInterval, nil
+	}
+
+	maxRegisterInterval := pruneThreshold / 2
+	if registerInterval == 0 {
+		logger.Info("external-service-start-without-register-interval", data)
+		return maxRegisterInterval, nil
+	}
+	if registerInterval > maxRegisterInterval {
+		logger.Info("clamping-register-interval", data)
+		return maxRegisterInterval, nil
+	}
+
+	return registerInterval, nil
+}
+
+// metricName turns the name of the external service into the camel case
+// prefix of its metrics, e.g. service-discovery into ServiceDiscovery.
+func metricName(externalServiceName string) string {
+	var name string
+	for _, word := range strings.Split(externalServiceName, "-") {
+		if word != "" {
+			name += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return name
 }
 
 func (s *RouteBroadcastScheduler) EmitCh() chan struct{} {
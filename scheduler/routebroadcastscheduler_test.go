@@ -1,11 +1,15 @@
 package scheduler_test
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"time"
 
 	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
 	"code.cloudfoundry.org/lager/lagertest"
 	"code.cloudfoundry.org/route-emitter/diegonats"
 	"code.cloudfoundry.org/route-emitter/scheduler"
@@ -22,6 +26,10 @@ var _ = Describe("RouteBroadcastScheduler", func() {
 		process         ifrit.Process
 		clock           *fakeclock.FakeClock
 		emitCh          chan struct{}
+		emitSliceCh     chan struct{}
+		emitToCh        chan string
+		slices          int
+		metronClient    *mfakes.FakeIngressClient
 
 		shutdown chan struct{}
 
@@ -36,6 +44,10 @@ var _ = Describe("RouteBroadcastScheduler", func() {
 				clock = fakeclock.NewFakeClock(time.Now())
 
 				emitCh = make(chan struct{}, 1)
+				emitSliceCh = make(chan struct{}, 1)
+				emitToCh = nil
+				slices = 1
+				metronClient = &mfakes.FakeIngressClient{}
 				startMessages := make(chan *nats.Msg)
 				natsStartMessages = startMessages
 
@@ -52,7 +64,13 @@ var _ = Describe("RouteBroadcastScheduler", func() {
 
 			JustBeforeEach(func() {
 				logger := lagertest.NewTestLogger("test")
-				schedulerRunner = scheduler.NewRouteBroadcastScheduler(clock, natsClient, logger, prefix, emitCh)
+				if emitToCh != nil {
+					schedulerRunner = scheduler.NewTargetedRouteBroadcastScheduler(clock, natsClient, logger, metronClient, prefix, emitCh, nil, emitToCh, slices)
+				} else if slices > 1 {
+					schedulerRunner = scheduler.NewSmearedRouteBroadcastScheduler(clock, natsClient, logger, metronClient, prefix, emitCh, emitSliceCh, slices)
+				} else {
+					schedulerRunner = scheduler.NewRouteBroadcastScheduler(clock, natsClient, logger, metronClient, prefix, emitCh)
+				}
 
 				shutdown = make(chan struct{})
 
@@ -105,6 +123,238 @@ var _ = Describe("RouteBroadcastScheduler", func() {
 					})
 				})
 
+				Context("when the register interval is too close to the prune threshold", func() {
+					JustBeforeEach(func() {
+						natsStartMessages <- &nats.Msg{
+							Data: []byte(`{"minimumRegisterIntervalInSeconds":10, "pruneThresholdInSeconds": 6}`),
+						}
+					})
+
+					It("should emit at half of the prune threshold", func() {
+						Eventually(greetings).Should(Receive())
+						clock.WaitForWatcherAndIncrement(3 * time.Second)
+						Eventually(schedulerRunner.EmitCh()).Should(Receive())
+						clock.WaitForWatcherAndIncrement(3 * time.Second)
+						Eventually(schedulerRunner.EmitCh()).Should(Receive())
+					})
+				})
+
+				Context("when the greeting has no register interval", func() {
+					JustBeforeEach(func() {
+						natsStartMessages <- &nats.Msg{
+							Data: []byte(`{"minimumRegisterIntervalInSeconds":0, "pruneThresholdInSeconds": 4}`),
+						}
+					})
+
+					It("should emit at half of the prune threshold", func() {
+						Eventually(greetings).Should(Receive())
+						clock.WaitForWatcherAndIncrement(2 * time.Second)
+						Eventually(schedulerRunner.EmitCh()).Should(Receive())
+					})
+				})
+
+				Context("when the greeting has neither a register interval nor a prune threshold", func() {
+					JustBeforeEach(func() {
+						natsStartMessages <- &nats.Msg{
+							Data: []byte(`{"minimumRegisterIntervalInSeconds":0, "pruneThresholdInSeconds": 0}`),
+						}
+					})
+
+					It("should ignore it and keep greeting the external service", func() {
+						Eventually(greetings).Should(Receive())
+						clock.WaitForWatcherAndIncrement(time.Second)
+						Eventually(greetings).Should(Receive())
+						Consistently(schedulerRunner.EmitCh()).ShouldNot(Receive())
+					})
+				})
+
+				Context("when the greeting has a negative interval", func() {
+					JustBeforeEach(func() {
+						natsStartMessages <- &nats.Msg{
+							Data: []byte(`{"minimumRegisterIntervalInSeconds":-1, "pruneThresholdInSeconds": 6}`),
+						}
+					})
+
+					It("should ignore it and keep greeting the external service", func() {
+						Eventually(greetings).Should(Receive())
+						clock.WaitForWatcherAndIncrement(time.Second)
+						Eventually(greetings).Should(Receive())
+					})
+				})
+
+				Context("when several routers greet the emitter", func() {
+					JustBeforeEach(func() {
+						natsStartMessages <- &nats.Msg{
+							Data: []byte(`{"id":"router-1","hosts":["10.0.0.1"],"minimumRegisterIntervalInSeconds":4,"pruneThresholdInSeconds":12}`),
+						}
+						natsStartMessages <- &nats.Msg{
+							Data: []byte(`{"id":"router-2","hosts":["10.0.0.2"],"minimumRegisterIntervalInSeconds":2,"pruneThresholdInSeconds":12}`),
+						}
+
+						// wait out the jitter of the new interval
+						Eventually(clock.WatcherCount).Should(Equal(3))
+						clock.Increment(500 * time.Millisecond)
+					})
+
+					It("tracks each of them", func() {
+						Eventually(schedulerRunner.Routers).Should(HaveLen(2))
+						routers := schedulerRunner.Routers()
+						Expect(routers[0].ID).To(Equal("router-1"))
+						Expect(routers[0].Hosts).To(Equal([]string{"10.0.0.1"}))
+						Expect(time.Duration(routers[0].RegisterInterval)).To(Equal(4 * time.Second))
+						Expect(routers[1].ID).To(Equal("router-2"))
+						Expect(time.Duration(routers[1].PruneThreshold)).To(Equal(12 * time.Second))
+					})
+
+					It("lists them on the routers endpoint", func() {
+						Eventually(schedulerRunner.Routers).Should(HaveLen(2))
+
+						resp := httptest.NewRecorder()
+						scheduler.NewRoutersHandler(lagertest.NewTestLogger("test"), schedulerRunner).ServeHTTP(resp, httptest.NewRequest("GET", "/routers", nil))
+						var routers []scheduler.Router
+						Expect(json.Unmarshal(resp.Body.Bytes(), &routers)).To(Succeed())
+						Expect(routers).To(HaveLen(2))
+						Expect(routers[1].ID).To(Equal("router-2"))
+					})
+				})
+
+				Context("when a router stops answering greetings", func() {
+					JustBeforeEach(func() {
+						natsStartMessages <- &nats.Msg{
+							Data: []byte(`{"id":"router-1","minimumRegisterIntervalInSeconds":1,"pruneThresholdInSeconds":2}`),
+						}
+					})
+
+					It("marks it as stale", func() {
+						Eventually(greetings).Should(Receive())
+						// the emit and greeting tickers
+						Eventually(clock.WatcherCount).Should(Equal(2))
+
+						for i := 0; i < 3; i++ {
+							clock.Increment(2 * time.Second)
+							Eventually(greetings).Should(Receive())
+						}
+
+						Eventually(func() bool { return schedulerRunner.Routers()[0].Stale }).Should(BeTrue())
+
+						staleCounts := []int{}
+						for i := 0; i < metronClient.SendMetricCallCount(); i++ {
+							name, value, _ := metronClient.SendMetricArgsForCall(i)
+							if strings.HasPrefix(name, "Stale") {
+								staleCounts = append(staleCounts, value)
+							}
+						}
+						Expect(staleCounts).To(ContainElement(1))
+					})
+				})
+
+				Context("when the emits are smeared across the interval", func() {
+					BeforeEach(func() {
+						slices = 4
+					})
+
+					JustBeforeEach(func() {
+						natsStartMessages <- &nats.Msg{
+							Data: []byte(`{"minimumRegisterIntervalInSeconds":2, "pruneThresholdInSeconds": 6}`),
+						}
+					})
+
+					It("should emit once per slice in every interval", func() {
+						Eventually(greetings).Should(Receive())
+						for i := 0; i < 8; i++ {
+							clock.WaitForWatcherAndIncrement(500 * time.Millisecond)
+							Eventually(emitSliceCh).Should(Receive())
+						}
+						Expect(schedulerRunner.EmitCh()).NotTo(Receive())
+					})
+
+					Context("when the interval would be too short", func() {
+						BeforeEach(func() {
+							slices = 60
+						})
+
+						It("should not emit more often than every 100ms", func() {
+							Eventually(greetings).Should(Receive())
+							clock.WaitForWatcherAndIncrement(50 * time.Millisecond)
+							Consistently(emitSliceCh).ShouldNot(Receive())
+							clock.Increment(50 * time.Millisecond)
+							Eventually(emitSliceCh).Should(Receive())
+						})
+					})
+				})
+
+				Context("when targeted emits are enabled", func() {
+					BeforeEach(func() {
+						emitToCh = make(chan string, 1)
+					})
+
+					JustBeforeEach(func() {
+						natsStartMessages <- &nats.Msg{
+							Data: []byte(`{"id":"router-1","minimumRegisterIntervalInSeconds":1, "pruneThresholdInSeconds": 180}`),
+						}
+						Eventually(greetings).Should(Receive())
+					})
+
+					It("sends the routes to the inbox of a starting router only", func() {
+						natsStartMessages <- &nats.Msg{
+							Data: []byte(`{"id":"router-2","minimumRegisterIntervalInSeconds":1, "pruneThresholdInSeconds": 180, "inbox": "_INBOX.router-2"}`),
+						}
+						Eventually(emitToCh).Should(Receive(Equal("_INBOX.router-2")))
+
+						clock.Increment(200 * time.Millisecond)
+						Consistently(schedulerRunner.EmitCh()).ShouldNot(Receive())
+					})
+
+					It("does not use the reply subject of the start message as the inbox", func() {
+						natsStartMessages <- &nats.Msg{
+							Reply: "_INBOX.router-2",
+							Data:  []byte(`{"id":"router-2","minimumRegisterIntervalInSeconds":1, "pruneThresholdInSeconds": 180}`),
+						}
+
+						Consistently(schedulerRunner.EmitCh()).ShouldNot(Receive())
+						clock.Increment(200 * time.Millisecond)
+						Eventually(schedulerRunner.EmitCh()).Should(Receive())
+						Expect(emitToCh).NotTo(Receive())
+					})
+
+					It("keeps emitting to all routers at the interval", func() {
+						natsStartMessages <- &nats.Msg{
+							Data: []byte(`{"id":"router-2","minimumRegisterIntervalInSeconds":1, "pruneThresholdInSeconds": 180, "inbox": "_INBOX.router-2"}`),
+						}
+						Eventually(emitToCh).Should(Receive())
+
+						clock.WaitForWatcherAndIncrement(time.Second)
+						Eventually(schedulerRunner.EmitCh()).Should(Receive())
+					})
+
+					Context("when the router does not provide an inbox", func() {
+						It("falls back to emitting to all routers", func() {
+							natsStartMessages <- &nats.Msg{
+								Data: []byte(`{"id":"router-2","minimumRegisterIntervalInSeconds":1, "pruneThresholdInSeconds": 180}`),
+							}
+
+							Consistently(schedulerRunner.EmitCh()).ShouldNot(Receive())
+							clock.Increment(200 * time.Millisecond)
+							Eventually(schedulerRunner.EmitCh()).Should(Receive())
+							Expect(emitToCh).NotTo(Receive())
+						})
+					})
+
+					Context("when a targeted emit is already pending", func() {
+						It("falls back to emitting to all routers", func() {
+							emitToCh <- "_INBOX.router-0"
+							natsStartMessages <- &nats.Msg{
+								Data: []byte(`{"id":"router-2","minimumRegisterIntervalInSeconds":1, "pruneThresholdInSeconds": 180, "inbox": "_INBOX.router-2"}`),
+							}
+
+							Consistently(schedulerRunner.EmitCh()).ShouldNot(Receive())
+							clock.Increment(200 * time.Millisecond)
+							Eventually(schedulerRunner.EmitCh()).Should(Receive())
+							Eventually(emitToCh).Should(Receive(Equal("_INBOX.router-0")))
+						})
+					})
+				})
+
 				Context("when the external service does not emit a *.start", func() {
 					It("should keep greeting the external service until it gets an interval", func() {
 						//get the first greeting
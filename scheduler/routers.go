@@ -0,0 +1,152 @@
+package scheduler
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/durationjson"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+)
+
+// Router is an instance of the external service that greeted the emitter.
+type Router struct {
+	ID               string                `json:"id"`
+	Hosts            []string              `json:"hosts,omitempty"`
+	RegisterInterval durationjson.Duration `json:"register_interval"`
+	PruneThreshold   durationjson.Duration `json:"prune_threshold"`
+	LastSeen         time.Time             `json:"last_seen"`
+	// Stale is set once the router stopped answering greetings
+	Stale bool `json:"stale"`
+}
+
+// routerID identifies the router that sent a greeting. Routers that do not
+// send an id are told apart by their hosts, and are all the same router if
+// they send neither.
+func routerID(greeting routingtable.ExternalServiceGreetingMessage) string {
+	if greeting.ID != "" {
+		return greeting.ID
+	}
+	return strings.Join(greeting.Hosts, ",")
+}
+
+// routers tracks the routers that greeted the emitter. It is updated by the
+// NATS callbacks and read by the scheduler and the debug endpoint.
+type routers struct {
+	lock    sync.Mutex
+	routers map[string]*Router
+}
+
+func newRouters() *routers {
+	return &routers{routers: map[string]*Router{}}
+}
+
+// seen records a greeting of a router. It returns the register interval of
+// all routers, whether the router is new and whether the interval changed.
+func (r *routers) seen(id string, hosts []string, registerInterval, pruneThreshold time.Duration, now time.Time) (interval time.Duration, isNew, intervalChanged bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	before := r.registerInterval()
+	router, ok := r.routers[id]
+	if !ok {
+		router = &Router{ID: id}
+		r.routers[id] = router
+	}
+	isNew = !ok || router.Stale
+
+	router.Hosts = hosts
+	router.RegisterInterval = durationjson.Duration(registerInterval)
+	router.PruneThreshold = durationjson.Duration(pruneThreshold)
+	router.LastSeen = now
+	router.Stale = false
+
+	interval = r.registerInterval()
+	return interval, isNew, interval != before
+}
+
+// registerInterval is the smallest register interval of the routers that are
+// not stale.
+func (r *routers) registerInterval() time.Duration {
+	var interval time.Duration
+	for _, router := range r.routers {
+		if router.Stale {
+			continue
+		}
+		if interval == 0 || time.Duration(router.RegisterInterval) < interval {
+			interval = time.Duration(router.RegisterInterval)
+		}
+	}
+	return interval
+}
+
+// greetInterval is how often the routers are greeted to find out whether they
+// are still there. It is the smallest prune threshold, or a multiple of the
+// register interval for routers that do not advertise one.
+func (r *routers) greetInterval() time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var interval time.Duration
+	for _, router := range r.routers {
+		if router.Stale {
+			continue
+		}
+		threshold := time.Duration(router.PruneThreshold)
+		if threshold == 0 {
+			threshold = greetIntervalsPerRegisterInterval * time.Duration(router.RegisterInterval)
+		}
+		if interval == 0 || threshold < interval {
+			interval = threshold
+		}
+	}
+	return interval
+}
+
+// expire marks routers that were not seen since staleBefore as stale and
+// forgets the ones that were not seen since forgetBefore. It returns the
+// routers that became stale and the register interval of the others.
+func (r *routers) expire(staleBefore, forgetBefore time.Time) ([]Router, time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var stale []Router
+	for id, router := range r.routers {
+		if router.LastSeen.Before(forgetBefore) {
+			delete(r.routers, id)
+			continue
+		}
+		if !router.Stale && router.LastSeen.Before(staleBefore) {
+			router.Stale = true
+			stale = append(stale, *router)
+		}
+	}
+	return stale, r.registerInterval()
+}
+
+func (r *routers) counts() (active, stale int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, router := range r.routers {
+		if router.Stale {
+			stale++
+		} else {
+			active++
+		}
+	}
+	return active, stale
+}
+
+func (r *routers) list() []Router {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	list := make([]Router, 0, len(r.routers))
+	for _, router := range r.routers {
+		list = append(list, *router)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
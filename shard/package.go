@@ -0,0 +1 @@
+package shard // import "code.cloudfoundry.org/route-emitter/shard"
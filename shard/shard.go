@@ -0,0 +1,57 @@
+package shard
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"code.cloudfoundry.org/bbs/models"
+)
+
+// Shard is the slice of process GUIDs an emitter is responsible for in sharded
+// global mode. A Count of 0 or 1 owns every process GUID.
+type Shard struct {
+	Index int
+	Count int
+}
+
+func New(index, count int) (Shard, error) {
+	if count < 0 || (count > 0 && (index < 0 || index >= count)) {
+		return Shard{}, fmt.Errorf("invalid shard %d of %d", index, count)
+	}
+	return Shard{Index: index, Count: count}, nil
+}
+
+func (s Shard) Sharded() bool {
+	return s.Count > 1
+}
+
+// LockKey returns the locket key the emitters of this shard compete for, so
+// that each shard fails over independently.
+func (s Shard) LockKey(key string) string {
+	if !s.Sharded() {
+		return key
+	}
+	return fmt.Sprintf("%s_shard_%d_of_%d", key, s.Index, s.Count)
+}
+
+func (s Shard) Owns(processGuid string) bool {
+	if !s.Sharded() {
+		return true
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(processGuid))
+	return int(hash.Sum32()%uint32(s.Count)) == s.Index
+}
+
+func (s Shard) DesiredLRP(desiredLRP *models.DesiredLRP) bool {
+	return s.Owns(desiredLRP.ProcessGuid)
+}
+
+func (s Shard) ActualLRP(actualLRP *models.ActualLRP) bool {
+	return s.Owns(actualLRP.ProcessGuid)
+}
+
+func (s Shard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
@@ -0,0 +1,82 @@
+package shard_test
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/route-emitter/shard"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Shard", func() {
+	Describe("New", func() {
+		It("rejects an index outside of the shard count", func() {
+			_, err := shard.New(3, 3)
+			Expect(err).To(HaveOccurred())
+
+			_, err = shard.New(-1, 3)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("accepts an unsharded configuration", func() {
+			s, err := shard.New(0, 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(s.Sharded()).To(BeFalse())
+		})
+	})
+
+	Context("when not sharded", func() {
+		It("owns every process guid", func() {
+			s := shard.Shard{Index: 0, Count: 1}
+			Expect(s.Owns("some-process-guid")).To(BeTrue())
+			Expect(s.LockKey("route_emitter")).To(Equal("route_emitter"))
+		})
+	})
+
+	Context("when sharded", func() {
+		var shards []shard.Shard
+
+		BeforeEach(func() {
+			shards = []shard.Shard{}
+			for i := 0; i < 3; i++ {
+				s, err := shard.New(i, 3)
+				Expect(err).NotTo(HaveOccurred())
+				shards = append(shards, s)
+			}
+		})
+
+		It("assigns every process guid to exactly one shard", func() {
+			owned := make([]int, len(shards))
+			for i := 0; i < 300; i++ {
+				processGuid := fmt.Sprintf("process-guid-%d", i)
+				owners := 0
+				for j, s := range shards {
+					if s.Owns(processGuid) {
+						owners++
+						owned[j]++
+					}
+				}
+				Expect(owners).To(Equal(1))
+			}
+
+			for _, count := range owned {
+				Expect(count).To(BeNumerically(">", 0))
+			}
+		})
+
+		It("filters lrps by process guid", func() {
+			desiredLRP := &models.DesiredLRP{ProcessGuid: "some-process-guid"}
+			actualLRP := &models.ActualLRP{ActualLRPKey: models.NewActualLRPKey("some-process-guid", 0, "domain")}
+			for _, s := range shards {
+				Expect(s.DesiredLRP(desiredLRP)).To(Equal(s.Owns("some-process-guid")))
+				Expect(s.ActualLRP(actualLRP)).To(Equal(s.Owns("some-process-guid")))
+			}
+		})
+
+		It("uses a lock key per shard", func() {
+			Expect(shards[1].LockKey("route_emitter")).To(Equal("route_emitter_shard_1_of_3"))
+		})
+	})
+})
@@ -1,7 +1,9 @@
 package syncer
 
 import (
+	"math/rand"
 	"os"
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/clock"
@@ -10,22 +12,60 @@ import (
 
 type NatsSyncer struct {
 	clock                clock.Clock
-	syncInterval         time.Duration
 	syncCh               chan struct{}
 	externalServiceStart chan time.Duration
 
+	// syncInterval can be changed while the syncer runs, intervalChanged
+	// tells the run loop to restart the current interval
+	lock            sync.Mutex
+	syncInterval    time.Duration
+	intervalChanged chan struct{}
+
+	// jitter is the fraction of the sync interval, between 0 and 1, that each
+	// interval is randomly lengthened or shortened by. An interval is never
+	// shortened below minJitteredInterval of the sync interval.
+	jitter float64
+	rand   *rand.Rand
+
 	logger lager.Logger
 }
 
+// minJitteredInterval is the fraction of the sync interval that a jittered
+// interval is at least, so that a large jitter cannot make the emitter sync
+// against BBS right after the previous sync.
+const minJitteredInterval = 0.5
+
 func NewSyncer(
 	clock clock.Clock,
 	syncInterval time.Duration,
 	logger lager.Logger,
 ) *NatsSyncer {
+	return NewJitteredSyncer(clock, syncInterval, 0, logger)
+}
+
+// NewJitteredSyncer returns a syncer whose intervals vary randomly by up to
+// the jitter fraction of the sync interval, so that emitters started at the
+// same time do not all sync against BBS at the same moment.
+func NewJitteredSyncer(
+	clock clock.Clock,
+	syncInterval time.Duration,
+	jitter float64,
+	logger lager.Logger,
+) *NatsSyncer {
+	if jitter < 0 {
+		jitter = 0
+	} else if jitter > 1 {
+		jitter = 1
+	}
+
 	return &NatsSyncer{
 		clock:        clock,
 		syncInterval: syncInterval,
 		syncCh:       make(chan struct{}, 1),
+		jitter:       jitter,
+		rand:         rand.New(rand.NewSource(time.Now().UnixNano())),
+
+		intervalChanged: make(chan struct{}, 1),
 
 		externalServiceStart: make(chan time.Duration),
 
@@ -40,15 +80,26 @@ func (s *NatsSyncer) Run(signals <-chan os.Signal, ready chan<- struct{}) error
 	s.sync()
 
 	// now keep emitting at the desired interval, syncing every syncInterval
-	syncTicker := s.clock.NewTicker(s.syncInterval)
+	syncTimer := s.clock.NewTimer(s.nextInterval())
 
 	for {
 		select {
-		case <-syncTicker.C():
+		case <-syncTimer.C():
 			s.sync()
+			syncTimer.Reset(s.nextInterval())
+		case <-s.intervalChanged:
+			if !syncTimer.Stop() {
+				select {
+				case <-syncTimer.C():
+				default:
+				}
+			}
+			interval := s.nextInterval()
+			syncTimer.Reset(interval)
+			s.logger.Info("sync-interval-changed", lager.Data{"next-sync-in": interval.String()})
 		case <-signals:
 			s.logger.Info("stopping")
-			syncTicker.Stop()
+			syncTimer.Stop()
 			return nil
 		}
 	}
@@ -56,6 +107,34 @@ func (s *NatsSyncer) Run(signals <-chan os.Signal, ready chan<- struct{}) error
 	return nil
 }
 
+// SetSyncInterval changes the sync interval. The interval that is currently
+// running is restarted with the new one.
+func (s *NatsSyncer) SetSyncInterval(syncInterval time.Duration) {
+	s.lock.Lock()
+	s.syncInterval = syncInterval
+	s.lock.Unlock()
+
+	select {
+	case s.intervalChanged <- struct{}{}:
+	default:
+	}
+}
+
+func (s *NatsSyncer) nextInterval() time.Duration {
+	s.lock.Lock()
+	syncInterval := s.syncInterval
+	s.lock.Unlock()
+
+	if s.jitter == 0 {
+		return syncInterval
+	}
+	interval := syncInterval + time.Duration((2*s.rand.Float64()-1)*s.jitter*float64(syncInterval))
+	if floor := time.Duration(minJitteredInterval * float64(syncInterval)); interval < floor {
+		return floor
+	}
+	return interval
+}
+
 func (s *NatsSyncer) SyncCh() chan struct{} {
 	return s.syncCh
 }
@@ -9,6 +9,7 @@ import (
 	"code.cloudfoundry.org/route-emitter/syncer"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 	"github.com/tedsuo/ifrit"
 )
 
@@ -17,7 +18,9 @@ var _ = Describe("NatsSyncer", func() {
 		syncerRunner *syncer.NatsSyncer
 		process      ifrit.Process
 		clock        *fakeclock.FakeClock
+		logger       *lagertest.TestLogger
 		syncInterval time.Duration
+		jitter       float64
 
 		shutdown chan struct{}
 	)
@@ -25,11 +28,16 @@ var _ = Describe("NatsSyncer", func() {
 	BeforeEach(func() {
 		clock = fakeclock.NewFakeClock(time.Now())
 		syncInterval = 10 * time.Second
+		jitter = 0
 	})
 
 	JustBeforeEach(func() {
-		logger := lagertest.NewTestLogger("test")
-		syncerRunner = syncer.NewSyncer(clock, syncInterval, logger)
+		logger = lagertest.NewTestLogger("test")
+		if jitter > 0 {
+			syncerRunner = syncer.NewJitteredSyncer(clock, syncInterval, jitter, logger)
+		} else {
+			syncerRunner = syncer.NewSyncer(clock, syncInterval, logger)
+		}
 
 		shutdown = make(chan struct{})
 
@@ -55,4 +63,66 @@ var _ = Describe("NatsSyncer", func() {
 			Eventually(syncerRunner.SyncCh()).Should(Receive())
 		})
 	})
+
+	Context("when the sync interval is changed", func() {
+		BeforeEach(func() {
+			syncInterval = time.Minute
+		})
+
+		It("restarts the current interval with the new one", func() {
+			Eventually(syncerRunner.SyncCh()).Should(Receive())
+
+			clock.WaitForWatcherAndIncrement(30 * time.Second)
+			syncerRunner.SetSyncInterval(10 * time.Second)
+			Eventually(logger).Should(gbytes.Say("sync-interval-changed"))
+
+			clock.Increment(9 * time.Second)
+			Consistently(syncerRunner.SyncCh(), 50*time.Millisecond).ShouldNot(Receive())
+
+			clock.Increment(time.Second)
+			Eventually(syncerRunner.SyncCh()).Should(Receive())
+
+			clock.WaitForWatcherAndIncrement(10 * time.Second)
+			Eventually(syncerRunner.SyncCh()).Should(Receive())
+		})
+	})
+
+	Context("with jitter", func() {
+		BeforeEach(func() {
+			syncInterval = 10 * time.Second
+			jitter = 0.5
+		})
+
+		It("should sync within the jittered interval", func() {
+			// the first sync happens right away
+			Eventually(syncerRunner.SyncCh()).Should(Receive())
+
+			for i := 0; i < 5; i++ {
+				clock.WaitForWatcherAndIncrement(4900 * time.Millisecond)
+				Consistently(syncerRunner.SyncCh(), 50*time.Millisecond).ShouldNot(Receive())
+
+				clock.Increment(10200 * time.Millisecond)
+				Eventually(syncerRunner.SyncCh()).Should(Receive())
+			}
+		})
+	})
+
+	Context("with a jitter of 1", func() {
+		BeforeEach(func() {
+			syncInterval = 10 * time.Second
+			jitter = 1
+		})
+
+		It("waits at least half the sync interval between syncs", func() {
+			Eventually(syncerRunner.SyncCh()).Should(Receive())
+
+			for i := 0; i < 5; i++ {
+				clock.WaitForWatcherAndIncrement(4900 * time.Millisecond)
+				Consistently(syncerRunner.SyncCh(), 50*time.Millisecond).ShouldNot(Receive())
+
+				clock.Increment(15200 * time.Millisecond)
+				Eventually(syncerRunner.SyncCh()).Should(Receive())
+			}
+		})
+	})
 })
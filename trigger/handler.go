@@ -0,0 +1,68 @@
+package trigger
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// Response is the body of the responses of the trigger handler.
+type Response struct {
+	Trigger Kind   `json:"trigger"`
+	Error   string `json:"error,omitempty"`
+}
+
+// NewHandler returns an http.Handler that requests the kind of trigger on a
+// POST. It responds with 202 once the request is passed on, with 429 and a
+// Retry-After header while the kind is rate limited, and with 503 while the
+// trigger is not active, i.e. on a standby emitter.
+func NewHandler(logger lager.Logger, trigger *Trigger, kind Kind) http.Handler {
+	logger = logger.Session("trigger-handler", lager.Data{"trigger": kind})
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			resp.Header().Set("Allow", http.MethodPost)
+			http.Error(resp, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		data := lager.Data{
+			"remote-addr": req.RemoteAddr,
+			"user-agent":  req.UserAgent(),
+		}
+
+		var retryAfter time.Duration
+		err := ErrInactive
+		if trigger.isActive() {
+			retryAfter, err = trigger.Request(kind, "http", data)
+		} else {
+			logger.Info("trigger-ignored-while-inactive", data)
+		}
+
+		response := Response{Trigger: kind}
+		status := http.StatusAccepted
+		switch err {
+		case nil:
+		case ErrInactive:
+			response.Error = err.Error()
+			status = http.StatusServiceUnavailable
+		case ErrRateLimited:
+			resp.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(retryAfter.Seconds()))))
+			response.Error = err.Error()
+			status = http.StatusTooManyRequests
+		default:
+			response.Error = err.Error()
+			status = http.StatusNotFound
+		}
+
+		resp.Header().Set("Content-Type", "application/json")
+		resp.WriteHeader(status)
+		err = json.NewEncoder(resp).Encode(response)
+		if err != nil {
+			logger.Error("failed-to-encode-response", err)
+		}
+	})
+}
@@ -0,0 +1 @@
+package trigger // import "code.cloudfoundry.org/route-emitter/trigger"
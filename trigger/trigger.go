@@ -0,0 +1,193 @@
+package trigger
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+	"github.com/tedsuo/ifrit"
+)
+
+// Kind is what an operator can ask the emitter to do right away.
+type Kind string
+
+const (
+	Sync         Kind = "sync"
+	EmitExternal Kind = "emit-external"
+	EmitInternal Kind = "emit-internal"
+)
+
+// DefaultMinInterval is how long a kind of trigger is rate limited for after
+// it was requested, unless configured otherwise.
+const DefaultMinInterval = 10 * time.Second
+
+var (
+	ErrDisabled    = errors.New("trigger is disabled")
+	ErrRateLimited = errors.New("trigger is rate limited")
+	ErrInactive    = errors.New("trigger is inactive until the emitter holds the lock")
+)
+
+// Trigger requests syncs and emits on the channels that the watcher reads,
+// on behalf of an operator. Every request is logged with its source, and
+// each kind can only be requested once per minimum interval.
+type Trigger struct {
+	logger      lager.Logger
+	clock       clock.Clock
+	channels    map[Kind]chan struct{}
+	minInterval time.Duration
+
+	lock          sync.Mutex
+	lastRequested map[Kind]time.Time
+
+	// active is set while the trigger runs, i.e. while the emitter holds the
+	// lock. Signals are ignored otherwise.
+	active bool
+}
+
+// NewTrigger returns a trigger for the given channels. A nil channel disables
+// its kind, e.g. emitInternalCh when internal routes are not emitted.
+func NewTrigger(
+	logger lager.Logger,
+	clock clock.Clock,
+	syncCh, emitExternalCh, emitInternalCh chan struct{},
+	minInterval time.Duration,
+) *Trigger {
+	if minInterval <= 0 {
+		minInterval = DefaultMinInterval
+	}
+
+	channels := map[Kind]chan struct{}{}
+	for kind, ch := range map[Kind]chan struct{}{Sync: syncCh, EmitExternal: emitExternalCh, EmitInternal: emitInternalCh} {
+		if ch != nil {
+			channels[kind] = ch
+		}
+	}
+
+	return &Trigger{
+		logger:        logger.Session("trigger"),
+		clock:         clock,
+		channels:      channels,
+		minInterval:   minInterval,
+		lastRequested: map[Kind]time.Time{},
+	}
+}
+
+// Enabled returns whether the kind can be requested.
+func (t *Trigger) Enabled(kind Kind) bool {
+	_, ok := t.channels[kind]
+	return ok
+}
+
+// Request asks the watcher to sync or emit. source describes who asked and is
+// logged together with data. If the same kind was requested less than the
+// minimum interval ago, it returns ErrRateLimited and how long to wait. A
+// request does not wait for the watcher, it is merged with one that is still
+// pending.
+func (t *Trigger) Request(kind Kind, source string, data lager.Data) (time.Duration, error) {
+	logData := lager.Data{"trigger": kind, "source": source}
+	for k, v := range data {
+		logData[k] = v
+	}
+
+	ch, ok := t.channels[kind]
+	if !ok {
+		t.logger.Info("trigger-disabled", logData)
+		return 0, ErrDisabled
+	}
+
+	t.lock.Lock()
+	now := t.clock.Now()
+	last, ok := t.lastRequested[kind]
+	if ok && now.Sub(last) < t.minInterval {
+		t.lock.Unlock()
+		retryAfter := t.minInterval - now.Sub(last)
+		logData["retry-after"] = retryAfter.String()
+		t.logger.Info("trigger-rate-limited", logData)
+		return retryAfter, ErrRateLimited
+	}
+	t.lastRequested[kind] = now
+	t.lock.Unlock()
+
+	select {
+	case ch <- struct{}{}:
+		t.logger.Info("trigger-requested", logData)
+	default:
+		t.logger.Info("trigger-already-pending", logData)
+	}
+	return 0, nil
+}
+
+// NotifySignals returns the channel that the trigger signals are delivered
+// on. It is called when the emitter starts, so that the signals never get
+// their default action of terminating the process.
+func NotifySignals() chan os.Signal {
+	triggerSignals := make(chan os.Signal, 1)
+	signal.Notify(triggerSignals, syscall.SIGUSR1, syscall.SIGUSR2)
+	return triggerSignals
+}
+
+// Run marks the trigger active until it is signalled. It runs while the
+// emitter holds the lock, so that a standby emitter ignores the signals.
+func (t *Trigger) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	t.setActive(true)
+	defer t.setActive(false)
+
+	close(ready)
+	<-signals
+	return nil
+}
+
+func (t *Trigger) setActive(active bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.active = active
+}
+
+func (t *Trigger) isActive() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.active
+}
+
+// SignalRunner returns a runner that requests a sync on SIGUSR1, and an
+// external and an internal emit on SIGUSR2, from the signals of
+// NotifySignals. The signals are logged and ignored while the trigger is not
+// active.
+func (t *Trigger) SignalRunner(triggerSignals <-chan os.Signal) ifrit.Runner {
+	return ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+		close(ready)
+		for {
+			select {
+			case sig := <-triggerSignals:
+				t.handleSignal(sig)
+			case <-signals:
+				return nil
+			}
+		}
+	})
+}
+
+func (t *Trigger) handleSignal(sig os.Signal) {
+	if !t.isActive() {
+		t.logger.Info("trigger-ignored-while-inactive", lager.Data{"signal": sig.String()})
+		return
+	}
+
+	kinds := []Kind{Sync}
+	if sig == syscall.SIGUSR2 {
+		kinds = []Kind{EmitExternal, EmitInternal}
+	}
+
+	for _, kind := range kinds {
+		if !t.Enabled(kind) {
+			continue
+		}
+		// errors are logged by Request and there is no one else to tell
+		_, _ = t.Request(kind, "signal", lager.Data{"signal": sig.String()})
+	}
+}
@@ -0,0 +1,216 @@
+package trigger_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/route-emitter/trigger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Trigger", func() {
+	var (
+		logger         *lagertest.TestLogger
+		clock          *fakeclock.FakeClock
+		syncCh         chan struct{}
+		emitExternalCh chan struct{}
+		emitInternalCh chan struct{}
+		t              *trigger.Trigger
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		clock = fakeclock.NewFakeClock(time.Now())
+		syncCh = make(chan struct{}, 1)
+		emitExternalCh = make(chan struct{}, 1)
+		emitInternalCh = make(chan struct{}, 1)
+	})
+
+	JustBeforeEach(func() {
+		t = trigger.NewTrigger(logger, clock, syncCh, emitExternalCh, emitInternalCh, time.Minute)
+	})
+
+	Describe("Request", func() {
+		It("signals the channel of the kind and logs the source", func() {
+			_, err := t.Request(trigger.Sync, "http", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(syncCh).To(Receive())
+			Expect(emitExternalCh).NotTo(Receive())
+			Expect(logger).To(gbytes.Say("trigger-requested.*\"source\":\"http\".*\"trigger\":\"sync\""))
+		})
+
+		It("merges a request with one that is still pending", func() {
+			_, err := t.Request(trigger.EmitExternal, "http", nil)
+			Expect(err).NotTo(HaveOccurred())
+			clock.Increment(time.Minute)
+			_, err = t.Request(trigger.EmitExternal, "http", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(logger).To(gbytes.Say("trigger-already-pending"))
+			Expect(emitExternalCh).To(Receive())
+			Expect(emitExternalCh).NotTo(Receive())
+		})
+
+		It("rate limits each kind", func() {
+			_, err := t.Request(trigger.Sync, "http", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(syncCh).To(Receive())
+
+			clock.Increment(20 * time.Second)
+			retryAfter, err := t.Request(trigger.Sync, "http", nil)
+			Expect(err).To(Equal(trigger.ErrRateLimited))
+			Expect(retryAfter).To(Equal(40 * time.Second))
+			Expect(syncCh).NotTo(Receive())
+			Expect(logger).To(gbytes.Say("trigger-rate-limited"))
+
+			_, err = t.Request(trigger.EmitInternal, "http", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(emitInternalCh).To(Receive())
+
+			clock.Increment(40 * time.Second)
+			_, err = t.Request(trigger.Sync, "http", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(syncCh).To(Receive())
+		})
+
+		Context("when a kind has no channel", func() {
+			BeforeEach(func() {
+				emitInternalCh = nil
+			})
+
+			It("is disabled", func() {
+				Expect(t.Enabled(trigger.EmitInternal)).To(BeFalse())
+				_, err := t.Request(trigger.EmitInternal, "http", nil)
+				Expect(err).To(Equal(trigger.ErrDisabled))
+			})
+		})
+	})
+
+	Describe("SignalRunner", func() {
+		var (
+			triggerSignals chan os.Signal
+			process        ifrit.Process
+			active         ifrit.Process
+		)
+
+		JustBeforeEach(func() {
+			triggerSignals = trigger.NotifySignals()
+			process = ifrit.Invoke(t.SignalRunner(triggerSignals))
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+			signal.Stop(triggerSignals)
+		})
+
+		Context("when the trigger is active", func() {
+			JustBeforeEach(func() {
+				active = ifrit.Invoke(t)
+			})
+
+			AfterEach(func() {
+				active.Signal(os.Interrupt)
+				Eventually(active.Wait()).Should(Receive(BeNil()))
+			})
+
+			It("syncs on SIGUSR1", func() {
+				Expect(syscall.Kill(os.Getpid(), syscall.SIGUSR1)).To(Succeed())
+				Eventually(syncCh).Should(Receive())
+				Expect(logger).To(gbytes.Say("trigger-requested.*\"signal\":\"user defined signal 1\""))
+			})
+
+			It("emits the external and internal routes on SIGUSR2", func() {
+				Expect(syscall.Kill(os.Getpid(), syscall.SIGUSR2)).To(Succeed())
+				Eventually(emitExternalCh).Should(Receive())
+				Eventually(emitInternalCh).Should(Receive())
+				Expect(syncCh).NotTo(Receive())
+			})
+		})
+
+		Context("when the trigger is not active", func() {
+			It("logs and ignores the signals", func() {
+				Expect(syscall.Kill(os.Getpid(), syscall.SIGUSR1)).To(Succeed())
+				Eventually(logger).Should(gbytes.Say("trigger-ignored-while-inactive"))
+				Consistently(syncCh).ShouldNot(Receive())
+			})
+		})
+	})
+
+	Describe("Handler", func() {
+		var (
+			handler http.Handler
+			active  ifrit.Process
+		)
+
+		JustBeforeEach(func() {
+			handler = trigger.NewHandler(logger, t, trigger.Sync)
+			active = ifrit.Invoke(t)
+		})
+
+		AfterEach(func() {
+			if active != nil {
+				active.Signal(os.Interrupt)
+				Eventually(active.Wait()).Should(Receive(BeNil()))
+			}
+		})
+
+		It("requests the trigger on a POST", func() {
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, httptest.NewRequest("POST", "/trigger/sync", nil))
+			Expect(resp.Code).To(Equal(http.StatusAccepted))
+			Expect(syncCh).To(Receive())
+
+			var response trigger.Response
+			Expect(json.Unmarshal(resp.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.Trigger).To(Equal(trigger.Sync))
+			Expect(logger).To(gbytes.Say("trigger-requested.*remote-addr"))
+		})
+
+		It("rejects other methods", func() {
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, httptest.NewRequest("GET", "/trigger/sync", nil))
+			Expect(resp.Code).To(Equal(http.StatusMethodNotAllowed))
+			Expect(syncCh).NotTo(Receive())
+		})
+
+		It("responds with too many requests while rate limited", func() {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/trigger/sync", nil))
+			clock.Increment(30500 * time.Millisecond)
+
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, httptest.NewRequest("POST", "/trigger/sync", nil))
+			Expect(resp.Code).To(Equal(http.StatusTooManyRequests))
+			Expect(resp.Header().Get("Retry-After")).To(Equal("30"))
+		})
+
+		Context("when the trigger is not active", func() {
+			JustBeforeEach(func() {
+				active.Signal(os.Interrupt)
+				Eventually(active.Wait()).Should(Receive(BeNil()))
+				active = nil
+			})
+
+			It("responds with service unavailable", func() {
+				resp := httptest.NewRecorder()
+				handler.ServeHTTP(resp, httptest.NewRequest("POST", "/trigger/sync", nil))
+				Expect(resp.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(syncCh).NotTo(Receive())
+
+				var response trigger.Response
+				Expect(json.Unmarshal(resp.Body.Bytes(), &response)).To(Succeed())
+				Expect(response.Error).To(Equal(trigger.ErrInactive.Error()))
+				Expect(logger).To(gbytes.Say("trigger-ignored-while-inactive.*remote-addr"))
+			})
+		})
+	})
+})
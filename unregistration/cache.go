@@ -1,72 +1,232 @@
 package unregistration
 
 import (
+	"container/list"
 	"sync"
+	"time"
 
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/route-emitter/routingtable"
 	"github.com/mitchellh/hashstructure"
 )
 
+const (
+	cacheEvictionsCounter   = "UnregistrationCacheEvictions"
+	cacheExpirationsCounter = "UnregistrationCacheExpirations"
+)
+
 //go:generate counterfeiter -o fakes/fake_cache.go . Cache
 type Cache interface {
 	Add([]routingtable.RegistryMessage) error
 	Remove([]routingtable.RegistryMessage) error
+	// IncrementSent counts one more send of each of the listed messages that is
+	// still in the cache, and removes the ones that were sent sendCount times.
+	// A message that was added again since it was listed is a new entry and is
+	// left alone.
+	IncrementSent(messages []*Message, sendCount int) error
 	List() []*Message
 }
 
+// Limits bounds the cache. A zero value for either field disables that limit.
+type Limits struct {
+	// MaxSize is the number of messages kept before the oldest ones are evicted.
+	MaxSize int
+	// MaxAge is how long a message is kept, no matter how many times it was sent.
+	MaxAge time.Duration
+}
+
 type cache struct {
-	messages map[uint64]*Message
-	mux      *sync.Mutex
-	logger   lager.Logger
+	messages     map[uint64]*list.Element
+	order        *list.List
+	limits       Limits
+	clock        clock.Clock
+	metronClient loggingclient.IngressClient
+	mux          *sync.Mutex
+	logger       lager.Logger
+}
+
+type cacheEntry struct {
+	hash    uint64
+	message *Message
 }
 
 func NewCache(logger lager.Logger) Cache {
+	return newCache(logger, clock.NewClock(), nil, Limits{})
+}
+
+func NewBoundedCache(logger lager.Logger, clock clock.Clock, metronClient loggingclient.IngressClient, limits Limits) Cache {
+	return newCache(logger, clock, metronClient, limits)
+}
+
+func newCache(logger lager.Logger, clock clock.Clock, metronClient loggingclient.IngressClient, limits Limits) *cache {
 	cacheLogger := logger.Session("unregistration-cache")
 	return &cache{
-		messages: map[uint64]*Message{},
-		mux:      &sync.Mutex{},
-		logger:   cacheLogger,
+		messages:     map[uint64]*list.Element{},
+		order:        list.New(),
+		limits:       limits,
+		clock:        clock,
+		metronClient: metronClient,
+		mux:          &sync.Mutex{},
+		logger:       cacheLogger,
 	}
 }
 
 func (c *cache) Add(registryMessages []routingtable.RegistryMessage) error {
 	c.mux.Lock()
 	defer c.mux.Unlock()
+
 	c.logger.Debug("add", lager.Data{"cache": registryMessages})
+	now := c.clock.Now()
 	for _, registryMessage := range registryMessages {
 		registryMessageHash, err := hashstructure.Hash(registryMessage, nil)
 		if err != nil {
 			return err
 		}
-		c.messages[registryMessageHash] = &Message{
+
+		c.set(registryMessageHash, &Message{
 			RegistryMessage: registryMessage,
-		}
+			AddedAt:         now,
+		})
 	}
+
+	c.evict()
 	return nil
 }
 
 func (c *cache) Remove(registryMessages []routingtable.RegistryMessage) error {
 	c.mux.Lock()
 	defer c.mux.Unlock()
+
 	c.logger.Debug("remove", lager.Data{"cache": registryMessages})
 	for _, registryMessage := range registryMessages {
 		registryMessageHash, err := hashstructure.Hash(registryMessage, nil)
 		if err != nil {
 			return err
 		}
-		delete(c.messages, registryMessageHash)
+
+		c.delete(registryMessageHash)
 	}
+
 	return nil
 }
 
+func (c *cache) IncrementSent(messages []*Message, sendCount int) error {
+	_, _, err := c.incrementSent(messages, sendCount)
+	return err
+}
+
+// incrementSent returns copies of the messages whose count was incremented and
+// the messages that were removed because they were sent sendCount times.
+func (c *cache) incrementSent(messages []*Message, sendCount int) ([]Message, []routingtable.RegistryMessage, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	incremented := []Message{}
+	removed := []routingtable.RegistryMessage{}
+	for _, listed := range messages {
+		registryMessageHash, err := hashstructure.Hash(listed.RegistryMessage, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		element, ok := c.messages[registryMessageHash]
+		if !ok {
+			continue
+		}
+		message := element.Value.(*cacheEntry).message
+		if !message.AddedAt.Equal(listed.AddedAt) {
+			// unregistered again while the listed message was sent
+			continue
+		}
+
+		message.SentCount++
+		if message.SentCount >= sendCount {
+			c.delete(registryMessageHash)
+			removed = append(removed, message.RegistryMessage)
+			continue
+		}
+		incremented = append(incremented, *message)
+	}
+
+	return incremented, removed, nil
+}
+
+// List returns copies of the cached messages, oldest first. Expired messages
+// are dropped before listing.
 func (c *cache) List() []*Message {
 	c.mux.Lock()
 	defer c.mux.Unlock()
 
+	c.expire()
+
 	list := []*Message{}
-	for _, message := range c.messages {
-		list = append(list, message)
+	for element := c.order.Front(); element != nil; element = element.Next() {
+		message := *element.Value.(*cacheEntry).message
+		list = append(list, &message)
 	}
+
 	return list
 }
+
+// set adds or replaces a message, moving it to the back of the eviction order.
+// The caller must hold the lock.
+func (c *cache) set(hash uint64, message *Message) {
+	c.delete(hash)
+	c.messages[hash] = c.order.PushBack(&cacheEntry{hash: hash, message: message})
+}
+
+// delete removes a message if it is present. The caller must hold the lock.
+func (c *cache) delete(hash uint64) {
+	if element, ok := c.messages[hash]; ok {
+		c.order.Remove(element)
+		delete(c.messages, hash)
+	}
+}
+
+func (c *cache) evict() {
+	if c.limits.MaxSize <= 0 || c.order.Len() <= c.limits.MaxSize {
+		return
+	}
+
+	evicted := []routingtable.RegistryMessage{}
+	for c.order.Len() > c.limits.MaxSize {
+		entry := c.order.Front().Value.(*cacheEntry)
+		c.delete(entry.hash)
+		evicted = append(evicted, entry.message.RegistryMessage)
+	}
+
+	c.logger.Info("evicted-oldest-messages", lager.Data{"count": len(evicted), "max-size": c.limits.MaxSize, "messages": evicted})
+	err := c.metronClient.IncrementCounterWithDelta(cacheEvictionsCounter, uint64(len(evicted)))
+	if err != nil {
+		c.logger.Error("failed-to-send-evictions-metric", err)
+	}
+}
+
+func (c *cache) expire() {
+	if c.limits.MaxAge <= 0 {
+		return
+	}
+
+	cutoff := c.clock.Now().Add(-c.limits.MaxAge)
+	expired := 0
+	for c.order.Len() > 0 {
+		entry := c.order.Front().Value.(*cacheEntry)
+		if entry.message.AddedAt.After(cutoff) {
+			break
+		}
+		c.delete(entry.hash)
+		expired++
+	}
+
+	if expired == 0 {
+		return
+	}
+
+	c.logger.Info("expired-messages", lager.Data{"count": expired, "max-age": c.limits.MaxAge.String()})
+	err := c.metronClient.IncrementCounterWithDelta(cacheExpirationsCounter, uint64(expired))
+	if err != nil {
+		c.logger.Error("failed-to-send-expirations-metric", err)
+	}
+}
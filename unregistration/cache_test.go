@@ -2,7 +2,10 @@ package unregistration_test
 
 import (
 	"sync"
+	"time"
 
+	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagertest"
 	"code.cloudfoundry.org/route-emitter/routingtable"
@@ -136,7 +139,7 @@ var _ = Describe("Cache", func() {
 			registryMessages := []routingtable.RegistryMessage{registryMessage1}
 
 			var wg sync.WaitGroup
-			wg.Add(3)
+			wg.Add(4)
 			go func() {
 				defer wg.Done()
 				for i := 0; i < 50; i++ {
@@ -154,10 +157,180 @@ var _ = Describe("Cache", func() {
 			go func() {
 				defer wg.Done()
 				for i := 0; i < 50; i++ {
-					cache.List()
+					for _, message := range cache.List() {
+						_ = message.SentCount
+					}
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					err := cache.IncrementSent(cache.List(), 10)
+					Expect(err).NotTo(HaveOccurred())
 				}
 			}()
 			wg.Wait()
 		})
 	})
+
+	Describe("List", func() {
+		It("returns the messages oldest first", func() {
+			Expect(cache.Add([]routingtable.RegistryMessage{registryMessage2})).To(Succeed())
+			Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1})).To(Succeed())
+
+			cachedMessages := cache.List()
+			Expect(cachedMessages).To(HaveLen(2))
+			Expect(cachedMessages[0].RegistryMessage).To(Equal(registryMessage2))
+			Expect(cachedMessages[1].RegistryMessage).To(Equal(registryMessage1))
+		})
+	})
+
+	Describe("IncrementSent", func() {
+		It("counts a send of each listed message", func() {
+			Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1, registryMessage2})).To(Succeed())
+			Expect(cache.IncrementSent(cache.List()[:1], 3)).To(Succeed())
+			Expect(cache.IncrementSent(cache.List(), 3)).To(Succeed())
+
+			cachedMessages := cache.List()
+			Expect(cachedMessages).To(HaveLen(2))
+			Expect(cachedMessages[0].SentCount).To(Equal(2))
+			Expect(cachedMessages[1].SentCount).To(Equal(1))
+		})
+
+		It("removes the messages that were sent sendCount times", func() {
+			Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1, registryMessage2})).To(Succeed())
+			Expect(cache.IncrementSent(cache.List()[:1], 2)).To(Succeed())
+			Expect(cache.IncrementSent(cache.List(), 2)).To(Succeed())
+
+			cachedMessages := cache.List()
+			Expect(cachedMessages).To(HaveLen(1))
+			Expect(cachedMessages[0].RegistryMessage).To(Equal(registryMessage2))
+			Expect(cachedMessages[0].SentCount).To(Equal(1))
+		})
+
+		It("ignores messages that are not cached", func() {
+			Expect(cache.IncrementSent([]*unregistration.Message{{RegistryMessage: registryMessage1}}, 1)).To(Succeed())
+			Expect(cache.List()).To(BeEmpty())
+		})
+
+		It("does not change the listed messages", func() {
+			Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1})).To(Succeed())
+			listed := cache.List()
+			Expect(cache.IncrementSent(listed, 3)).To(Succeed())
+
+			Expect(listed[0].SentCount).To(Equal(0))
+			Expect(cache.List()[0].SentCount).To(Equal(1))
+		})
+
+		Context("when a listed message was added again", func() {
+			var clock *fakeclock.FakeClock
+
+			BeforeEach(func() {
+				clock = fakeclock.NewFakeClock(time.Now())
+				cache = unregistration.NewBoundedCache(logger, clock, &mfakes.FakeIngressClient{}, unregistration.Limits{})
+			})
+
+			It("neither counts nor removes the new message", func() {
+				Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1})).To(Succeed())
+				listed := cache.List()
+
+				clock.Increment(time.Second)
+				Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1})).To(Succeed())
+				Expect(cache.IncrementSent(listed, 1)).To(Succeed())
+
+				cachedMessages := cache.List()
+				Expect(cachedMessages).To(HaveLen(1))
+				Expect(cachedMessages[0].SentCount).To(Equal(0))
+				Expect(cachedMessages[0].AddedAt).To(Equal(clock.Now()))
+			})
+		})
+	})
+
+	Describe("bounded cache", func() {
+		var (
+			clock            *fakeclock.FakeClock
+			fakeMetronClient *mfakes.FakeIngressClient
+			limits           unregistration.Limits
+			registryMessage3 routingtable.RegistryMessage
+		)
+
+		BeforeEach(func() {
+			clock = fakeclock.NewFakeClock(time.Now())
+			fakeMetronClient = &mfakes.FakeIngressClient{}
+			limits = unregistration.Limits{}
+			registryMessage3 = routingtable.RegistryMessageFor(routingtable.Endpoint{
+				InstanceGUID: "instance-guid-3",
+				Host:         "3.3.3.3",
+				Port:         61003,
+			}, routingtable.Route{Hostname: "host-3.example.com"}, false)
+		})
+
+		JustBeforeEach(func() {
+			cache = unregistration.NewBoundedCache(logger, clock, fakeMetronClient, limits)
+		})
+
+		It("records when each message was added", func() {
+			Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1})).To(Succeed())
+			Expect(cache.List()[0].AddedAt).To(Equal(clock.Now()))
+		})
+
+		Context("with a maximum size", func() {
+			BeforeEach(func() {
+				limits.MaxSize = 2
+			})
+
+			It("evicts the oldest messages", func() {
+				Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1, registryMessage2})).To(Succeed())
+				clock.Increment(time.Second)
+				Expect(cache.Add([]routingtable.RegistryMessage{registryMessage3})).To(Succeed())
+
+				cachedMessages := cache.List()
+				Expect(cachedMessages).To(HaveLen(2))
+				Expect(cachedMessages[0].RegistryMessage).To(Equal(registryMessage2))
+				Expect(cachedMessages[1].RegistryMessage).To(Equal(registryMessage3))
+			})
+
+			It("treats a re-added message as the newest", func() {
+				Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1, registryMessage2})).To(Succeed())
+				Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1})).To(Succeed())
+				Expect(cache.Add([]routingtable.RegistryMessage{registryMessage3})).To(Succeed())
+
+				cachedMessages := cache.List()
+				Expect(cachedMessages).To(HaveLen(2))
+				Expect(cachedMessages[0].RegistryMessage).To(Equal(registryMessage1))
+				Expect(cachedMessages[1].RegistryMessage).To(Equal(registryMessage3))
+			})
+
+			It("emits an eviction metric", func() {
+				Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1, registryMessage2, registryMessage3})).To(Succeed())
+
+				Expect(fakeMetronClient.IncrementCounterWithDeltaCallCount()).To(Equal(1))
+				name, delta := fakeMetronClient.IncrementCounterWithDeltaArgsForCall(0)
+				Expect(name).To(Equal("UnregistrationCacheEvictions"))
+				Expect(delta).To(BeEquivalentTo(1))
+			})
+		})
+
+		Context("with a maximum age", func() {
+			BeforeEach(func() {
+				limits.MaxAge = time.Minute
+			})
+
+			It("expires messages older than the maximum age", func() {
+				Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1})).To(Succeed())
+				clock.Increment(30 * time.Second)
+				Expect(cache.Add([]routingtable.RegistryMessage{registryMessage2})).To(Succeed())
+
+				clock.Increment(30 * time.Second)
+				cachedMessages := cache.List()
+				Expect(cachedMessages).To(HaveLen(1))
+				Expect(cachedMessages[0].RegistryMessage).To(Equal(registryMessage2))
+
+				Expect(fakeMetronClient.IncrementCounterWithDeltaCallCount()).To(Equal(1))
+				name, delta := fakeMetronClient.IncrementCounterWithDeltaArgsForCall(0)
+				Expect(name).To(Equal("UnregistrationCacheExpirations"))
+				Expect(delta).To(BeEquivalentTo(1))
+			})
+		})
+	})
 })
@@ -20,6 +20,18 @@ type FakeCache struct {
 	addReturnsOnCall map[int]struct {
 		result1 error
 	}
+	IncrementSentStub        func([]*unregistration.Message, int) error
+	incrementSentMutex       sync.RWMutex
+	incrementSentArgsForCall []struct {
+		arg1 []*unregistration.Message
+		arg2 int
+	}
+	incrementSentReturns struct {
+		result1 error
+	}
+	incrementSentReturnsOnCall map[int]struct {
+		result1 error
+	}
 	ListStub        func() []*unregistration.Message
 	listMutex       sync.RWMutex
 	listArgsForCall []struct {
@@ -110,6 +122,72 @@ func (fake *FakeCache) AddReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeCache) IncrementSent(arg1 []*unregistration.Message, arg2 int) error {
+	var arg1Copy []*unregistration.Message
+	if arg1 != nil {
+		arg1Copy = make([]*unregistration.Message, len(arg1))
+		copy(arg1Copy, arg1)
+	}
+	fake.incrementSentMutex.Lock()
+	ret, specificReturn := fake.incrementSentReturnsOnCall[len(fake.incrementSentArgsForCall)]
+	fake.incrementSentArgsForCall = append(fake.incrementSentArgsForCall, struct {
+		arg1 []*unregistration.Message
+		arg2 int
+	}{arg1Copy, arg2})
+	fake.recordInvocation("IncrementSent", []interface{}{arg1Copy, arg2})
+	fake.incrementSentMutex.Unlock()
+	if fake.IncrementSentStub != nil {
+		return fake.IncrementSentStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.incrementSentReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeCache) IncrementSentCallCount() int {
+	fake.incrementSentMutex.RLock()
+	defer fake.incrementSentMutex.RUnlock()
+	return len(fake.incrementSentArgsForCall)
+}
+
+func (fake *FakeCache) IncrementSentCalls(stub func([]*unregistration.Message, int) error) {
+	fake.incrementSentMutex.Lock()
+	defer fake.incrementSentMutex.Unlock()
+	fake.IncrementSentStub = stub
+}
+
+func (fake *FakeCache) IncrementSentArgsForCall(i int) ([]*unregistration.Message, int) {
+	fake.incrementSentMutex.RLock()
+	defer fake.incrementSentMutex.RUnlock()
+	argsForCall := fake.incrementSentArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeCache) IncrementSentReturns(result1 error) {
+	fake.incrementSentMutex.Lock()
+	defer fake.incrementSentMutex.Unlock()
+	fake.IncrementSentStub = nil
+	fake.incrementSentReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCache) IncrementSentReturnsOnCall(i int, result1 error) {
+	fake.incrementSentMutex.Lock()
+	defer fake.incrementSentMutex.Unlock()
+	fake.IncrementSentStub = nil
+	if fake.incrementSentReturnsOnCall == nil {
+		fake.incrementSentReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.incrementSentReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeCache) List() []*unregistration.Message {
 	fake.listMutex.Lock()
 	ret, specificReturn := fake.listReturnsOnCall[len(fake.listArgsForCall)]
@@ -232,6 +310,8 @@ func (fake *FakeCache) Invocations() map[string][][]interface{} {
 	defer fake.invocationsMutex.RUnlock()
 	fake.addMutex.RLock()
 	defer fake.addMutex.RUnlock()
+	fake.incrementSentMutex.RLock()
+	defer fake.incrementSentMutex.RUnlock()
 	fake.listMutex.RLock()
 	defer fake.listMutex.RUnlock()
 	fake.removeMutex.RLock()
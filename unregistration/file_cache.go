@@ -0,0 +1,322 @@
+package unregistration
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+	"github.com/mitchellh/hashstructure"
+)
+
+const DefaultCompactionInterval = time.Minute
+
+const (
+	recordAdd    = "add"
+	recordRemove = "remove"
+	recordSent   = "sent"
+)
+
+type record struct {
+	Op              string                       `json:"op"`
+	RegistryMessage routingtable.RegistryMessage `json:"message"`
+	SentCount       int                          `json:"sent_count,omitempty"`
+	AddedAt         time.Time                    `json:"added_at"`
+}
+
+// FileCache is a Cache that survives restarts. Every Add, Remove and
+// IncrementSent is appended to a newline-delimited JSON journal, which is
+// replayed on start and periodically rewritten with the current messages and
+// their SentCount.
+type FileCache struct {
+	*cache
+	path               string
+	journal            *os.File
+	journalMux         *sync.Mutex
+	clock              clock.Clock
+	compactionInterval time.Duration
+}
+
+func NewFileCache(
+	logger lager.Logger,
+	clock clock.Clock,
+	metronClient loggingclient.IngressClient,
+	path string,
+	compactionInterval time.Duration,
+	limits Limits,
+) (*FileCache, error) {
+	if compactionInterval <= 0 {
+		compactionInterval = DefaultCompactionInterval
+	}
+
+	c := &FileCache{
+		cache:              newCache(logger, clock, metronClient, limits),
+		path:               path,
+		journalMux:         &sync.Mutex{},
+		clock:              clock,
+		compactionInterval: compactionInterval,
+	}
+
+	err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.Compact()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *FileCache) Add(registryMessages []routingtable.RegistryMessage) error {
+	c.journalMux.Lock()
+	defer c.journalMux.Unlock()
+
+	err := c.cache.Add(registryMessages)
+	if err != nil {
+		return err
+	}
+	return c.append(recordAdd, registryMessages)
+}
+
+func (c *FileCache) Remove(registryMessages []routingtable.RegistryMessage) error {
+	c.journalMux.Lock()
+	defer c.journalMux.Unlock()
+
+	err := c.cache.Remove(registryMessages)
+	if err != nil {
+		return err
+	}
+	return c.append(recordRemove, registryMessages)
+}
+
+func (c *FileCache) IncrementSent(messages []*Message, sendCount int) error {
+	c.journalMux.Lock()
+	defer c.journalMux.Unlock()
+
+	incremented, removed, err := c.cache.incrementSent(messages, sendCount)
+	if err != nil {
+		return err
+	}
+
+	now := c.clock.Now()
+	records := make([]record, 0, len(incremented)+len(removed))
+	for _, message := range incremented {
+		records = append(records, record{
+			Op:              recordSent,
+			RegistryMessage: message.RegistryMessage,
+			SentCount:       message.SentCount,
+			AddedAt:         message.AddedAt,
+		})
+	}
+	for _, registryMessage := range removed {
+		records = append(records, record{Op: recordRemove, RegistryMessage: registryMessage, AddedAt: now})
+	}
+	return c.appendRecords(records)
+}
+
+// Compact rewrites the journal so that it only contains the messages currently
+// in the cache, along with how many times each has been sent.
+func (c *FileCache) Compact() error {
+	c.journalMux.Lock()
+	defer c.journalMux.Unlock()
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	writer := bufio.NewWriter(tmpFile)
+	encoder := json.NewEncoder(writer)
+	messages := c.cache.List()
+	for _, message := range messages {
+		err = encoder.Encode(record{
+			Op:              recordAdd,
+			RegistryMessage: message.RegistryMessage,
+			SentCount:       message.SentCount,
+			AddedAt:         message.AddedAt,
+		})
+		if err != nil {
+			tmpFile.Close()
+			return err
+		}
+	}
+
+	err = writer.Flush()
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if c.journal != nil {
+		c.journal.Close()
+		c.journal = nil
+	}
+
+	err = os.Rename(tmpFile.Name(), c.path)
+	if err != nil {
+		return err
+	}
+
+	c.journal, err = os.OpenFile(c.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	c.logger.Debug("compacted", lager.Data{"num-messages": len(messages)})
+	return nil
+}
+
+func (c *FileCache) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	logger := c.logger.Session("compactor")
+	logger.Info("starting", lager.Data{"path": c.path, "interval": c.compactionInterval.String()})
+	close(ready)
+	defer logger.Info("exiting")
+
+	ticker := c.clock.NewTicker(c.compactionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-signals:
+			logger.Info("stopping")
+			err := c.Compact()
+			if err != nil {
+				logger.Error("failed-to-compact", err)
+			}
+			c.close()
+			return nil
+		case <-ticker.C():
+			err := c.Compact()
+			if err != nil {
+				logger.Error("failed-to-compact", err)
+			}
+		}
+	}
+}
+
+func (c *FileCache) load() error {
+	file, err := os.Open(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	messages := map[uint64]*Message{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var r record
+		err := json.Unmarshal(scanner.Bytes(), &r)
+		if err != nil {
+			// most likely a partial write from a crash, the rest of the journal is
+			// still usable
+			c.logger.Error("skipping-invalid-record", err, lager.Data{"line": line})
+			continue
+		}
+
+		hash, err := hashstructure.Hash(r.RegistryMessage, nil)
+		if err != nil {
+			return err
+		}
+
+		switch r.Op {
+		case recordAdd:
+			addedAt := r.AddedAt
+			if addedAt.IsZero() {
+				addedAt = c.clock.Now()
+			}
+			messages[hash] = &Message{
+				RegistryMessage: r.RegistryMessage,
+				SentCount:       r.SentCount,
+				AddedAt:         addedAt,
+			}
+		case recordRemove:
+			delete(messages, hash)
+		case recordSent:
+			if message, ok := messages[hash]; ok {
+				message.SentCount = r.SentCount
+			}
+		default:
+			c.logger.Info("skipping-unknown-record", lager.Data{"line": line, "op": r.Op})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// restore the eviction order
+	hashes := make([]uint64, 0, len(messages))
+	for hash := range messages {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return messages[hashes[i]].AddedAt.Before(messages[hashes[j]].AddedAt)
+	})
+	for _, hash := range hashes {
+		c.set(hash, messages[hash])
+	}
+	c.evict()
+
+	c.logger.Info("loaded", lager.Data{"path": c.path, "num-messages": c.order.Len()})
+	return nil
+}
+
+func (c *FileCache) append(op string, registryMessages []routingtable.RegistryMessage) error {
+	now := c.clock.Now()
+	records := make([]record, 0, len(registryMessages))
+	for _, registryMessage := range registryMessages {
+		records = append(records, record{Op: op, RegistryMessage: registryMessage, AddedAt: now})
+	}
+	return c.appendRecords(records)
+}
+
+func (c *FileCache) appendRecords(records []record) error {
+	if c.journal == nil || len(records) == 0 {
+		return nil
+	}
+
+	writer := bufio.NewWriter(c.journal)
+	encoder := json.NewEncoder(writer)
+	for _, r := range records {
+		err := encoder.Encode(r)
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+func (c *FileCache) close() {
+	c.journalMux.Lock()
+	defer c.journalMux.Unlock()
+
+	if c.journal != nil {
+		c.journal.Close()
+		c.journal = nil
+	}
+}
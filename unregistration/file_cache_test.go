@@ -0,0 +1,187 @@
+package unregistration_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+	"code.cloudfoundry.org/route-emitter/unregistration"
+	"github.com/tedsuo/ifrit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FileCache", func() {
+	var (
+		logger                             *lagertest.TestLogger
+		clock                              *fakeclock.FakeClock
+		tmpDir, cachePath                  string
+		registryMessage1, registryMessage2 routingtable.RegistryMessage
+		compactionInterval                 time.Duration
+		fakeMetronClient                   *mfakes.FakeIngressClient
+	)
+
+	newCache := func() *unregistration.FileCache {
+		cache, err := unregistration.NewFileCache(logger, clock, fakeMetronClient, cachePath, compactionInterval, unregistration.Limits{})
+		Expect(err).NotTo(HaveOccurred())
+		return cache
+	}
+
+	registryMessages := func(messages []*unregistration.Message) []routingtable.RegistryMessage {
+		result := []routingtable.RegistryMessage{}
+		for _, message := range messages {
+			result = append(result, message.RegistryMessage)
+		}
+		return result
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "unregistration-cache")
+		Expect(err).NotTo(HaveOccurred())
+		cachePath = filepath.Join(tmpDir, "cache.json")
+
+		logger = lagertest.NewTestLogger("test")
+		clock = fakeclock.NewFakeClock(time.Now())
+		compactionInterval = time.Minute
+		fakeMetronClient = &mfakes.FakeIngressClient{}
+
+		registryMessage1 = routingtable.RegistryMessageFor(routingtable.Endpoint{
+			InstanceGUID: "instance-guid-1",
+			Host:         "1.1.1.1",
+			Port:         61001,
+		}, routingtable.Route{Hostname: "host-1.example.com"}, false)
+		registryMessage2 = routingtable.RegistryMessageFor(routingtable.Endpoint{
+			InstanceGUID: "instance-guid-2",
+			Host:         "2.2.2.2",
+			Port:         61002,
+		}, routingtable.Route{Hostname: "host-2.example.com"}, false)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("starts empty when the file does not exist", func() {
+		cache := newCache()
+		Expect(cache.List()).To(BeEmpty())
+		Expect(cachePath).To(BeAnExistingFile())
+	})
+
+	It("restores added messages on restart", func() {
+		cache := newCache()
+		Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1, registryMessage2})).To(Succeed())
+
+		restored := newCache()
+		Expect(registryMessages(restored.List())).To(ConsistOf(registryMessage1, registryMessage2))
+	})
+
+	It("does not restore removed messages", func() {
+		cache := newCache()
+		Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1, registryMessage2})).To(Succeed())
+		Expect(cache.Remove([]routingtable.RegistryMessage{registryMessage1})).To(Succeed())
+
+		restored := newCache()
+		Expect(registryMessages(restored.List())).To(ConsistOf(registryMessage2))
+	})
+
+	It("restores the sent count", func() {
+		cache := newCache()
+		Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1, registryMessage2})).To(Succeed())
+		Expect(cache.IncrementSent(cache.List()[:1], 3)).To(Succeed())
+		Expect(cache.IncrementSent(cache.List()[:1], 3)).To(Succeed())
+
+		restored := newCache()
+		messages := restored.List()
+		Expect(messages).To(HaveLen(2))
+		Expect(messages[0].RegistryMessage).To(Equal(registryMessage1))
+		Expect(messages[0].SentCount).To(Equal(2))
+		Expect(messages[1].SentCount).To(Equal(0))
+	})
+
+	It("restores the sent count after a compaction", func() {
+		cache := newCache()
+		Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1})).To(Succeed())
+		Expect(cache.IncrementSent(cache.List(), 3)).To(Succeed())
+		Expect(cache.Compact()).To(Succeed())
+		Expect(cache.IncrementSent(cache.List(), 3)).To(Succeed())
+
+		restored := newCache()
+		messages := restored.List()
+		Expect(messages).To(HaveLen(1))
+		Expect(messages[0].SentCount).To(Equal(2))
+	})
+
+	It("does not restore messages that were sent often enough", func() {
+		cache := newCache()
+		Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1, registryMessage2})).To(Succeed())
+		Expect(cache.IncrementSent(cache.List()[:1], 1)).To(Succeed())
+
+		restored := newCache()
+		Expect(registryMessages(restored.List())).To(ConsistOf(registryMessage2))
+	})
+
+	It("only keeps current messages in the file after compaction", func() {
+		cache := newCache()
+		Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1, registryMessage2})).To(Succeed())
+		Expect(cache.Remove([]routingtable.RegistryMessage{registryMessage1, registryMessage2})).To(Succeed())
+		Expect(cache.Compact()).To(Succeed())
+
+		contents, err := ioutil.ReadFile(cachePath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(contents).To(BeEmpty())
+	})
+
+	Context("when the file contains a partially written record", func() {
+		BeforeEach(func() {
+			cache := newCache()
+			Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1})).To(Succeed())
+
+			file, err := os.OpenFile(cachePath, os.O_WRONLY|os.O_APPEND, 0600)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = file.WriteString(`{"op":"add","mess`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(file.Close()).To(Succeed())
+		})
+
+		It("skips the record and loads the rest", func() {
+			restored := newCache()
+			Expect(registryMessages(restored.List())).To(ConsistOf(registryMessage1))
+		})
+	})
+
+	Describe("Run", func() {
+		var (
+			cache   *unregistration.FileCache
+			process ifrit.Process
+		)
+
+		BeforeEach(func() {
+			cache = newCache()
+			process = ifrit.Invoke(cache)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+		})
+
+		It("compacts the file on every interval", func() {
+			Expect(cache.Add([]routingtable.RegistryMessage{registryMessage1})).To(Succeed())
+			Expect(cache.Remove([]routingtable.RegistryMessage{registryMessage1})).To(Succeed())
+
+			clock.WaitForWatcherAndIncrement(compactionInterval)
+			Eventually(func() []byte {
+				contents, err := ioutil.ReadFile(cachePath)
+				Expect(err).NotTo(HaveOccurred())
+				return contents
+			}).Should(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,22 @@
+package unregistration
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// NewHandler returns an http.Handler that lists the pending unregistrations
+// as JSON, oldest first.
+func NewHandler(logger lager.Logger, cache Cache) http.Handler {
+	logger = logger.Session("unregistration-cache-handler")
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		messages := cache.List()
+		resp.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(resp).Encode(messages)
+		if err != nil {
+			logger.Error("failed-to-encode-messages", err)
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package unregistration_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+	"code.cloudfoundry.org/route-emitter/unregistration"
+	"code.cloudfoundry.org/route-emitter/unregistration/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handler", func() {
+	var (
+		cache    *fakes.FakeCache
+		handler  http.Handler
+		recorder *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		cache = &fakes.FakeCache{}
+		handler = unregistration.NewHandler(lagertest.NewTestLogger("test"), cache)
+		recorder = httptest.NewRecorder()
+	})
+
+	It("returns the pending unregistrations as json", func() {
+		registryMessage := routingtable.RegistryMessageFor(routingtable.Endpoint{
+			InstanceGUID: "instance-guid-1",
+			Host:         "1.1.1.1",
+			Port:         61001,
+		}, routingtable.Route{Hostname: "host-1.example.com"}, false)
+		cache.ListReturns([]*unregistration.Message{
+			{RegistryMessage: registryMessage, SentCount: 2},
+		})
+
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/unregistrations", nil))
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+
+		var messages []*unregistration.Message
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &messages)).To(Succeed())
+		Expect(messages).To(HaveLen(1))
+		Expect(messages[0].RegistryMessage).To(Equal(registryMessage))
+		Expect(messages[0].SentCount).To(Equal(2))
+	})
+})
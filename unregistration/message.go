@@ -1,8 +1,13 @@
 package unregistration
 
-import "code.cloudfoundry.org/route-emitter/routingtable"
+import (
+	"time"
+
+	"code.cloudfoundry.org/route-emitter/routingtable"
+)
 
 type Message struct {
-	RegistryMessage routingtable.RegistryMessage
-	SentCount       int
+	RegistryMessage routingtable.RegistryMessage `json:"registry_message"`
+	SentCount       int                          `json:"sent_count"`
+	AddedAt         time.Time                    `json:"added_at"`
 }
@@ -2,21 +2,46 @@ package unregistration
 
 import (
 	"os"
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/clock"
+	loggingclient "code.cloudfoundry.org/diego-logging-client"
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/route-emitter/emitter"
 	"code.cloudfoundry.org/route-emitter/routingtable"
+	"github.com/mitchellh/hashstructure"
+)
+
+const (
+	cacheSizeMetric            = "UnregistrationCacheSize"
+	unregistrationsSentCounter = "UnregistrationMessagesSent"
+
+	internalCacheSizeMetric            = "InternalUnregistrationCacheSize"
+	internalUnregistrationsSentCounter = "InternalUnregistrationMessagesSent"
 )
 
 type Sender struct {
-	logger      lager.Logger
-	clock       clock.Clock
-	cache       Cache
-	natsEmitter emitter.NATSEmitter
-	interval    time.Duration
-	sendCount   int
+	logger       lager.Logger
+	clock        clock.Clock
+	cache        Cache
+	natsEmitter  emitter.NATSEmitter
+	metronClient loggingclient.IngressClient
+
+	// settings are shared by the copies of the sender so that they can be
+	// changed while it runs
+	settings *senderSettings
+
+	// internal senders emit service discovery unregistrations instead of
+	// gorouter ones
+	internal bool
+}
+
+type senderSettings struct {
+	lock      sync.Mutex
+	interval  time.Duration
+	sendCount int
+	changed   chan struct{}
 }
 
 func NewSender(
@@ -24,47 +49,172 @@ func NewSender(
 	clock clock.Clock,
 	cache Cache,
 	natsEmitter emitter.NATSEmitter,
+	metronClient loggingclient.IngressClient,
 	interval time.Duration,
 	sendCount int,
 ) Sender {
 	return Sender{
-		logger:      logger.Session("unregistration-sender"),
-		clock:       clock,
-		cache:       cache,
-		natsEmitter: natsEmitter,
-		interval:    interval,
-		sendCount:   sendCount,
+		logger:       logger.Session("unregistration-sender"),
+		clock:        clock,
+		cache:        cache,
+		natsEmitter:  natsEmitter,
+		metronClient: metronClient,
+		settings: &senderSettings{
+			interval:  interval,
+			sendCount: sendCount,
+			changed:   make(chan struct{}, 1),
+		},
 	}
 }
 
+// NewInternalSender returns a Sender that repeats the unregistrations of
+// internal routes, which are consumed by service discovery.
+func NewInternalSender(
+	logger lager.Logger,
+	clock clock.Clock,
+	cache Cache,
+	natsEmitter emitter.NATSEmitter,
+	metronClient loggingclient.IngressClient,
+	interval time.Duration,
+	sendCount int,
+) Sender {
+	sender := NewSender(logger, clock, cache, natsEmitter, metronClient, interval, sendCount)
+	sender.logger = logger.Session("internal-unregistration-sender")
+	sender.internal = true
+	return sender
+}
+
 func (s Sender) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
 	s.logger.Info("starting")
 	close(ready)
 	defer s.logger.Info("exiting")
 
-	sendTicker := s.clock.NewTicker(s.interval)
-	defer sendTicker.Stop()
+	interval, _ := s.Settings()
+	sendTicker := s.clock.NewTicker(interval)
+	defer func() { sendTicker.Stop() }()
 
 	for {
 		select {
 		case <-signals:
 			s.logger.Info("stopping")
 			return nil
-
 		case <-sendTicker.C():
-			messages := s.cache.List()
-			if len(messages) > 0 {
-				s.logger.Debug("messages", lager.Data{"cache": messages})
+			s.send()
+		case <-s.settings.changed:
+			newInterval, sendCount := s.Settings()
+			s.logger.Info("settings-changed", lager.Data{"interval": newInterval.String(), "send-count": sendCount})
+			if newInterval != interval {
+				interval = newInterval
+				sendTicker.Stop()
+				sendTicker = s.clock.NewTicker(interval)
 			}
-			for _, message := range messages {
-				s.natsEmitter.Emit(routingtable.MessagesToEmit{
-					UnregistrationMessages: []routingtable.RegistryMessage{message.RegistryMessage},
-				})
-				message.SentCount++
-				if message.SentCount == s.sendCount {
-					s.cache.Remove([]routingtable.RegistryMessage{message.RegistryMessage})
-				}
+		}
+	}
+}
+
+// Settings returns how often the cached unregistrations are sent and how many
+// times each of them is sent.
+func (s Sender) Settings() (time.Duration, int) {
+	s.settings.lock.Lock()
+	defer s.settings.lock.Unlock()
+	return s.settings.interval, s.settings.sendCount
+}
+
+// Reconfigure changes how often the cached unregistrations are sent and how
+// many times each of them is sent. Messages that were already sent at least
+// sendCount times are removed on the next send.
+func (s Sender) Reconfigure(interval time.Duration, sendCount int) {
+	s.settings.lock.Lock()
+	s.settings.interval = interval
+	s.settings.sendCount = sendCount
+	s.settings.lock.Unlock()
+
+	select {
+	case s.settings.changed <- struct{}{}:
+	default:
+	}
+}
+
+// send emits every cached message in a single batch so that the emitter can
+// publish them in parallel. Only the messages that were published count as
+// sent, the others are retried on the next tick.
+func (s Sender) send() {
+	messages := s.cache.List()
+	if len(messages) == 0 {
+		s.sendMetrics(0)
+		return
+	}
+
+	s.logger.Debug("messages", lager.Data{"cache": messages})
+	messagesToEmit := routingtable.MessagesToEmit{}
+	for _, message := range messages {
+		if s.internal {
+			messagesToEmit.InternalUnregistrationMessages = append(messagesToEmit.InternalUnregistrationMessages, message.RegistryMessage)
+		} else {
+			messagesToEmit.UnregistrationMessages = append(messagesToEmit.UnregistrationMessages, message.RegistryMessage)
+		}
+	}
+
+	failed := map[uint64]bool{}
+	failedMessages, err := s.natsEmitter.EmitEach(messagesToEmit)
+	if err != nil {
+		s.logger.Error("failed-to-emit-unregistrations", err, lager.Data{"num-messages": len(messages), "num-failed": len(failedMessages)})
+		if len(failedMessages) == 0 {
+			// the emitter did not say which messages failed
+			s.sendMetrics(0)
+			return
+		}
+		for _, message := range failedMessages {
+			hash, err := hashstructure.Hash(message, nil)
+			if err != nil {
+				s.logger.Error("failed-to-hash-message", err)
+				s.sendMetrics(0)
+				return
 			}
+			failed[hash] = true
+		}
+	}
+
+	sent := []*Message{}
+	for _, message := range messages {
+		hash, err := hashstructure.Hash(message.RegistryMessage, nil)
+		if err != nil || failed[hash] {
+			continue
+		}
+		sent = append(sent, message)
+	}
+
+	if len(sent) == 0 {
+		s.sendMetrics(0)
+		return
+	}
+
+	// messages that were sent often enough are removed by the cache, unless
+	// they were unregistered again while being sent
+	_, sendCount := s.Settings()
+	err = s.cache.IncrementSent(sent, sendCount)
+	if err != nil {
+		s.logger.Error("failed-to-count-sent-messages", err, lager.Data{"num-messages": len(sent)})
+	}
+
+	s.sendMetrics(len(sent))
+}
+
+func (s Sender) sendMetrics(sent int) {
+	sizeMetric, sentCounter := cacheSizeMetric, unregistrationsSentCounter
+	if s.internal {
+		sizeMetric, sentCounter = internalCacheSizeMetric, internalUnregistrationsSentCounter
+	}
+
+	if sent > 0 {
+		err := s.metronClient.IncrementCounterWithDelta(sentCounter, uint64(sent))
+		if err != nil {
+			s.logger.Error("failed-to-send-unregistrations-sent-metric", err)
 		}
 	}
+
+	err := s.metronClient.SendMetric(sizeMetric, len(s.cache.List()))
+	if err != nil {
+		s.logger.Error("failed-to-send-cache-size-metric", err)
+	}
 }
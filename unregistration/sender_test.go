@@ -1,38 +1,69 @@
 package unregistration_test
 
 import (
+	"errors"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/nats-io/nats.go"
 	"github.com/tedsuo/ifrit"
 
 	"code.cloudfoundry.org/clock/fakeclock"
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
 	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/route-emitter/diegonats"
+	"code.cloudfoundry.org/route-emitter/emitter"
 	"code.cloudfoundry.org/route-emitter/emitter/fakes"
 	"code.cloudfoundry.org/route-emitter/routingtable"
 	"code.cloudfoundry.org/route-emitter/unregistration"
+	"code.cloudfoundry.org/workpool"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 )
 
 var _ = Describe("Sender", func() {
 	var (
 		sender        ifrit.Runner
 		senderProcess ifrit.Process
-		natsEmitter   *fakes.FakeNATSEmitter
+		natsClient    *diegonats.FakeNATSClient
+		natsEmitter   emitter.NATSEmitter
 		cache         unregistration.Cache
 		clock         *fakeclock.FakeClock
 		sendInterval  time.Duration
+
+		fakeMetronClient *mfakes.FakeIngressClient
+		internal         bool
+		senderLogger     *lagertest.TestLogger
 	)
 
+	unregistrationCount := func() int {
+		return len(natsClient.PublishedMessages("router.unregister"))
+	}
+
 	BeforeEach(func() {
 		logger := lagertest.NewTestLogger("sender")
 		cache = unregistration.NewCache(logger)
-		natsEmitter = &fakes.FakeNATSEmitter{}
+		natsClient = diegonats.NewFakeClient()
+		fakeMetronClient = &mfakes.FakeIngressClient{}
+		workPool, err := workpool.NewWorkPool(2)
+		Expect(err).NotTo(HaveOccurred())
+		natsEmitter = emitter.NewNATSEmitter(natsClient, workPool, logger, fakeMetronClient, false)
 		clock = fakeclock.NewFakeClock(time.Now())
 		sendInterval = 500 * time.Millisecond
-		sender = unregistration.NewSender(logger, clock, cache, natsEmitter, sendInterval, 3)
+		internal = false
+	})
+
+	JustBeforeEach(func() {
+		senderLogger = lagertest.NewTestLogger("sender")
+		if internal {
+			sender = unregistration.NewInternalSender(senderLogger, clock, cache, natsEmitter, fakeMetronClient, sendInterval, 3)
+		} else {
+			sender = unregistration.NewSender(senderLogger, clock, cache, natsEmitter, fakeMetronClient, sendInterval, 3)
+		}
 		senderProcess = ifrit.Background(sender)
 	})
 
@@ -77,45 +108,239 @@ var _ = Describe("Sender", func() {
 
 		It("emits unregistration for each message the required number of times", func() {
 			clock.WaitForWatcherAndIncrement(sendInterval)
-			Eventually(natsEmitter.EmitCallCount).Should(Equal(2))
+			Eventually(unregistrationCount).Should(Equal(2))
 
 			clock.WaitForWatcherAndIncrement(sendInterval)
-			Eventually(natsEmitter.EmitCallCount).Should(Equal(4))
+			Eventually(unregistrationCount).Should(Equal(4))
 
 			clock.WaitForWatcherAndIncrement(sendInterval)
-			Eventually(natsEmitter.EmitCallCount).Should(Equal(6))
+			Eventually(unregistrationCount).Should(Equal(6))
 
 			clock.WaitForWatcherAndIncrement(sendInterval)
-			Consistently(natsEmitter.EmitCallCount).Should(Equal(6))
+			Consistently(unregistrationCount).Should(Equal(6))
+		})
+
+		It("emits the number of messages sent and the cache size", func() {
+			clock.WaitForWatcherAndIncrement(sendInterval)
+			Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(1))
+
+			Expect(fakeMetronClient.IncrementCounterWithDeltaCallCount()).To(Equal(2))
+			name, delta := fakeMetronClient.IncrementCounterWithDeltaArgsForCall(1)
+			Expect(name).To(Equal("UnregistrationMessagesSent"))
+			Expect(delta).To(BeEquivalentTo(2))
+
+			name, value := fakeMetronClient.SendMetricArgsForCall(0)
+			Expect(name).To(Equal("UnregistrationCacheSize"))
+			Expect(value).To(Equal(2))
+		})
+
+		Context("when sending through a fake emitter", func() {
+			var fakeEmitter *fakes.FakeNATSEmitter
+
+			BeforeEach(func() {
+				fakeEmitter = &fakes.FakeNATSEmitter{}
+				natsEmitter = fakeEmitter
+			})
+
+			It("batches all messages into a single emit", func() {
+				clock.WaitForWatcherAndIncrement(sendInterval)
+				Eventually(fakeEmitter.EmitEachCallCount).Should(Equal(1))
+
+				messagesToEmit := fakeEmitter.EmitEachArgsForCall(0)
+				Expect(messagesToEmit.UnregistrationMessages).To(ConsistOf(
+					routingtable.RegistryMessageFor(endpoint1, route1, false),
+					routingtable.RegistryMessageFor(endpoint2, route2, false),
+				))
+				Expect(messagesToEmit.RegistrationMessages).To(BeEmpty())
+			})
+
+			It("keeps a message that is unregistered again while it is sent", func() {
+				message1 := routingtable.RegistryMessageFor(endpoint1, route1, false)
+				fakeEmitter.EmitEachStub = func(routingtable.MessagesToEmit) ([]routingtable.RegistryMessage, error) {
+					if fakeEmitter.EmitEachCallCount() == 3 {
+						Expect(cache.Add([]routingtable.RegistryMessage{message1})).To(Succeed())
+					}
+					return nil, nil
+				}
+
+				for i := 1; i <= 3; i++ {
+					clock.WaitForWatcherAndIncrement(sendInterval)
+					Eventually(fakeEmitter.EmitEachCallCount).Should(Equal(i))
+				}
+
+				Eventually(func() int { return len(cache.List()) }).Should(Equal(1))
+				cachedMessages := cache.List()
+				Expect(cachedMessages[0].RegistryMessage).To(Equal(message1))
+				Expect(cachedMessages[0].SentCount).To(Equal(0))
+			})
+		})
+
+		Context("when publishing fails", func() {
+			var failing, attempts int32
+
+			BeforeEach(func() {
+				atomic.StoreInt32(&failing, 1)
+				atomic.StoreInt32(&attempts, 0)
+				natsClient.WhenPublishing("router.unregister", func(*nats.Msg) error {
+					atomic.AddInt32(&attempts, 1)
+					if atomic.LoadInt32(&failing) == 1 {
+						return errors.New("nats is down")
+					}
+					return nil
+				})
+			})
+
+			It("does not count the failed send", func() {
+				clock.WaitForWatcherAndIncrement(sendInterval)
+				Eventually(func() int32 { return atomic.LoadInt32(&attempts) }).Should(BeEquivalentTo(2))
+				Expect(unregistrationCount()).To(Equal(0))
+				atomic.StoreInt32(&failing, 0)
+
+				clock.WaitForWatcherAndIncrement(sendInterval)
+				Eventually(unregistrationCount).Should(Equal(2))
+
+				clock.WaitForWatcherAndIncrement(sendInterval)
+				Eventually(unregistrationCount).Should(Equal(4))
+
+				// the failed send did not count, so a third successful one is needed
+				clock.WaitForWatcherAndIncrement(sendInterval)
+				Eventually(unregistrationCount).Should(Equal(6))
+
+				clock.WaitForWatcherAndIncrement(sendInterval)
+				Consistently(unregistrationCount).Should(Equal(6))
+			})
+		})
+
+		Context("when publishing one of the messages fails", func() {
+			var failing int32
+
+			BeforeEach(func() {
+				atomic.StoreInt32(&failing, 1)
+				natsClient.WhenPublishing("router.unregister", func(msg *nats.Msg) error {
+					if atomic.LoadInt32(&failing) == 1 && strings.Contains(string(msg.Data), endpoint1.Host) {
+						return errors.New("message too large")
+					}
+					return nil
+				})
+			})
+
+			It("counts the other messages as sent", func() {
+				publishedTo := func(host string) func() int {
+					return func() int {
+						count := 0
+						for _, msg := range natsClient.PublishedMessages("router.unregister") {
+							if strings.Contains(string(msg.Data), host) {
+								count++
+							}
+						}
+						return count
+					}
+				}
+
+				for i := 1; i <= 3; i++ {
+					clock.WaitForWatcherAndIncrement(sendInterval)
+					Eventually(publishedTo(endpoint2.Host)).Should(Equal(i))
+				}
+				Expect(publishedTo(endpoint1.Host)()).To(Equal(0))
+				Eventually(cache.List).Should(HaveLen(1))
+				Expect(cache.List()[0].RegistryMessage).To(Equal(routingtable.RegistryMessageFor(endpoint1, route1, false)))
+				Expect(cache.List()[0].SentCount).To(Equal(0))
+
+				atomic.StoreInt32(&failing, 0)
+				for i := 1; i <= 3; i++ {
+					clock.WaitForWatcherAndIncrement(sendInterval)
+					Eventually(publishedTo(endpoint1.Host)).Should(Equal(i))
+				}
+				Eventually(cache.List).Should(BeEmpty())
+				Expect(publishedTo(endpoint2.Host)()).To(Equal(3))
+			})
+		})
+
+		Context("when the sender is for internal routes", func() {
+			BeforeEach(func() {
+				workPool, err := workpool.NewWorkPool(2)
+				Expect(err).NotTo(HaveOccurred())
+				natsEmitter = emitter.NewNATSEmitter(natsClient, workPool, lagertest.NewTestLogger("sender"), fakeMetronClient, true)
+				internal = true
+			})
+
+			It("emits service discovery unregistrations the required number of times", func() {
+				internalUnregistrationCount := func() int {
+					return len(natsClient.PublishedMessages("service-discovery.unregister"))
+				}
+
+				for i := 1; i <= 3; i++ {
+					clock.WaitForWatcherAndIncrement(sendInterval)
+					Eventually(internalUnregistrationCount).Should(Equal(2 * i))
+				}
+
+				clock.WaitForWatcherAndIncrement(sendInterval)
+				Consistently(internalUnregistrationCount).Should(Equal(6))
+				Expect(unregistrationCount()).To(Equal(0))
+			})
+
+			It("emits the internal metrics", func() {
+				clock.WaitForWatcherAndIncrement(sendInterval)
+				Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(1))
+
+				// the emitter counts http and internal messages before the sender
+				Expect(fakeMetronClient.IncrementCounterWithDeltaCallCount()).To(Equal(3))
+				name, delta := fakeMetronClient.IncrementCounterWithDeltaArgsForCall(2)
+				Expect(name).To(Equal("InternalUnregistrationMessagesSent"))
+				Expect(delta).To(BeEquivalentTo(2))
+
+				name, value := fakeMetronClient.SendMetricArgsForCall(0)
+				Expect(name).To(Equal("InternalUnregistrationCacheSize"))
+				Expect(value).To(Equal(2))
+			})
+		})
+
+		Context("when the sender is reconfigured", func() {
+			It("sends at the new interval, the new number of times", func() {
+				clock.WaitForWatcherAndIncrement(sendInterval)
+				Eventually(unregistrationCount).Should(Equal(2))
+
+				sender.(unregistration.Sender).Reconfigure(2*time.Second, 2)
+				Eventually(senderLogger).Should(gbytes.Say("settings-changed"))
+
+				clock.Increment(sendInterval)
+				Consistently(unregistrationCount).Should(Equal(2))
+
+				clock.WaitForWatcherAndIncrement(2*time.Second - sendInterval)
+				Eventually(unregistrationCount).Should(Equal(4))
+
+				clock.WaitForWatcherAndIncrement(2 * time.Second)
+				Consistently(unregistrationCount).Should(Equal(4))
+			})
 		})
 
 		Context("when one of the messages is removed", func() {
 			It("stops emitting unregistration messages", func() {
 				clock.WaitForWatcherAndIncrement(sendInterval)
-				Eventually(natsEmitter.EmitCallCount).Should(Equal(2))
+				Eventually(unregistrationCount).Should(Equal(2))
 
 				clock.WaitForWatcherAndIncrement(sendInterval)
-				Eventually(natsEmitter.EmitCallCount).Should(Equal(4))
+				Eventually(unregistrationCount).Should(Equal(4))
 
 				cache.Remove([]routingtable.RegistryMessage{
 					routingtable.RegistryMessageFor(endpoint1, route1, false),
 				})
 
 				clock.WaitForWatcherAndIncrement(sendInterval)
-				Eventually(natsEmitter.EmitCallCount).Should(Equal(5))
+				Eventually(unregistrationCount).Should(Equal(5))
 
 				clock.WaitForWatcherAndIncrement(sendInterval)
-				Consistently(natsEmitter.EmitCallCount).Should(Equal(5))
+				Consistently(unregistrationCount).Should(Equal(5))
 			})
 		})
 
 		Context("when another message is added", func() {
 			It("stops emitting unregistration messages", func() {
 				clock.WaitForWatcherAndIncrement(sendInterval)
-				Eventually(natsEmitter.EmitCallCount).Should(Equal(2))
+				Eventually(unregistrationCount).Should(Equal(2))
 
 				clock.WaitForWatcherAndIncrement(sendInterval)
-				Eventually(natsEmitter.EmitCallCount).Should(Equal(4))
+				Eventually(unregistrationCount).Should(Equal(4))
 
 				endpoint3 := routingtable.Endpoint{
 					InstanceGUID:  "instance-guid-3",
@@ -132,7 +357,7 @@ var _ = Describe("Sender", func() {
 				})
 
 				clock.WaitForWatcherAndIncrement(sendInterval)
-				Eventually(natsEmitter.EmitCallCount).Should(Equal(7))
+				Eventually(unregistrationCount).Should(Equal(7))
 			})
 		})
 	})
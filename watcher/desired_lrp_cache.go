@@ -0,0 +1,154 @@
+package watcher
+
+import (
+	"code.cloudfoundry.org/bbs/models"
+	"code.cloudfoundry.org/lager"
+)
+
+// desiredLRPCache holds the desired LRPs the watcher has seen in syncs and
+// events, so that the routes of an actual LRP can be refreshed without asking
+// the BBS. It is only used by the event loop.
+type desiredLRPCache struct {
+	lrps map[string]*models.DesiredLRP
+}
+
+func newDesiredLRPCache() *desiredLRPCache {
+	return &desiredLRPCache{lrps: map[string]*models.DesiredLRP{}}
+}
+
+func (c *desiredLRPCache) get(processGuid string) (*models.DesiredLRP, bool) {
+	lrp, ok := c.lrps[processGuid]
+	return lrp, ok
+}
+
+func (c *desiredLRPCache) set(lrp *models.DesiredLRP) {
+	c.lrps[lrp.ProcessGuid] = lrp
+}
+
+// replace drops every desired LRP that is not in the sync results.
+func (c *desiredLRPCache) replace(lrps []*models.DesiredLRP) {
+	c.lrps = make(map[string]*models.DesiredLRP, len(lrps))
+	for _, lrp := range lrps {
+		c.set(lrp)
+	}
+}
+
+func (c *desiredLRPCache) handleEvent(event models.Event) {
+	switch event := event.(type) {
+	case *models.DesiredLRPCreatedEvent:
+		if event.DesiredLrp != nil {
+			c.set(event.DesiredLrp)
+		}
+	case *models.DesiredLRPChangedEvent:
+		if event.After != nil {
+			c.set(event.After)
+		}
+	case *models.DesiredLRPRemovedEvent:
+		if event.DesiredLrp != nil {
+			delete(c.lrps, event.DesiredLrp.ProcessGuid)
+		}
+	}
+}
+
+// desiredLRPFetches holds back the events of process guids whose desired LRP
+// is being fetched from the BBS, so that events of the same LRP are still
+// handled in order. Only one fetch is in flight at a time and it covers every
+// process guid that was missed while the previous one was running.
+type desiredLRPFetches struct {
+	held     map[string][]models.Event
+	queued   []string
+	inFlight bool
+}
+
+func newDesiredLRPFetches() *desiredLRPFetches {
+	return &desiredLRPFetches{held: map[string][]models.Event{}}
+}
+
+type desiredLRPFetchResult struct {
+	processGuids []string
+	desiredLRPs  []*models.DesiredLRP
+	err          error
+}
+
+// holding returns true if the events of the process guid are held back.
+func (f *desiredLRPFetches) holding(processGuid string) bool {
+	_, ok := f.held[processGuid]
+	return ok
+}
+
+func (f *desiredLRPFetches) hold(processGuid string, event models.Event) {
+	if _, ok := f.held[processGuid]; !ok {
+		f.queued = append(f.queued, processGuid)
+	}
+	f.held[processGuid] = append(f.held[processGuid], event)
+}
+
+// next returns the process guids of the next fetch, or nil if a fetch is in
+// flight or there is nothing to fetch.
+func (f *desiredLRPFetches) next() []string {
+	if f.inFlight || len(f.queued) == 0 {
+		return nil
+	}
+	processGuids := f.queued
+	f.queued = nil
+	f.inFlight = true
+	return processGuids
+}
+
+// release returns the events held back for the process guid, in the order
+// they were received.
+func (f *desiredLRPFetches) release(processGuid string) []models.Event {
+	events := f.held[processGuid]
+	delete(f.held, processGuid)
+	return events
+}
+
+func eventProcessGuid(event models.Event) string {
+	switch event := event.(type) {
+	case *models.DesiredLRPCreatedEvent:
+		if event.DesiredLrp != nil {
+			return event.DesiredLrp.ProcessGuid
+		}
+	case *models.DesiredLRPChangedEvent:
+		if event.After != nil {
+			return event.After.ProcessGuid
+		}
+	case *models.DesiredLRPRemovedEvent:
+		if event.DesiredLrp != nil {
+			return event.DesiredLrp.ProcessGuid
+		}
+	case *models.ActualLRPInstanceCreatedEvent:
+		if event.ActualLrp != nil {
+			return event.ActualLrp.ProcessGuid
+		}
+	case *models.ActualLRPInstanceChangedEvent:
+		return event.ActualLRPKey.ProcessGuid
+	case *models.ActualLRPInstanceRemovedEvent:
+		if event.ActualLrp != nil {
+			return event.ActualLrp.ProcessGuid
+		}
+	}
+	return ""
+}
+
+// runningActualLRP returns the running actual LRP of an actual LRP created or
+// changed event, whose routes may have to be refreshed.
+func runningActualLRP(logger lager.Logger, event models.Event) *models.ActualLRP {
+	var actualLRP *models.ActualLRP
+	switch event := event.(type) {
+	case *models.ActualLRPInstanceCreatedEvent:
+		actualLRP = event.ActualLrp
+	case *models.ActualLRPInstanceChangedEvent:
+		actualLRP = event.After.ToActualLRP(event.ActualLRPKey, event.ActualLRPInstanceKey)
+	default:
+		return nil
+	}
+	if actualLRP == nil {
+		logger.Error("nil-actual-lrp", nil, lager.Data{"event-type": event.EventType()})
+		return nil
+	}
+	if actualLRP.State != models.ActualLRPStateRunning {
+		return nil
+	}
+	return actualLRP
+}
@@ -0,0 +1,146 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/route-emitter/routingtable"
+	tcpmodels "code.cloudfoundry.org/routing-api/models"
+)
+
+// ErrDryRunInProgress is returned by DryRunSync while another dry run is in
+// flight.
+var ErrDryRunInProgress = errors.New("a sync dry run is already in progress")
+
+type dryRunRequest struct {
+	logger lager.Logger
+	// result is buffered, so that the event loop never blocks on a caller
+	// that stopped waiting
+	result chan dryRunResult
+}
+
+type dryRunResult struct {
+	routeMappings routingtable.TCPRouteMappings
+	messages      routingtable.MessagesToEmit
+	err           error
+}
+
+type dryRunSync struct {
+	request dryRunRequest
+	result  *syncEventResult
+}
+
+// DryRunSync fetches the LRPs from the BBS like a sync does and returns the
+// messages the sync would emit. The routing table is not changed and nothing
+// is emitted. It blocks until the watcher has diffed the routing table, or
+// until ctx is done. Only one dry run is in flight at a time, including one
+// whose caller stopped waiting, others return ErrDryRunInProgress.
+func (watcher *Watcher) DryRunSync(ctx context.Context) (routingtable.TCPRouteMappings, routingtable.MessagesToEmit, error) {
+	if !atomic.CompareAndSwapInt32(&watcher.dryRunning, 0, 1) {
+		return routingtable.TCPRouteMappings{}, routingtable.MessagesToEmit{}, ErrDryRunInProgress
+	}
+
+	request := dryRunRequest{
+		logger: watcher.logger.Session("dry-run-sync"),
+		result: make(chan dryRunResult, 1),
+	}
+
+	select {
+	case watcher.dryRunCh <- request:
+	case <-ctx.Done():
+		atomic.StoreInt32(&watcher.dryRunning, 0)
+		return routingtable.TCPRouteMappings{}, routingtable.MessagesToEmit{}, ctx.Err()
+	}
+
+	select {
+	case result := <-request.result:
+		return result.routeMappings, result.messages, result.err
+	case <-ctx.Done():
+		return routingtable.TCPRouteMappings{}, routingtable.MessagesToEmit{}, ctx.Err()
+	}
+}
+
+// dryRun fetches the LRPs off the event loop and passes them back to it.
+func (watcher *Watcher) dryRun(request dryRunRequest, ch chan<- dryRunSync) {
+	syncEnd := make(chan *syncEventResult, 1)
+	watcher.sync(request.logger, syncEnd)
+	ch <- dryRunSync{request: request, result: <-syncEnd}
+}
+
+func (watcher *Watcher) completeDryRun(dryRun dryRunSync) {
+	logger := dryRun.request.logger
+	if dryRun.result.err != nil {
+		logger.Error("failed-to-sync-events", dryRun.result.err)
+		watcher.finishDryRun(dryRun.request, dryRunResult{err: dryRun.result.err})
+		return
+	}
+
+	routeMappings, messages := watcher.routeHandler.DiffSync(logger,
+		dryRun.result.desired,
+		dryRun.result.runningActual,
+		dryRun.result.domains,
+	)
+	logger.Info("complete", lager.Data{
+		"num-registration-messages":            len(messages.RegistrationMessages),
+		"num-unregistration-messages":          len(messages.UnregistrationMessages),
+		"num-internal-registration-messages":   len(messages.InternalRegistrationMessages),
+		"num-internal-unregistration-messages": len(messages.InternalUnregistrationMessages),
+	})
+	watcher.finishDryRun(dryRun.request, dryRunResult{routeMappings: routeMappings, messages: messages})
+}
+
+// finishDryRun allows the next dry run before passing on the result, so that
+// a caller can start another one as soon as it has the result.
+func (watcher *Watcher) finishDryRun(request dryRunRequest, result dryRunResult) {
+	atomic.StoreInt32(&watcher.dryRunning, 0)
+	request.result <- result
+}
+
+// DryRunReport lists the changes a sync would make to the routes.
+type DryRunReport struct {
+	Registrations           []routingtable.RegistryMessage `json:"registrations"`
+	Unregistrations         []routingtable.RegistryMessage `json:"unregistrations"`
+	InternalRegistrations   []routingtable.RegistryMessage `json:"internal_registrations"`
+	InternalUnregistrations []routingtable.RegistryMessage `json:"internal_unregistrations"`
+	TCPRegistrations        []tcpmodels.TcpRouteMapping    `json:"tcp_registrations"`
+	TCPUnregistrations      []tcpmodels.TcpRouteMapping    `json:"tcp_unregistrations"`
+}
+
+// NewDryRunHandler returns an http.Handler that runs a sync dry run and
+// reports the changes the sync would make as JSON. It responds with 429 while
+// another dry run is in flight. It is not authenticated and fetches every LRP
+// from the BBS, so it is only served on the debug listener.
+func NewDryRunHandler(logger lager.Logger, watcher *Watcher) http.Handler {
+	logger = logger.Session("sync-dry-run-handler")
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		routeMappings, messages, err := watcher.DryRunSync(req.Context())
+		if err == ErrDryRunInProgress {
+			logger.Info("dry-run-already-in-progress", lager.Data{"remote-addr": req.RemoteAddr})
+			http.Error(resp, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		if err != nil {
+			logger.Error("failed-to-dry-run-sync", err)
+			http.Error(resp, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		report := DryRunReport{
+			Registrations:           messages.RegistrationMessages,
+			Unregistrations:         messages.UnregistrationMessages,
+			InternalRegistrations:   messages.InternalRegistrationMessages,
+			InternalUnregistrations: messages.InternalUnregistrationMessages,
+			TCPRegistrations:        routeMappings.Registrations,
+			TCPUnregistrations:      routeMappings.Unregistrations,
+		}
+		resp.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(resp).Encode(report)
+		if err != nil {
+			logger.Error("failed-to-encode-report", err)
+		}
+	})
+}
@@ -6,20 +6,59 @@ import (
 
 	"code.cloudfoundry.org/bbs/models"
 	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/route-emitter/routingtable"
 	"code.cloudfoundry.org/route-emitter/watcher"
 )
 
 type FakeRouteHandler struct {
+	DiffSyncStub        func(lager.Logger, []*models.DesiredLRP, []*models.ActualLRP, models.DomainSet) (routingtable.TCPRouteMappings, routingtable.MessagesToEmit)
+	diffSyncMutex       sync.RWMutex
+	diffSyncArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 []*models.DesiredLRP
+		arg3 []*models.ActualLRP
+		arg4 models.DomainSet
+	}
+	diffSyncReturns struct {
+		result1 routingtable.TCPRouteMappings
+		result2 routingtable.MessagesToEmit
+	}
+	diffSyncReturnsOnCall map[int]struct {
+		result1 routingtable.TCPRouteMappings
+		result2 routingtable.MessagesToEmit
+	}
 	EmitExternalStub        func(lager.Logger)
 	emitExternalMutex       sync.RWMutex
 	emitExternalArgsForCall []struct {
 		arg1 lager.Logger
 	}
+	EmitExternalSliceStub        func(lager.Logger)
+	emitExternalSliceMutex       sync.RWMutex
+	emitExternalSliceArgsForCall []struct {
+		arg1 lager.Logger
+	}
+	EmitExternalToStub        func(lager.Logger, string)
+	emitExternalToMutex       sync.RWMutex
+	emitExternalToArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 string
+	}
 	EmitInternalStub        func(lager.Logger)
 	emitInternalMutex       sync.RWMutex
 	emitInternalArgsForCall []struct {
 		arg1 lager.Logger
 	}
+	EmitInternalToStub        func(lager.Logger, string)
+	emitInternalToMutex       sync.RWMutex
+	emitInternalToArgsForCall []struct {
+		arg1 lager.Logger
+		arg2 string
+	}
+	FlushStub        func(lager.Logger)
+	flushMutex       sync.RWMutex
+	flushArgsForCall []struct {
+		arg1 lager.Logger
+	}
 	HandleEventStub        func(lager.Logger, models.Event)
 	handleEventMutex       sync.RWMutex
 	handleEventArgsForCall []struct {
@@ -56,6 +95,82 @@ type FakeRouteHandler struct {
 	invocationsMutex sync.RWMutex
 }
 
+func (fake *FakeRouteHandler) DiffSync(arg1 lager.Logger, arg2 []*models.DesiredLRP, arg3 []*models.ActualLRP, arg4 models.DomainSet) (routingtable.TCPRouteMappings, routingtable.MessagesToEmit) {
+	var arg2Copy []*models.DesiredLRP
+	if arg2 != nil {
+		arg2Copy = make([]*models.DesiredLRP, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	var arg3Copy []*models.ActualLRP
+	if arg3 != nil {
+		arg3Copy = make([]*models.ActualLRP, len(arg3))
+		copy(arg3Copy, arg3)
+	}
+	fake.diffSyncMutex.Lock()
+	ret, specificReturn := fake.diffSyncReturnsOnCall[len(fake.diffSyncArgsForCall)]
+	fake.diffSyncArgsForCall = append(fake.diffSyncArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 []*models.DesiredLRP
+		arg3 []*models.ActualLRP
+		arg4 models.DomainSet
+	}{arg1, arg2Copy, arg3Copy, arg4})
+	fake.recordInvocation("DiffSync", []interface{}{arg1, arg2Copy, arg3Copy, arg4})
+	fake.diffSyncMutex.Unlock()
+	if fake.DiffSyncStub != nil {
+		return fake.DiffSyncStub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.diffSyncReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeRouteHandler) DiffSyncCallCount() int {
+	fake.diffSyncMutex.RLock()
+	defer fake.diffSyncMutex.RUnlock()
+	return len(fake.diffSyncArgsForCall)
+}
+
+func (fake *FakeRouteHandler) DiffSyncCalls(stub func(lager.Logger, []*models.DesiredLRP, []*models.ActualLRP, models.DomainSet) (routingtable.TCPRouteMappings, routingtable.MessagesToEmit)) {
+	fake.diffSyncMutex.Lock()
+	defer fake.diffSyncMutex.Unlock()
+	fake.DiffSyncStub = stub
+}
+
+func (fake *FakeRouteHandler) DiffSyncArgsForCall(i int) (lager.Logger, []*models.DesiredLRP, []*models.ActualLRP, models.DomainSet) {
+	fake.diffSyncMutex.RLock()
+	defer fake.diffSyncMutex.RUnlock()
+	argsForCall := fake.diffSyncArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeRouteHandler) DiffSyncReturns(result1 routingtable.TCPRouteMappings, result2 routingtable.MessagesToEmit) {
+	fake.diffSyncMutex.Lock()
+	defer fake.diffSyncMutex.Unlock()
+	fake.DiffSyncStub = nil
+	fake.diffSyncReturns = struct {
+		result1 routingtable.TCPRouteMappings
+		result2 routingtable.MessagesToEmit
+	}{result1, result2}
+}
+
+func (fake *FakeRouteHandler) DiffSyncReturnsOnCall(i int, result1 routingtable.TCPRouteMappings, result2 routingtable.MessagesToEmit) {
+	fake.diffSyncMutex.Lock()
+	defer fake.diffSyncMutex.Unlock()
+	fake.DiffSyncStub = nil
+	if fake.diffSyncReturnsOnCall == nil {
+		fake.diffSyncReturnsOnCall = make(map[int]struct {
+			result1 routingtable.TCPRouteMappings
+			result2 routingtable.MessagesToEmit
+		})
+	}
+	fake.diffSyncReturnsOnCall[i] = struct {
+		result1 routingtable.TCPRouteMappings
+		result2 routingtable.MessagesToEmit
+	}{result1, result2}
+}
+
 func (fake *FakeRouteHandler) EmitExternal(arg1 lager.Logger) {
 	fake.emitExternalMutex.Lock()
 	fake.emitExternalArgsForCall = append(fake.emitExternalArgsForCall, struct {
@@ -87,6 +202,69 @@ func (fake *FakeRouteHandler) EmitExternalArgsForCall(i int) lager.Logger {
 	return argsForCall.arg1
 }
 
+func (fake *FakeRouteHandler) EmitExternalSlice(arg1 lager.Logger) {
+	fake.emitExternalSliceMutex.Lock()
+	fake.emitExternalSliceArgsForCall = append(fake.emitExternalSliceArgsForCall, struct {
+		arg1 lager.Logger
+	}{arg1})
+	fake.recordInvocation("EmitExternalSlice", []interface{}{arg1})
+	fake.emitExternalSliceMutex.Unlock()
+	if fake.EmitExternalSliceStub != nil {
+		fake.EmitExternalSliceStub(arg1)
+	}
+}
+
+func (fake *FakeRouteHandler) EmitExternalSliceCallCount() int {
+	fake.emitExternalSliceMutex.RLock()
+	defer fake.emitExternalSliceMutex.RUnlock()
+	return len(fake.emitExternalSliceArgsForCall)
+}
+
+func (fake *FakeRouteHandler) EmitExternalSliceCalls(stub func(lager.Logger)) {
+	fake.emitExternalSliceMutex.Lock()
+	defer fake.emitExternalSliceMutex.Unlock()
+	fake.EmitExternalSliceStub = stub
+}
+
+func (fake *FakeRouteHandler) EmitExternalSliceArgsForCall(i int) lager.Logger {
+	fake.emitExternalSliceMutex.RLock()
+	defer fake.emitExternalSliceMutex.RUnlock()
+	argsForCall := fake.emitExternalSliceArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeRouteHandler) EmitExternalTo(arg1 lager.Logger, arg2 string) {
+	fake.emitExternalToMutex.Lock()
+	fake.emitExternalToArgsForCall = append(fake.emitExternalToArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 string
+	}{arg1, arg2})
+	fake.recordInvocation("EmitExternalTo", []interface{}{arg1, arg2})
+	fake.emitExternalToMutex.Unlock()
+	if fake.EmitExternalToStub != nil {
+		fake.EmitExternalToStub(arg1, arg2)
+	}
+}
+
+func (fake *FakeRouteHandler) EmitExternalToCallCount() int {
+	fake.emitExternalToMutex.RLock()
+	defer fake.emitExternalToMutex.RUnlock()
+	return len(fake.emitExternalToArgsForCall)
+}
+
+func (fake *FakeRouteHandler) EmitExternalToCalls(stub func(lager.Logger, string)) {
+	fake.emitExternalToMutex.Lock()
+	defer fake.emitExternalToMutex.Unlock()
+	fake.EmitExternalToStub = stub
+}
+
+func (fake *FakeRouteHandler) EmitExternalToArgsForCall(i int) (lager.Logger, string) {
+	fake.emitExternalToMutex.RLock()
+	defer fake.emitExternalToMutex.RUnlock()
+	argsForCall := fake.emitExternalToArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
 func (fake *FakeRouteHandler) EmitInternal(arg1 lager.Logger) {
 	fake.emitInternalMutex.Lock()
 	fake.emitInternalArgsForCall = append(fake.emitInternalArgsForCall, struct {
@@ -118,6 +296,69 @@ func (fake *FakeRouteHandler) EmitInternalArgsForCall(i int) lager.Logger {
 	return argsForCall.arg1
 }
 
+func (fake *FakeRouteHandler) EmitInternalTo(arg1 lager.Logger, arg2 string) {
+	fake.emitInternalToMutex.Lock()
+	fake.emitInternalToArgsForCall = append(fake.emitInternalToArgsForCall, struct {
+		arg1 lager.Logger
+		arg2 string
+	}{arg1, arg2})
+	fake.recordInvocation("EmitInternalTo", []interface{}{arg1, arg2})
+	fake.emitInternalToMutex.Unlock()
+	if fake.EmitInternalToStub != nil {
+		fake.EmitInternalToStub(arg1, arg2)
+	}
+}
+
+func (fake *FakeRouteHandler) EmitInternalToCallCount() int {
+	fake.emitInternalToMutex.RLock()
+	defer fake.emitInternalToMutex.RUnlock()
+	return len(fake.emitInternalToArgsForCall)
+}
+
+func (fake *FakeRouteHandler) EmitInternalToCalls(stub func(lager.Logger, string)) {
+	fake.emitInternalToMutex.Lock()
+	defer fake.emitInternalToMutex.Unlock()
+	fake.EmitInternalToStub = stub
+}
+
+func (fake *FakeRouteHandler) EmitInternalToArgsForCall(i int) (lager.Logger, string) {
+	fake.emitInternalToMutex.RLock()
+	defer fake.emitInternalToMutex.RUnlock()
+	argsForCall := fake.emitInternalToArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeRouteHandler) Flush(arg1 lager.Logger) {
+	fake.flushMutex.Lock()
+	fake.flushArgsForCall = append(fake.flushArgsForCall, struct {
+		arg1 lager.Logger
+	}{arg1})
+	fake.recordInvocation("Flush", []interface{}{arg1})
+	fake.flushMutex.Unlock()
+	if fake.FlushStub != nil {
+		fake.FlushStub(arg1)
+	}
+}
+
+func (fake *FakeRouteHandler) FlushCallCount() int {
+	fake.flushMutex.RLock()
+	defer fake.flushMutex.RUnlock()
+	return len(fake.flushArgsForCall)
+}
+
+func (fake *FakeRouteHandler) FlushCalls(stub func(lager.Logger)) {
+	fake.flushMutex.Lock()
+	defer fake.flushMutex.Unlock()
+	fake.FlushStub = stub
+}
+
+func (fake *FakeRouteHandler) FlushArgsForCall(i int) lager.Logger {
+	fake.flushMutex.RLock()
+	defer fake.flushMutex.RUnlock()
+	argsForCall := fake.flushArgsForCall[i]
+	return argsForCall.arg1
+}
+
 func (fake *FakeRouteHandler) HandleEvent(arg1 lager.Logger, arg2 models.Event) {
 	fake.handleEventMutex.Lock()
 	fake.handleEventArgsForCall = append(fake.handleEventArgsForCall, struct {
@@ -295,10 +536,20 @@ func (fake *FakeRouteHandler) SyncArgsForCall(i int) (lager.Logger, []*models.De
 func (fake *FakeRouteHandler) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.diffSyncMutex.RLock()
+	defer fake.diffSyncMutex.RUnlock()
 	fake.emitExternalMutex.RLock()
 	defer fake.emitExternalMutex.RUnlock()
+	fake.emitExternalSliceMutex.RLock()
+	defer fake.emitExternalSliceMutex.RUnlock()
+	fake.emitExternalToMutex.RLock()
+	defer fake.emitExternalToMutex.RUnlock()
 	fake.emitInternalMutex.RLock()
 	defer fake.emitInternalMutex.RUnlock()
+	fake.emitInternalToMutex.RLock()
+	defer fake.emitInternalToMutex.RUnlock()
+	fake.flushMutex.RLock()
+	defer fake.flushMutex.RUnlock()
 	fake.handleEventMutex.RLock()
 	defer fake.handleEventMutex.RUnlock()
 	fake.refreshDesiredMutex.RLock()
@@ -0,0 +1,127 @@
+package watcher
+
+import "code.cloudfoundry.org/bbs/models"
+
+// Filter selects the LRPs whose routes this emitter is responsible for. LRPs
+// that are filtered out are never passed to the RouteHandler, so their routes
+// are neither registered nor unregistered.
+type Filter interface {
+	DesiredLRP(*models.DesiredLRP) bool
+	ActualLRP(*models.ActualLRP) bool
+}
+
+// RouteFilter is implemented by filters that also remove individual routes
+// from the desired LRPs they accept.
+type RouteFilter interface {
+	Routes(*models.DesiredLRP) *models.DesiredLRP
+}
+
+// Filters accepts the LRPs accepted by all of its filters.
+type Filters []Filter
+
+func (filters Filters) DesiredLRP(desiredLRP *models.DesiredLRP) bool {
+	for _, filter := range filters {
+		if !filter.DesiredLRP(desiredLRP) {
+			return false
+		}
+	}
+	return true
+}
+
+func (filters Filters) ActualLRP(actualLRP *models.ActualLRP) bool {
+	for _, filter := range filters {
+		if !filter.ActualLRP(actualLRP) {
+			return false
+		}
+	}
+	return true
+}
+
+func (filters Filters) Routes(desiredLRP *models.DesiredLRP) *models.DesiredLRP {
+	for _, filter := range filters {
+		if routeFilter, ok := filter.(RouteFilter); ok {
+			desiredLRP = routeFilter.Routes(desiredLRP)
+		}
+	}
+	return desiredLRP
+}
+
+// filterEvent returns the event as it should be handled, with the filtered
+// routes removed, or false if the event is for an LRP that is filtered out.
+func (w *Watcher) filterEvent(event models.Event) (models.Event, bool) {
+	if w.filter == nil {
+		return event, true
+	}
+
+	switch event := event.(type) {
+	case *models.DesiredLRPCreatedEvent:
+		if event.DesiredLrp == nil {
+			return event, true
+		}
+		if !w.filter.DesiredLRP(event.DesiredLrp) {
+			return nil, false
+		}
+		return models.NewDesiredLRPCreatedEvent(w.filterRoutes(event.DesiredLrp)), true
+	case *models.DesiredLRPChangedEvent:
+		if event.Before == nil || event.After == nil {
+			return event, true
+		}
+		if !w.filter.DesiredLRP(event.After) {
+			return nil, false
+		}
+		return models.NewDesiredLRPChangedEvent(w.filterRoutes(event.Before), w.filterRoutes(event.After)), true
+	case *models.DesiredLRPRemovedEvent:
+		if event.DesiredLrp == nil {
+			return event, true
+		}
+		if !w.filter.DesiredLRP(event.DesiredLrp) {
+			return nil, false
+		}
+		return models.NewDesiredLRPRemovedEvent(w.filterRoutes(event.DesiredLrp)), true
+	case *models.ActualLRPInstanceCreatedEvent:
+		return event, event.ActualLrp == nil || w.filter.ActualLRP(event.ActualLrp)
+	case *models.ActualLRPInstanceChangedEvent:
+		actualLRP := event.After.ToActualLRP(event.ActualLRPKey, event.ActualLRPInstanceKey)
+		return event, actualLRP == nil || w.filter.ActualLRP(actualLRP)
+	case *models.ActualLRPInstanceRemovedEvent:
+		return event, event.ActualLrp == nil || w.filter.ActualLRP(event.ActualLrp)
+	}
+
+	// invalid events are still passed on so that they get logged
+	return event, true
+}
+
+func (w *Watcher) filterRoutes(desiredLRP *models.DesiredLRP) *models.DesiredLRP {
+	if routeFilter, ok := w.filter.(RouteFilter); ok {
+		return routeFilter.Routes(desiredLRP)
+	}
+	return desiredLRP
+}
+
+func (w *Watcher) filterDesiredLRPs(desiredLRPs []*models.DesiredLRP) []*models.DesiredLRP {
+	if w.filter == nil {
+		return desiredLRPs
+	}
+
+	filtered := make([]*models.DesiredLRP, 0, len(desiredLRPs))
+	for _, desiredLRP := range desiredLRPs {
+		if w.filter.DesiredLRP(desiredLRP) {
+			filtered = append(filtered, w.filterRoutes(desiredLRP))
+		}
+	}
+	return filtered
+}
+
+func (w *Watcher) filterActualLRPs(actualLRPs []*models.ActualLRP) []*models.ActualLRP {
+	if w.filter == nil {
+		return actualLRPs
+	}
+
+	filtered := make([]*models.ActualLRP, 0, len(actualLRPs))
+	for _, actualLRP := range actualLRPs {
+		if w.filter.ActualLRP(actualLRP) {
+			filtered = append(filtered, actualLRP)
+		}
+	}
+	return filtered
+}
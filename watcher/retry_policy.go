@@ -0,0 +1,62 @@
+package watcher
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy controls how the watcher resubscribes to BBS events after a
+// failed subscription. The zero value retries immediately and never reports
+// the watcher as unhealthy.
+type RetryPolicy struct {
+	// MinBackoff is the wait after the first failure, it doubles with every
+	// consecutive failure up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Jitter is the fraction of the backoff, between 0 and 1, that is randomly
+	// taken off so that emitters do not retry in lockstep.
+	Jitter float64
+	// FailureThreshold is the number of consecutive failures after which the
+	// watcher is unhealthy, 0 disables the check.
+	FailureThreshold int
+}
+
+// Backoff returns how long to wait before resubscribing after the given number
+// of consecutive failures.
+func (p RetryPolicy) Backoff(failures int) time.Duration {
+	if failures <= 0 || p.MinBackoff <= 0 {
+		return 0
+	}
+
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = math.MaxInt64
+	}
+
+	backoff := p.MinBackoff
+	for i := 1; i < failures && backoff < maxBackoff; i++ {
+		if backoff > maxBackoff/2 {
+			backoff = maxBackoff
+			break
+		}
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+
+	if p.Jitter > 0 {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		backoff -= time.Duration(rand.Float64() * jitter * float64(backoff))
+	}
+
+	return backoff
+}
+
+func (p RetryPolicy) healthy(failures int) bool {
+	return p.FailureThreshold <= 0 || failures < p.FailureThreshold
+}
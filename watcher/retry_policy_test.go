@@ -0,0 +1,60 @@
+package watcher_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/route-emitter/watcher"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RetryPolicy", func() {
+	var policy watcher.RetryPolicy
+
+	BeforeEach(func() {
+		policy = watcher.RetryPolicy{
+			MinBackoff: time.Second,
+			MaxBackoff: 10 * time.Second,
+		}
+	})
+
+	It("does not wait before the first failure", func() {
+		Expect(policy.Backoff(0)).To(BeZero())
+	})
+
+	It("doubles the backoff for every consecutive failure", func() {
+		Expect(policy.Backoff(1)).To(Equal(time.Second))
+		Expect(policy.Backoff(2)).To(Equal(2 * time.Second))
+		Expect(policy.Backoff(3)).To(Equal(4 * time.Second))
+	})
+
+	It("caps the backoff at the maximum", func() {
+		Expect(policy.Backoff(5)).To(Equal(10 * time.Second))
+		Expect(policy.Backoff(1000)).To(Equal(10 * time.Second))
+	})
+
+	It("does not overflow without a maximum", func() {
+		policy.MaxBackoff = 0
+		Expect(policy.Backoff(1000)).To(BeNumerically(">", 0))
+	})
+
+	It("retries immediately without a minimum", func() {
+		Expect(watcher.RetryPolicy{}.Backoff(10)).To(BeZero())
+	})
+
+	Context("with jitter", func() {
+		BeforeEach(func() {
+			policy.Jitter = 0.5
+		})
+
+		It("takes up to the jitter fraction off the backoff", func() {
+			for i := 0; i < 100; i++ {
+				Expect(policy.Backoff(3)).To(And(
+					BeNumerically(">=", 2*time.Second),
+					BeNumerically("<=", 4*time.Second),
+				))
+			}
+		})
+	})
+})
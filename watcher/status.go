@@ -0,0 +1,52 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+)
+
+// Status reports whether the watcher is subscribed to BBS events and has
+// completed a sync, and when each last succeeded.
+type Status struct {
+	Subscribed     bool
+	LastSubscribed time.Time
+	Synced         bool
+	LastSynced     time.Time
+}
+
+type status struct {
+	lock sync.Mutex
+	Status
+}
+
+func (s *status) get() Status {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.Status
+}
+
+func (s *status) subscribed(now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Subscribed = true
+	s.LastSubscribed = now
+}
+
+func (s *status) unsubscribed() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Subscribed = false
+}
+
+func (s *status) synced(now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Synced = true
+	s.LastSynced = now
+}
+
+// Status returns the current subscription and sync status, it is safe to
+// call from any goroutine.
+func (watcher *Watcher) Status() Status {
+	return watcher.status.get()
+}
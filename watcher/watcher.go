@@ -7,16 +7,26 @@ import (
 	"sync/atomic"
 	"time"
 
-	"code.cloudfoundry.org/bbs"
 	"code.cloudfoundry.org/bbs/events"
 	"code.cloudfoundry.org/bbs/models"
 	"code.cloudfoundry.org/clock"
 	loggingclient "code.cloudfoundry.org/diego-logging-client"
 	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/route-emitter/routingtable"
 )
 
 const (
 	routeSyncDuration = "RouteEmitterSyncDuration"
+
+	syncSuccessesCounter = "RouteEmitterSyncSuccesses"
+	syncFailuresCounter  = "RouteEmitterSyncFailures"
+	lastSyncAgeMetric    = "RouteEmitterLastSuccessfulSyncAge"
+
+	eventStreamGapsCounter     = "RouteEmitterEventStreamGaps"
+	eventStreamGapDuration     = "RouteEmitterEventStreamGapDuration"
+	unrecognizedEventThreshold = 10
+
+	subscriptionFailuresMetric = "RouteEmitterBBSSubscriptionFailures"
 )
 
 //go:generate counterfeiter -o fakes/fake_routehandler.go . RouteHandler
@@ -30,33 +40,96 @@ type RouteHandler interface {
 		cachedEvents map[string]models.Event,
 	)
 	EmitExternal(logger lager.Logger)
+	EmitExternalSlice(logger lager.Logger)
 	EmitInternal(logger lager.Logger)
+	EmitExternalTo(logger lager.Logger, subject string)
+	EmitInternalTo(logger lager.Logger, subject string)
 	ShouldRefreshDesired(*models.ActualLRP) bool
 	RefreshDesired(lager.Logger, []*models.DesiredLRP)
+	Flush(logger lager.Logger)
+	DiffSync(
+		logger lager.Logger,
+		desired []*models.DesiredLRP,
+		runningActual []*models.ActualLRP,
+		domains models.DomainSet,
+	) (routingtable.TCPRouteMappings, routingtable.MessagesToEmit)
+}
+
+// BBSClient is the part of the BBS client that the watcher uses.
+type BBSClient interface {
+	ActualLRPs(logger lager.Logger, filter models.ActualLRPFilter) ([]*models.ActualLRP, error)
+	DesiredLRPs(logger lager.Logger, filter models.DesiredLRPFilter) ([]*models.DesiredLRP, error)
+	Domains(logger lager.Logger) ([]string, error)
+	SubscribeToInstanceEventsByCellID(logger lager.Logger, cellID string) (events.EventSource, error)
 }
 
 type Watcher struct {
 	cellID         string
-	bbsClient      bbs.Client
+	bbsClient      BBSClient
 	clock          clock.Clock
 	routeHandler   RouteHandler
 	syncCh         chan struct{}
 	emitExternalCh chan struct{}
 	emitInternalCh chan struct{}
+	dryRunCh       chan dryRunRequest
 	logger         lager.Logger
 	metronClient   loggingclient.IngressClient
+	retryPolicy    RetryPolicy
+	filter         Filter
+
+	// syncRetryPolicy controls how soon a failed sync is retried, instead of
+	// waiting for the next sync interval
+	syncRetryPolicy RetryPolicy
+
+	// emitExternalSliceCh receives the periodic emits of the external routes,
+	// which may emit a slice of the table only
+	emitExternalSliceCh chan struct{}
+
+	// emitExternalToCh and emitInternalToCh receive the subjects of routers
+	// that asked for the whole table when they started
+	emitExternalToCh chan string
+	emitInternalToCh chan string
+
+	// coalesceWindow is how long the route handler accumulates the changes of
+	// events before they are flushed, 0 flushes after every event
+	coalesceWindow time.Duration
+
+	// subscriptionFailures counts consecutive failed subscriptions, it is read
+	// by the health check. A subscription that fails before it delivered an
+	// event counts as failed too.
+	subscriptionFailures int32
+
+	// status is read by the readiness check
+	status status
+
+	// dryRunning is set while a sync dry run is in flight, from the request
+	// until the event loop completes it
+	dryRunning int32
+
+	// desiredLRPs, desiredLRPFetches and desiredLRPFetchResults are only used
+	// by the event loop
+	desiredLRPs            *desiredLRPCache
+	desiredLRPFetches      *desiredLRPFetches
+	desiredLRPFetchResults chan desiredLRPFetchResult
 }
 
 func NewWatcher(
 	cellID string,
-	bbsClient bbs.Client,
+	bbsClient BBSClient,
 	clock clock.Clock,
 	routeHandler RouteHandler,
 	syncCh chan struct{},
 	emitExternalCh chan struct{},
+	emitExternalSliceCh chan struct{},
 	emitInternalCh chan struct{},
+	emitExternalToCh chan string,
+	emitInternalToCh chan string,
 	logger lager.Logger,
 	metronClient loggingclient.IngressClient,
+	retryPolicy RetryPolicy,
+	syncRetryPolicy RetryPolicy,
+	coalesceWindow time.Duration,
+	filter Filter,
 ) *Watcher {
 	return &Watcher{
 		cellID:         cellID,
@@ -66,11 +139,26 @@ func NewWatcher(
 		syncCh:         syncCh,
 		emitExternalCh: emitExternalCh,
 		emitInternalCh: emitInternalCh,
+		dryRunCh:       make(chan dryRunRequest),
 		logger:         logger.Session("watcher"),
 		metronClient:   metronClient,
+		retryPolicy:    retryPolicy,
+		coalesceWindow: coalesceWindow,
+		filter:         filter,
+
+		emitExternalSliceCh: emitExternalSliceCh,
+		emitExternalToCh:    emitExternalToCh,
+		emitInternalToCh:    emitInternalToCh,
+		syncRetryPolicy:     syncRetryPolicy,
 	}
 }
 
+// Healthy returns false once subscribing to BBS events has failed more times
+// in a row than the retry policy allows.
+func (watcher *Watcher) Healthy() bool {
+	return watcher.retryPolicy.healthy(int(atomic.LoadInt32(&watcher.subscriptionFailures)))
+}
+
 type syncEventResult struct {
 	startTime     time.Time
 	desired       []*models.DesiredLRP
@@ -85,22 +173,58 @@ func (watcher *Watcher) Run(signals <-chan os.Signal, ready chan<- struct{}) err
 
 	eventChan := make(chan models.Event)
 	resubscribeChannel := make(chan error)
+	gapChannel := make(chan time.Time)
 
 	eventSource := &atomic.Value{}
 	var stopEventSource int32
 
-	go watcher.checkForEvents(resubscribeChannel, eventChan, eventSource, watcher.logger)
+	// gapStart is when events started getting lost, it is zero while the
+	// event stream is healthy
+	var gapStart time.Time
+
+	go watcher.checkForEvents(resubscribeChannel, gapChannel, eventChan, eventSource, gapStart, watcher.logger)
 	watcher.logger.Debug("listening-on-channels")
 	close(ready)
 	watcher.logger.Debug("started")
 
+	watcher.desiredLRPs = newDesiredLRPCache()
+	watcher.desiredLRPFetches = newDesiredLRPFetches()
+	// only one fetch is in flight, so its result never blocks
+	watcher.desiredLRPFetchResults = make(chan desiredLRPFetchResult, 1)
+
 	cachedEvents := make(map[string]models.Event)
 	syncEnd := make(chan *syncEventResult)
+	dryRunEnd := make(chan dryRunSync)
 	syncing := false
+	resyncPending := false
+
+	var retryTimer clock.Timer
+	var retryC <-chan time.Time
+
+	// syncFailures counts consecutive failed syncs, lastSynced is when the
+	// last sync succeeded or the watcher started
+	syncFailures := 0
+	lastSynced := watcher.clock.Now()
+	var syncRetryTimer clock.Timer
+	var syncRetryC <-chan time.Time
+
+	var flushTimer clock.Timer
+	var flushC <-chan time.Time
+
+	startSync := func() {
+		logger := watcher.logger.Session("sync")
+		logger.Info("starting")
+		go watcher.sync(logger, syncEnd)
+		syncing = true
+	}
 
 	for {
 		select {
 		case event := <-eventChan:
+			event, ok := watcher.filterEvent(event)
+			if !ok {
+				continue
+			}
 			if syncing {
 				watcher.logger.Info("caching-event", lager.Data{
 					"type": event.EventType(),
@@ -110,68 +234,134 @@ func (watcher *Watcher) Run(signals <-chan os.Signal, ready chan<- struct{}) err
 			}
 			logger := watcher.logger.Session("handling-event")
 			watcher.handleEvent(logger, event)
+			watcher.fetchDesiredLRPs()
+			if watcher.coalesceWindow <= 0 {
+				watcher.routeHandler.Flush(logger)
+			} else if flushTimer == nil {
+				flushTimer = watcher.clock.NewTimer(watcher.coalesceWindow)
+				flushC = flushTimer.C()
+			}
+		case result := <-watcher.desiredLRPFetchResults:
+			logger := watcher.logger.Session("desired-lrp-fetch")
+			watcher.completeDesiredLRPFetch(logger, result, syncing, cachedEvents)
+			watcher.fetchDesiredLRPs()
+		case <-flushC:
+			flushTimer, flushC = nil, nil
+			logger := watcher.logger.Session("flush")
+			watcher.routeHandler.Flush(logger)
 		case <-watcher.emitExternalCh:
 			logger := watcher.logger.Session("emit-external")
 			watcher.routeHandler.EmitExternal(logger)
+		case <-watcher.emitExternalSliceCh:
+			logger := watcher.logger.Session("emit-external")
+			watcher.routeHandler.EmitExternalSlice(logger)
 		case <-watcher.emitInternalCh:
 			logger := watcher.logger.Session("emit-internal")
 			watcher.routeHandler.EmitInternal(logger)
+		case subject := <-watcher.emitExternalToCh:
+			logger := watcher.logger.Session("emit-external-to")
+			watcher.routeHandler.EmitExternalTo(logger, subject)
+		case subject := <-watcher.emitInternalToCh:
+			logger := watcher.logger.Session("emit-internal-to")
+			watcher.routeHandler.EmitInternalTo(logger, subject)
 		case syncEvent := <-syncEnd:
 			syncing = false
 			logger := watcher.logger.Session("sync")
 			if syncEvent.err != nil {
 				logger.Error("failed-to-sync-events", syncEvent.err)
-				continue
-			}
-
-			var cachedDesired []*models.DesiredLRP
-			for _, e := range cachedEvents {
-				desired := watcher.retrieveDesiredWhileSyncing(logger, e, syncEvent.desired)
-				if len(desired) > 0 {
-					cachedDesired = append(cachedDesired, desired...)
+				syncFailures++
+				watcher.recordSync(logger, syncFailuresCounter, lastSynced)
+				if backoff := watcher.syncRetryPolicy.Backoff(syncFailures); backoff > 0 && syncRetryTimer == nil {
+					logger.Info("waiting-to-retry-sync", lager.Data{"backoff": backoff.String(), "consecutive-failures": syncFailures})
+					syncRetryTimer = watcher.clock.NewTimer(backoff)
+					syncRetryC = syncRetryTimer.C()
+				}
+			} else {
+				watcher.completeSync(logger, syncEvent, cachedEvents)
+				cachedEvents = make(map[string]models.Event)
+				syncFailures = 0
+				lastSynced = watcher.clock.Now()
+				watcher.recordSync(logger, syncSuccessesCounter, lastSynced)
+				if syncRetryTimer != nil {
+					syncRetryTimer.Stop()
+					syncRetryTimer, syncRetryC = nil, nil
 				}
 			}
 
-			if len(cachedDesired) > 0 {
-				syncEvent.desired = append(syncEvent.desired, cachedDesired...)
+			if resyncPending {
+				// the sync that just finished may have started before the gap, so
+				// its results cannot be trusted to cover it
+				resyncPending = false
+				startSync()
 			}
-
-			logger.Debug("calling-handler-sync")
-			watcher.routeHandler.Sync(logger,
-				syncEvent.desired,
-				syncEvent.runningActual,
-				syncEvent.domains,
-				cachedEvents,
-			)
-
-			after := watcher.clock.Now()
-			if err := watcher.metronClient.SendDuration(routeSyncDuration, after.Sub(syncEvent.startTime)); err != nil {
-				watcher.logger.Error("failed-to-send-route-sync-duration-metric", err)
+		case request := <-watcher.dryRunCh:
+			request.logger.Info("starting")
+			go watcher.dryRun(request, dryRunEnd)
+		case dryRun := <-dryRunEnd:
+			watcher.completeDryRun(dryRun)
+		case <-syncRetryC:
+			syncRetryTimer, syncRetryC = nil, nil
+			if syncing {
+				watcher.logger.Debug("sync-already-in-progress")
+				continue
 			}
-
-			cachedEvents = make(map[string]models.Event)
-			logger.Info("complete")
+			watcher.logger.Info("retrying-sync", lager.Data{"consecutive-failures": syncFailures})
+			startSync()
 		case <-watcher.syncCh:
 			if syncing {
 				watcher.logger.Debug("sync-already-in-progress")
 				continue
 			}
-			logger := watcher.logger.Session("sync")
-			logger.Info("starting")
-			go watcher.sync(logger, syncEnd)
-			syncing = true
+			startSync()
 		case err := <-resubscribeChannel:
 			watcher.logger.Error("event-source-error", err)
+			watcher.status.unsubscribed()
+			if gapStart.IsZero() {
+				gapStart = watcher.clock.Now()
+			}
 			if es := eventSource.Load(); es != nil {
 				err := es.(events.EventSource).Close()
 				if err != nil {
 					watcher.logger.Error("failed-closing-event-source", err)
 				}
 			}
-			go watcher.checkForEvents(resubscribeChannel, eventChan, eventSource, watcher.logger)
+			failures := int(atomic.LoadInt32(&watcher.subscriptionFailures))
+			backoff := watcher.retryPolicy.Backoff(failures)
+			if backoff <= 0 {
+				go watcher.checkForEvents(resubscribeChannel, gapChannel, eventChan, eventSource, gapStart, watcher.logger)
+				continue
+			}
+			watcher.logger.Info("waiting-to-resubscribe", lager.Data{"backoff": backoff.String(), "consecutive-failures": failures})
+			retryTimer = watcher.clock.NewTimer(backoff)
+			retryC = retryTimer.C()
+		case <-retryC:
+			retryTimer, retryC = nil, nil
+			go watcher.checkForEvents(resubscribeChannel, gapChannel, eventChan, eventSource, gapStart, watcher.logger)
+		case start := <-gapChannel:
+			gapStart = time.Time{}
+			watcher.recordGap(start)
+			// events lost during the gap are only recovered by a sync, so do not
+			// wait for the next sync interval
+			if syncing {
+				watcher.logger.Info("sync-after-current-sync", lager.Data{"gap-start": start})
+				resyncPending = true
+				continue
+			}
+			startSync()
 
 		case <-signals:
 			watcher.logger.Info("stopping")
+			watcher.status.unsubscribed()
+			if retryTimer != nil {
+				retryTimer.Stop()
+			}
+			if syncRetryTimer != nil {
+				syncRetryTimer.Stop()
+			}
+			if flushTimer != nil {
+				flushTimer.Stop()
+				watcher.routeHandler.Flush(watcher.logger.Session("flush"))
+			}
 			atomic.StoreInt32(&stopEventSource, 1)
 			if es := eventSource.Load(); es != nil {
 				err := es.(events.EventSource).Close()
@@ -184,44 +374,89 @@ func (watcher *Watcher) Run(signals <-chan os.Signal, ready chan<- struct{}) err
 	}
 }
 
-func (w *Watcher) retrieveDesiredInternal(logger lager.Logger, event models.Event, currentDesireds []*models.DesiredLRP, syncing bool) []*models.DesiredLRP {
-	var err error
-	var actualLRP *models.ActualLRP
-	switch event := event.(type) {
-	case *models.ActualLRPInstanceCreatedEvent:
-		actualLRP = event.ActualLrp
-	case *models.ActualLRPInstanceChangedEvent:
-		actualLRP = event.After.ToActualLRP(event.ActualLRPKey, event.ActualLRPInstanceKey)
-	default:
-		return nil
-	}
-	if actualLRP == nil {
-		logger.Error("nil-actual-lrp", nil, lager.Data{"event-type": event.EventType()})
-		return nil
+func (watcher *Watcher) completeSync(logger lager.Logger, syncEvent *syncEventResult, cachedEvents map[string]models.Event) {
+	watcher.desiredLRPs.replace(syncEvent.desired)
+	for _, e := range cachedEvents {
+		watcher.desiredLRPs.handleEvent(e)
 	}
-	var desiredLRPs []*models.DesiredLRP
-	if actualLRP.State != models.ActualLRPStateRunning {
-		return nil
+
+	// the events of process guids whose desired LRP is missing are held back
+	// until it has been fetched off the event loop, like any other event
+	var cachedDesired []*models.DesiredLRP
+	var missingGuids []string
+	missing := map[string]struct{}{}
+	for _, e := range cachedEvents {
+		actualLRP := runningActualLRP(logger, e)
+		if actualLRP == nil {
+			continue
+		}
+		if !watcher.routeHandler.ShouldRefreshDesired(actualLRP) && foundInCurrentDesireds(actualLRP.ProcessGuid, syncEvent.desired) {
+			continue
+		}
+		if desiredLRP, ok := watcher.desiredLRPs.get(actualLRP.ProcessGuid); ok {
+			cachedDesired = append(cachedDesired, desiredLRP)
+			continue
+		}
+		if _, ok := missing[actualLRP.ProcessGuid]; !ok {
+			missing[actualLRP.ProcessGuid] = struct{}{}
+			missingGuids = append(missingGuids, actualLRP.ProcessGuid)
+		}
 	}
-	if w.routeHandler.ShouldRefreshDesired(actualLRP) || (syncing && !foundInCurrentDesireds(actualLRP.ProcessGuid, currentDesireds)) {
-		logger.Info("refreshing-desired-lrp-info", lager.Data{"process-guid": actualLRP.ProcessGuid})
-		desiredLRPs, err = w.bbsClient.DesiredLRPs(logger, models.DesiredLRPFilter{
-			ProcessGuids: []string{actualLRP.ProcessGuid},
-		})
-		if err != nil {
-			logger.Error("failed-getting-desired-lrps-for-missing-actual-lrp", err)
+
+	for key, e := range cachedEvents {
+		processGuid := eventProcessGuid(e)
+		if _, ok := missing[processGuid]; ok || watcher.desiredLRPFetches.holding(processGuid) {
+			watcher.desiredLRPFetches.hold(processGuid, e)
+			delete(cachedEvents, key)
 		}
 	}
+	if len(missingGuids) > 0 {
+		logger.Info("refreshing-desired-lrp-info", lager.Data{"process-guids": missingGuids})
+	}
+
+	if len(cachedDesired) > 0 {
+		syncEvent.desired = append(syncEvent.desired, cachedDesired...)
+	}
+
+	logger.Debug("calling-handler-sync")
+	watcher.routeHandler.Sync(logger,
+		syncEvent.desired,
+		syncEvent.runningActual,
+		syncEvent.domains,
+		cachedEvents,
+	)
+	watcher.fetchDesiredLRPs()
 
-	return desiredLRPs
+	after := watcher.clock.Now()
+	watcher.status.synced(after)
+	if err := watcher.metronClient.SendDuration(routeSyncDuration, after.Sub(syncEvent.startTime)); err != nil {
+		watcher.logger.Error("failed-to-send-route-sync-duration-metric", err)
+	}
+
+	logger.Info("complete")
 }
 
-func (w *Watcher) retrieveDesired(logger lager.Logger, event models.Event) []*models.DesiredLRP {
-	return w.retrieveDesiredInternal(logger, event, nil, false)
+// recordSync counts a successful or failed sync and sends how long ago the
+// last sync succeeded, which keeps growing while syncs fail.
+func (watcher *Watcher) recordSync(logger lager.Logger, counter string, lastSynced time.Time) {
+	if err := watcher.metronClient.IncrementCounter(counter); err != nil {
+		logger.Error("failed-to-send-sync-counter-metric", err, lager.Data{"counter": counter})
+	}
+	if err := watcher.metronClient.SendDuration(lastSyncAgeMetric, watcher.clock.Now().Sub(lastSynced)); err != nil {
+		logger.Error("failed-to-send-last-sync-age-metric", err)
+	}
 }
 
-func (w *Watcher) retrieveDesiredWhileSyncing(logger lager.Logger, event models.Event, currentDesireds []*models.DesiredLRP) []*models.DesiredLRP {
-	return w.retrieveDesiredInternal(logger, event, currentDesireds, true)
+func (watcher *Watcher) recordGap(start time.Time) {
+	duration := watcher.clock.Now().Sub(start)
+	watcher.logger.Info("event-stream-gap", lager.Data{"gap-start": start, "duration": duration.String()})
+
+	if err := watcher.metronClient.IncrementCounter(eventStreamGapsCounter); err != nil {
+		watcher.logger.Error("failed-to-send-event-stream-gaps-metric", err)
+	}
+	if err := watcher.metronClient.SendDuration(eventStreamGapDuration, duration); err != nil {
+		watcher.logger.Error("failed-to-send-event-stream-gap-duration-metric", err)
+	}
 }
 
 func foundInCurrentDesireds(guid string, currentDesireds []*models.DesiredLRP) bool {
@@ -235,13 +470,79 @@ func foundInCurrentDesireds(guid string, currentDesireds []*models.DesiredLRP) b
 }
 
 func (w *Watcher) handleEvent(logger lager.Logger, event models.Event) {
-	desiredLRPs := w.retrieveDesired(logger, event)
-	if len(desiredLRPs) > 0 {
-		w.routeHandler.RefreshDesired(logger, desiredLRPs)
+	processGuid := eventProcessGuid(event)
+	if w.desiredLRPFetches.holding(processGuid) {
+		w.desiredLRPFetches.hold(processGuid, event)
+		return
 	}
+
+	if actualLRP := runningActualLRP(logger, event); actualLRP != nil && w.routeHandler.ShouldRefreshDesired(actualLRP) {
+		desiredLRP, ok := w.desiredLRPs.get(actualLRP.ProcessGuid)
+		if !ok {
+			logger.Info("refreshing-desired-lrp-info", lager.Data{"process-guid": actualLRP.ProcessGuid})
+			w.desiredLRPFetches.hold(actualLRP.ProcessGuid, event)
+			return
+		}
+		w.routeHandler.RefreshDesired(logger, []*models.DesiredLRP{desiredLRP})
+	}
+
+	w.desiredLRPs.handleEvent(event)
 	w.routeHandler.HandleEvent(logger, event)
 }
 
+// fetchDesiredLRPs fetches the desired LRPs of the held back events off the
+// event loop, unless a fetch is already in flight.
+func (w *Watcher) fetchDesiredLRPs() {
+	processGuids := w.desiredLRPFetches.next()
+	if len(processGuids) == 0 {
+		return
+	}
+
+	logger := w.logger.Session("desired-lrp-fetch")
+	go func() {
+		desiredLRPs, err := getDesiredLRPs(logger, w.bbsClient, processGuids)
+		w.desiredLRPFetchResults <- desiredLRPFetchResult{
+			processGuids: processGuids,
+			desiredLRPs:  desiredLRPs,
+			err:          err,
+		}
+	}()
+}
+
+// completeDesiredLRPFetch refreshes the routes of the fetched desired LRPs and
+// handles the events that were held back for them. Events that are released
+// while syncing are cached instead.
+func (w *Watcher) completeDesiredLRPFetch(logger lager.Logger, result desiredLRPFetchResult, syncing bool, cachedEvents map[string]models.Event) {
+	w.desiredLRPFetches.inFlight = false
+	if result.err != nil {
+		logger.Error("failed-getting-desired-lrps-for-missing-actual-lrps", result.err)
+	}
+
+	fetched := map[string][]*models.DesiredLRP{}
+	for _, desiredLRP := range w.filterDesiredLRPs(result.desiredLRPs) {
+		w.desiredLRPs.set(desiredLRP)
+		fetched[desiredLRP.ProcessGuid] = append(fetched[desiredLRP.ProcessGuid], desiredLRP)
+	}
+
+	for _, processGuid := range result.processGuids {
+		events := w.desiredLRPFetches.release(processGuid)
+		if syncing {
+			for _, event := range events {
+				cachedEvents[event.Key()] = event
+			}
+			continue
+		}
+
+		if len(fetched[processGuid]) > 0 {
+			w.routeHandler.RefreshDesired(logger, fetched[processGuid])
+		}
+		for _, event := range events {
+			w.desiredLRPs.handleEvent(event)
+			w.routeHandler.HandleEvent(logger, event)
+		}
+	}
+}
+
 func (w *Watcher) sync(logger lager.Logger, ch chan<- *syncEventResult) {
 	var runningActualLRPs []*models.ActualLRP
 	var desiredLRPs []*models.DesiredLRP
@@ -314,47 +615,88 @@ func (w *Watcher) sync(logger lager.Logger, ch chan<- *syncEventResult) {
 
 	ch <- &syncEventResult{
 		startTime:     before,
-		desired:       desiredLRPs,
-		runningActual: runningActualLRPs,
+		desired:       w.filterDesiredLRPs(desiredLRPs),
+		runningActual: w.filterActualLRPs(runningActualLRPs),
 		domains:       domains,
 		err:           err,
 	}
 }
 
-func (w *Watcher) checkForEvents(resubscribeChannel chan error, eventChan chan models.Event, eventSource *atomic.Value, logger lager.Logger) {
+// checkForEvents subscribes to the BBS and forwards events until the event
+// source fails. If gapStart is set, this is a resubscription and the gap is
+// reported once subscribed. A run of unrecognized events is also reported as a
+// gap, since whatever they described has been lost. The subscription failures
+// are only reset once the event source delivers an event, so that a BBS that
+// accepts subscriptions but drops them right away keeps counting as failing.
+func (w *Watcher) checkForEvents(resubscribeChannel chan error, gapChannel chan time.Time, eventChan chan models.Event, eventSource *atomic.Value, gapStart time.Time, logger lager.Logger) {
 	var err error
 	var es events.EventSource
 
 	logger.Info("subscribing-to-bbs-events")
 	es, err = w.bbsClient.SubscribeToInstanceEventsByCellID(logger, w.cellID)
 	if err != nil {
+		w.sendSubscriptionFailures(logger, atomic.AddInt32(&w.subscriptionFailures, 1))
 		resubscribeChannel <- err
 		return
 	}
 	logger.Info("subscribed-to-bbs-events")
 
 	eventSource.Store(es)
+	w.status.subscribed(w.clock.Now())
+
+	if !gapStart.IsZero() {
+		gapChannel <- gapStart
+	}
 
 	var event models.Event
+	var unrecognizedStart time.Time
+	unrecognizedCount := 0
+	received := false
 	for {
 		event, err = es.Next()
 		if err != nil {
 			switch err {
 			case events.ErrUnrecognizedEventType:
 				logger.Error("failed-getting-next-event", err)
+				if unrecognizedCount == 0 {
+					unrecognizedStart = w.clock.Now()
+				}
+				unrecognizedCount++
+				if unrecognizedCount == unrecognizedEventThreshold {
+					logger.Info("unrecognized-event-storm", lager.Data{"count": unrecognizedCount})
+					gapChannel <- unrecognizedStart
+				}
+				continue
 			default:
+				if !received {
+					w.sendSubscriptionFailures(logger, atomic.AddInt32(&w.subscriptionFailures, 1))
+				}
 				resubscribeChannel <- err
 				return
 			}
 		}
 
 		if event != nil {
+			if !received {
+				received = true
+				if atomic.SwapInt32(&w.subscriptionFailures, 0) != 0 {
+					w.sendSubscriptionFailures(logger, 0)
+				}
+			}
+			unrecognizedCount = 0
 			eventChan <- event
 		}
 	}
 }
 
-func getDesiredLRPs(logger lager.Logger, bbsClient bbs.Client, guids []string) ([]*models.DesiredLRP, error) {
+func (w *Watcher) sendSubscriptionFailures(logger lager.Logger, failures int32) {
+	err := w.metronClient.SendMetric(subscriptionFailuresMetric, int(failures))
+	if err != nil {
+		logger.Error("failed-to-send-subscription-failures-metric", err)
+	}
+}
+
+func getDesiredLRPs(logger lager.Logger, bbsClient BBSClient, guids []string) ([]*models.DesiredLRP, error) {
 	logger.Debug("getting-desired-lrps", lager.Data{"guids-length": len(guids)})
 	desiredLRPs, err := bbsClient.DesiredLRPs(logger, models.DesiredLRPFilter{
 		ProcessGuids: guids,
@@ -31,18 +31,21 @@ import (
 
 var _ = Describe("Watcher Integration", func() {
 	var (
-		bbsClient        *fake_bbs.FakeClient
-		eventSource      *eventfakes.FakeEventSource
-		natsClient       *diegonats.FakeNATSClient
-		routingApiClient *fake_routing_api.FakeClient
-		syncCh           chan struct{}
-		emitExternalCh   chan struct{}
-		emitInternalCh   chan struct{}
-		cellID           string
-		testWatcher      *watcher.Watcher
-		process          ifrit.Process
-		logger           *lagertest.TestLogger
-		fakeMetronClient *mfakes.FakeIngressClient
+		bbsClient           *fake_bbs.FakeClient
+		eventSource         *eventfakes.FakeEventSource
+		natsClient          *diegonats.FakeNATSClient
+		routingApiClient    *fake_routing_api.FakeClient
+		syncCh              chan struct{}
+		emitExternalCh      chan struct{}
+		emitExternalSliceCh chan struct{}
+		emitInternalCh      chan struct{}
+		emitExternalToCh    chan string
+		emitInternalToCh    chan string
+		cellID              string
+		testWatcher         *watcher.Watcher
+		process             ifrit.Process
+		logger              *lagertest.TestLogger
+		fakeMetronClient    *mfakes.FakeIngressClient
 	)
 
 	BeforeEach(func() {
@@ -55,7 +58,10 @@ var _ = Describe("Watcher Integration", func() {
 
 		syncCh = make(chan struct{})
 		emitExternalCh = make(chan struct{})
+		emitExternalSliceCh = make(chan struct{})
 		emitInternalCh = make(chan struct{})
+		emitExternalToCh = make(chan string)
+		emitInternalToCh = make(chan string)
 
 		logger = lagertest.NewTestLogger("test")
 		workPool, err := workpool.NewWorkPool(1)
@@ -67,7 +73,7 @@ var _ = Describe("Watcher Integration", func() {
 		uaaClient := uaaclient.NewNoOpUaaClient()
 		routingAPIEmitter := emitter.NewRoutingAPIEmitter(logger, routingApiClient, uaaClient, 100)
 		unregistrationCache := unregistration.NewCache(logger)
-		handler := routehandlers.NewHandler(natsTable, natsEmitter, routingAPIEmitter, false, fakeMetronClient, unregistrationCache)
+		handler := routehandlers.NewHandler(natsTable, natsEmitter, routingAPIEmitter, false, fakeMetronClient, unregistrationCache, nil, false, 0)
 		clock := fakeclock.NewFakeClock(time.Now())
 		testWatcher = watcher.NewWatcher(
 			cellID,
@@ -76,9 +82,16 @@ var _ = Describe("Watcher Integration", func() {
 			handler,
 			syncCh,
 			emitExternalCh,
+			emitExternalSliceCh,
 			emitInternalCh,
+			emitExternalToCh,
+			emitInternalToCh,
 			logger,
 			fakeMetronClient,
+			watcher.RetryPolicy{},
+			watcher.RetryPolicy{},
+			0,
+			nil,
 		)
 	})
 
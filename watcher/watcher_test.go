@@ -1,7 +1,11 @@
 package watcher_test
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"time"
 
@@ -30,6 +34,16 @@ type EventHolder struct {
 	event models.Event
 }
 
+type processGuidFilter map[string]bool
+
+func (f processGuidFilter) DesiredLRP(desiredLRP *models.DesiredLRP) bool {
+	return f[desiredLRP.ProcessGuid]
+}
+
+func (f processGuidFilter) ActualLRP(actualLRP *models.ActualLRP) bool {
+	return f[actualLRP.ProcessGuid]
+}
+
 var _ = Describe("Watcher", func() {
 
 	getDesiredLRP := func(processGuid, logGuid string,
@@ -69,18 +83,25 @@ var _ = Describe("Watcher", func() {
 	}
 
 	var (
-		logger           *lagertest.TestLogger
-		eventSource      *eventfakes.FakeEventSource
-		bbsClient        *fake_bbs.FakeClient
-		routeHandler     *fakes.FakeRouteHandler
-		testWatcher      *watcher.Watcher
-		clock            *fakeclock.FakeClock
-		process          ifrit.Process
-		cellID           string
-		syncCh           chan struct{}
-		emitExternalCh   chan struct{}
-		emitInternalCh   chan struct{}
-		fakeMetronClient *mfakes.FakeIngressClient
+		logger              *lagertest.TestLogger
+		eventSource         *eventfakes.FakeEventSource
+		bbsClient           *fake_bbs.FakeClient
+		routeHandler        *fakes.FakeRouteHandler
+		testWatcher         *watcher.Watcher
+		clock               *fakeclock.FakeClock
+		process             ifrit.Process
+		cellID              string
+		syncCh              chan struct{}
+		emitExternalCh      chan struct{}
+		emitExternalSliceCh chan struct{}
+		emitInternalCh      chan struct{}
+		emitExternalToCh    chan string
+		emitInternalToCh    chan string
+		fakeMetronClient    *mfakes.FakeIngressClient
+		retryPolicy         watcher.RetryPolicy
+		syncRetryPolicy     watcher.RetryPolicy
+		coalesceWindow      time.Duration
+		filter              watcher.Filter
 	)
 
 	BeforeEach(func() {
@@ -94,11 +115,35 @@ var _ = Describe("Watcher", func() {
 
 		syncCh = make(chan struct{})
 		emitExternalCh = make(chan struct{})
+		emitExternalSliceCh = make(chan struct{})
 		emitInternalCh = make(chan struct{})
+		emitExternalToCh = make(chan string)
+		emitInternalToCh = make(chan string)
 		cellID = ""
 		fakeMetronClient = &mfakes.FakeIngressClient{}
+		retryPolicy = watcher.RetryPolicy{}
+		syncRetryPolicy = watcher.RetryPolicy{}
+		coalesceWindow = 0
+		filter = nil
 	})
 
+	incrementedCounters := func() []string {
+		var names []string
+		for i := 0; i < fakeMetronClient.IncrementCounterCallCount(); i++ {
+			names = append(names, fakeMetronClient.IncrementCounterArgsForCall(i))
+		}
+		return names
+	}
+
+	sentDurations := func() []string {
+		var names []string
+		for i := 0; i < fakeMetronClient.SendDurationCallCount(); i++ {
+			name, _, _ := fakeMetronClient.SendDurationArgsForCall(i)
+			names = append(names, name)
+		}
+		return names
+	}
+
 	JustBeforeEach(func() {
 		testWatcher = watcher.NewWatcher(
 			cellID,
@@ -107,9 +152,16 @@ var _ = Describe("Watcher", func() {
 			routeHandler,
 			syncCh,
 			emitExternalCh,
+			emitExternalSliceCh,
 			emitInternalCh,
+			emitExternalToCh,
+			emitInternalToCh,
 			logger,
 			fakeMetronClient,
+			retryPolicy,
+			syncRetryPolicy,
+			coalesceWindow,
+			filter,
 		)
 		process = ifrit.Invoke(testWatcher)
 	})
@@ -145,6 +197,31 @@ var _ = Describe("Watcher", func() {
 		})
 	})
 
+	Describe("Status", func() {
+		It("reports the subscription once subscribed", func() {
+			Eventually(func() bool { return testWatcher.Status().Subscribed }).Should(BeTrue())
+			Expect(testWatcher.Status().LastSubscribed).To(Equal(clock.Now()))
+		})
+
+		It("reports the first sync once it completed", func() {
+			Expect(testWatcher.Status().Synced).To(BeFalse())
+			syncCh <- struct{}{}
+			Eventually(func() bool { return testWatcher.Status().Synced }).Should(BeTrue())
+			Expect(testWatcher.Status().LastSynced).To(Equal(clock.Now()))
+		})
+
+		Context("when subscribing fails", func() {
+			BeforeEach(func() {
+				bbsClient.SubscribeToInstanceEventsByCellIDReturns(nil, errors.New("bam"))
+			})
+
+			It("is not subscribed", func() {
+				Eventually(bbsClient.SubscribeToInstanceEventsByCellIDCallCount).Should(BeNumerically(">=", 1))
+				Consistently(func() bool { return testWatcher.Status().Subscribed }).Should(BeFalse())
+			})
+		})
+	})
+
 	Context("handle DesiredLRPCreatedEvent", func() {
 		var (
 			event models.Event
@@ -163,6 +240,89 @@ var _ = Describe("Watcher", func() {
 		})
 	})
 
+	Context("when a filter is set", func() {
+		BeforeEach(func() {
+			filter = processGuidFilter{"process-guid-1": true}
+		})
+
+		Context("when the event is for an lrp that is filtered out", func() {
+			BeforeEach(func() {
+				desiredLRP := getDesiredLRP("process-guid-2", "log-guid-2", 5222, 61000)
+				eventSource.NextReturns(models.NewDesiredLRPCreatedEvent(desiredLRP), nil)
+			})
+
+			It("does not pass the event to the routeHandler", func() {
+				Consistently(routeHandler.HandleEventCallCount).Should(BeZero())
+			})
+		})
+
+		Context("when the event is for an lrp that passes the filter", func() {
+			BeforeEach(func() {
+				actualLRP := getActualLRP("process-guid-1", "instance-guid-1", "1.1.1.1", "2.2.2.2", 61000, 5222, false)
+				eventSource.NextReturns(models.NewActualLRPInstanceCreatedEvent(actualLRP), nil)
+			})
+
+			It("passes the event to the routeHandler", func() {
+				Eventually(routeHandler.HandleEventCallCount).Should(BeNumerically(">=", 1))
+			})
+		})
+
+		Context("when syncing", func() {
+			BeforeEach(func() {
+				bbsClient.ActualLRPsReturns([]*models.ActualLRP{
+					getActualLRP("process-guid-1", "instance-guid-1", "1.1.1.1", "2.2.2.2", 61000, 5222, false),
+					getActualLRP("process-guid-2", "instance-guid-2", "1.1.1.1", "2.2.2.2", 61001, 5222, false),
+				}, nil)
+				bbsClient.DesiredLRPsReturns([]*models.DesiredLRP{
+					getDesiredLRP("process-guid-1", "log-guid-1", 5222, 61000),
+					getDesiredLRP("process-guid-2", "log-guid-2", 5222, 61001),
+				}, nil)
+			})
+
+			It("only syncs the lrps that pass the filter", func() {
+				syncCh <- struct{}{}
+				Eventually(routeHandler.SyncCallCount).Should(Equal(1))
+				_, desired, actuals, _, _ := routeHandler.SyncArgsForCall(0)
+				Expect(desired).To(ConsistOf(getDesiredLRP("process-guid-1", "log-guid-1", 5222, 61000)))
+				Expect(actuals).To(HaveLen(1))
+				Expect(actuals[0].ProcessGuid).To(Equal("process-guid-1"))
+			})
+		})
+	})
+
+	Context("flushing the route handler", func() {
+		BeforeEach(func() {
+			desiredLRP := getDesiredLRP("process-guid-1", "log-guid-1", 5222, 61000)
+			eventSource.NextReturns(models.NewDesiredLRPCreatedEvent(desiredLRP), nil)
+		})
+
+		It("flushes after every event", func() {
+			Eventually(routeHandler.HandleEventCallCount).Should(BeNumerically(">=", 2))
+			Eventually(routeHandler.FlushCallCount).Should(BeNumerically(">=", 2))
+		})
+
+		Context("when a coalesce window is set", func() {
+			BeforeEach(func() {
+				coalesceWindow = time.Second
+			})
+
+			It("flushes once the window has passed", func() {
+				Eventually(routeHandler.HandleEventCallCount).Should(BeNumerically(">=", 2))
+				Consistently(routeHandler.FlushCallCount).Should(BeZero())
+
+				clock.WaitForWatcherAndIncrement(time.Second)
+				Eventually(routeHandler.FlushCallCount).Should(Equal(1))
+				Consistently(routeHandler.FlushCallCount).Should(Equal(1))
+			})
+
+			It("flushes when stopping", func() {
+				Eventually(routeHandler.HandleEventCallCount).Should(BeNumerically(">=", 1))
+				ginkgomon.Interrupt(process)
+				Expect(routeHandler.FlushCallCount()).To(Equal(1))
+			})
+		})
+	})
+
 	Context("handle DesiredLRPChangedEvent", func() {
 		var (
 			event models.Event
@@ -278,6 +438,14 @@ var _ = Describe("Watcher", func() {
 		It("should not close the current connection", func() {
 			Consistently(fakeRawEventSource.CloseCallCount).Should(Equal(0))
 		})
+
+		It("syncs once after a run of unrecognized events", func() {
+			Eventually(bbsClient.ActualLRPsCallCount).Should(Equal(1))
+			Consistently(bbsClient.ActualLRPsCallCount).Should(Equal(1))
+
+			Eventually(incrementedCounters).Should(ConsistOf("RouteEmitterEventStreamGaps", "RouteEmitterSyncSuccesses"))
+			Expect(fakeMetronClient.IncrementCounterArgsForCall(0)).To(Equal("RouteEmitterEventStreamGaps"))
+		})
 	})
 
 	Context("when eventSource returns error", func() {
@@ -324,6 +492,175 @@ var _ = Describe("Watcher", func() {
 		})
 	})
 
+	Context("when subscribing keeps failing", func() {
+		BeforeEach(func() {
+			retryPolicy = watcher.RetryPolicy{
+				MinBackoff:       time.Second,
+				MaxBackoff:       2 * time.Second,
+				FailureThreshold: 2,
+			}
+			bbsClient.SubscribeToInstanceEventsByCellIDReturns(nil, errors.New("bbs is down"))
+		})
+
+		It("backs off exponentially up to the maximum", func() {
+			Eventually(bbsClient.SubscribeToInstanceEventsByCellIDCallCount).Should(Equal(1))
+
+			clock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(bbsClient.SubscribeToInstanceEventsByCellIDCallCount).Should(Equal(2))
+
+			clock.WaitForWatcherAndIncrement(time.Second)
+			Consistently(bbsClient.SubscribeToInstanceEventsByCellIDCallCount).Should(Equal(2))
+			clock.Increment(time.Second)
+			Eventually(bbsClient.SubscribeToInstanceEventsByCellIDCallCount).Should(Equal(3))
+
+			clock.WaitForWatcherAndIncrement(2 * time.Second)
+			Eventually(bbsClient.SubscribeToInstanceEventsByCellIDCallCount).Should(Equal(4))
+		})
+
+		It("reports the consecutive failures and turns unhealthy after the threshold", func() {
+			Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(1))
+			name, value, _ := fakeMetronClient.SendMetricArgsForCall(0)
+			Expect(name).To(Equal("RouteEmitterBBSSubscriptionFailures"))
+			Expect(value).To(Equal(1))
+			Expect(testWatcher.Healthy()).To(BeTrue())
+
+			clock.WaitForWatcherAndIncrement(time.Second)
+			Eventually(testWatcher.Healthy).Should(BeFalse())
+			_, value, _ = fakeMetronClient.SendMetricArgsForCall(1)
+			Expect(value).To(Equal(2))
+		})
+
+		Context("when subscribing succeeds again", func() {
+			BeforeEach(func() {
+				bbsClient.SubscribeToInstanceEventsByCellIDStub = func(lager.Logger, string) (events.EventSource, error) {
+					if bbsClient.SubscribeToInstanceEventsByCellIDCallCount() <= 2 {
+						return nil, errors.New("bbs is down")
+					}
+					return eventSource, nil
+				}
+				eventSource.NextReturns(models.NewActualLRPInstanceCreatedEvent(
+					getActualLRP("pg-1", "ig-1", "1.1.1.1", "2.2.2.2", 61000, 8080, false),
+				), nil)
+			})
+
+			It("resets the failures and turns healthy once an event is received", func() {
+				clock.WaitForWatcherAndIncrement(time.Second)
+				Eventually(testWatcher.Healthy).Should(BeFalse())
+
+				clock.WaitForWatcherAndIncrement(2 * time.Second)
+				Eventually(testWatcher.Healthy).Should(BeTrue())
+				Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(3))
+				_, value, _ := fakeMetronClient.SendMetricArgsForCall(2)
+				Expect(value).To(Equal(0))
+			})
+		})
+
+		Context("when subscribing succeeds but the event stream fails before an event", func() {
+			BeforeEach(func() {
+				bbsClient.SubscribeToInstanceEventsByCellIDReturns(eventSource, nil)
+				eventSource.NextReturns(nil, errors.New("stream closed"))
+			})
+
+			It("keeps counting the failures and turns unhealthy after the threshold", func() {
+				Eventually(fakeMetronClient.SendMetricCallCount).Should(Equal(1))
+				name, value, _ := fakeMetronClient.SendMetricArgsForCall(0)
+				Expect(name).To(Equal("RouteEmitterBBSSubscriptionFailures"))
+				Expect(value).To(Equal(1))
+				Expect(testWatcher.Healthy()).To(BeTrue())
+
+				clock.WaitForWatcherAndIncrement(time.Second)
+				Eventually(testWatcher.Healthy).Should(BeFalse())
+				_, value, _ = fakeMetronClient.SendMetricArgsForCall(1)
+				Expect(value).To(Equal(2))
+				Expect(bbsClient.SubscribeToInstanceEventsByCellIDCallCount()).To(Equal(2))
+			})
+		})
+	})
+
+	Context("when the event stream resubscribes", func() {
+		var (
+			resubscribe chan struct{}
+			nextErr     chan error
+		)
+
+		BeforeEach(func() {
+			resubscribe = make(chan struct{})
+			nextErr = make(chan error, 1)
+
+			// make the variables local to avoid race detection
+			resubscribeCh := resubscribe
+			errCh := nextErr
+			bbsClient.SubscribeToInstanceEventsByCellIDStub = func(logger lager.Logger, cellID string) (events.EventSource, error) {
+				if bbsClient.SubscribeToInstanceEventsByCellIDCallCount() > 1 {
+					<-resubscribeCh
+				}
+				return eventSource, nil
+			}
+			eventSource.NextStub = func() (models.Event, error) {
+				select {
+				case err := <-errCh:
+					return nil, err
+				case <-time.After(10 * time.Millisecond):
+					return nil, nil
+				}
+			}
+		})
+
+		It("syncs as soon as it is subscribed again", func() {
+			nextErr <- errors.New("connection reset")
+			Eventually(bbsClient.SubscribeToInstanceEventsByCellIDCallCount).Should(Equal(2))
+			Consistently(bbsClient.ActualLRPsCallCount).Should(BeZero())
+
+			close(resubscribe)
+			Eventually(bbsClient.ActualLRPsCallCount).Should(Equal(1))
+			Eventually(routeHandler.SyncCallCount).Should(Equal(1))
+		})
+
+		It("emits the gap count and duration", func() {
+			nextErr <- errors.New("connection reset")
+			Eventually(bbsClient.SubscribeToInstanceEventsByCellIDCallCount).Should(Equal(2))
+			clock.Increment(5 * time.Second)
+			close(resubscribe)
+
+			Eventually(incrementedCounters).Should(ContainElement("RouteEmitterEventStreamGaps"))
+			Expect(fakeMetronClient.IncrementCounterArgsForCall(0)).To(Equal("RouteEmitterEventStreamGaps"))
+
+			Eventually(fakeMetronClient.SendDurationCallCount).Should(BeNumerically(">=", 1))
+			metric, value, _ := fakeMetronClient.SendDurationArgsForCall(0)
+			Expect(metric).To(Equal("RouteEmitterEventStreamGapDuration"))
+			Expect(value).To(Equal(5 * time.Second))
+		})
+
+		Context("when a sync is already in progress", func() {
+			var blockSync chan struct{}
+
+			BeforeEach(func() {
+				blockSync = make(chan struct{})
+				block := blockSync
+				bbsClient.ActualLRPsStub = func(lager.Logger, models.ActualLRPFilter) ([]*models.ActualLRP, error) {
+					if bbsClient.ActualLRPsCallCount() == 1 {
+						<-block
+					}
+					return nil, nil
+				}
+			})
+
+			It("syncs again once the current sync completes", func() {
+				syncCh <- struct{}{}
+				Eventually(bbsClient.ActualLRPsCallCount).Should(Equal(1))
+
+				nextErr <- errors.New("connection reset")
+				close(resubscribe)
+				Eventually(logger).Should(gbytes.Say("sync-after-current-sync"))
+				Expect(bbsClient.ActualLRPsCallCount()).To(Equal(1))
+
+				close(blockSync)
+				Eventually(bbsClient.ActualLRPsCallCount).Should(Equal(2))
+				Eventually(routeHandler.SyncCallCount).Should(Equal(2))
+			})
+		})
+	})
+
 	Describe("emit external event", func() {
 		It("emits registrations", func() {
 			emitExternalCh <- struct{}{}
@@ -331,6 +668,14 @@ var _ = Describe("Watcher", func() {
 		})
 	})
 
+	Describe("periodic emit external event", func() {
+		It("emits the next slice of the registrations", func() {
+			emitExternalSliceCh <- struct{}{}
+			Eventually(routeHandler.EmitExternalSliceCallCount).Should(Equal(1))
+			Expect(routeHandler.EmitExternalCallCount()).To(BeZero())
+		})
+	})
+
 	Describe("emit internal event", func() {
 		It("emits registrations", func() {
 			emitInternalCh <- struct{}{}
@@ -338,6 +683,147 @@ var _ = Describe("Watcher", func() {
 		})
 	})
 
+	Describe("emit external to event", func() {
+		It("emits the registrations to the subject", func() {
+			emitExternalToCh <- "_INBOX.new-router"
+			Eventually(routeHandler.EmitExternalToCallCount).Should(Equal(1))
+			_, subject := routeHandler.EmitExternalToArgsForCall(0)
+			Expect(subject).To(Equal("_INBOX.new-router"))
+		})
+	})
+
+	Describe("emit internal to event", func() {
+		It("emits the registrations to the subject", func() {
+			emitInternalToCh <- "_INBOX.new-service-discovery"
+			Eventually(routeHandler.EmitInternalToCallCount).Should(Equal(1))
+			_, subject := routeHandler.EmitInternalToArgsForCall(0)
+			Expect(subject).To(Equal("_INBOX.new-service-discovery"))
+		})
+	})
+
+	Describe("DryRunSync", func() {
+		var (
+			desiredLRP *models.DesiredLRP
+			actualLRP  *models.ActualLRP
+			messages   routingtable.MessagesToEmit
+		)
+
+		BeforeEach(func() {
+			desiredLRP = getDesiredLRP("pg-1", "lg-1", 5222, 61000)
+			actualLRP = getActualLRP("pg-1", "ig-1", "1.1.1.1", "", 11, 5222, false)
+			bbsClient.DesiredLRPsReturns([]*models.DesiredLRP{desiredLRP}, nil)
+			bbsClient.ActualLRPsReturns([]*models.ActualLRP{actualLRP}, nil)
+			bbsClient.DomainsReturns([]string{"domain"}, nil)
+
+			endpoint := routingtable.Endpoint{InstanceGUID: "ig-1", Host: "1.1.1.1", Port: 11}
+			messages = routingtable.MessagesToEmit{
+				RegistrationMessages: []routingtable.RegistryMessage{
+					routingtable.RegistryMessageFor(endpoint, routingtable.Route{Hostname: "foo.example.com", LogGUID: "lg-1"}, false),
+				},
+			}
+			routeHandler.DiffSyncReturns(routingtable.TCPRouteMappings{}, messages)
+		})
+
+		It("diffs the lrps against the routing table without syncing", func() {
+			_, dryRunMessages, err := testWatcher.DryRunSync(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dryRunMessages).To(Equal(messages))
+
+			Expect(routeHandler.DiffSyncCallCount()).To(Equal(1))
+			_, desired, actuals, domains := routeHandler.DiffSyncArgsForCall(0)
+			Expect(desired).To(ConsistOf(desiredLRP))
+			Expect(actuals).To(ConsistOf(actualLRP))
+			Expect(domains).To(Equal(models.NewDomainSet([]string{"domain"})))
+			Expect(routeHandler.SyncCallCount()).To(BeZero())
+		})
+
+		Context("when fetching the lrps fails", func() {
+			BeforeEach(func() {
+				bbsClient.DomainsReturns(nil, errors.New("bam"))
+			})
+
+			It("returns an error", func() {
+				_, _, err := testWatcher.DryRunSync(context.Background())
+				Expect(err).To(HaveOccurred())
+				Expect(routeHandler.DiffSyncCallCount()).To(BeZero())
+			})
+		})
+
+		Context("when the context is done", func() {
+			It("returns the context error", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				_, _, err := testWatcher.DryRunSync(ctx)
+				Expect(err).To(Equal(context.Canceled))
+			})
+		})
+
+		Describe("the dry run handler", func() {
+			It("reports the changes as json", func() {
+				resp := httptest.NewRecorder()
+				req := httptest.NewRequest("GET", "/sync/dry-run", nil)
+				watcher.NewDryRunHandler(logger, testWatcher).ServeHTTP(resp, req)
+				Expect(resp.Code).To(Equal(http.StatusOK))
+
+				var report watcher.DryRunReport
+				Expect(json.Unmarshal(resp.Body.Bytes(), &report)).To(Succeed())
+				Expect(report.Registrations).To(HaveLen(1))
+				Expect(report.Registrations[0].URIs).To(ConsistOf("foo.example.com"))
+				Expect(report.Unregistrations).To(BeEmpty())
+			})
+
+			Context("when the dry run fails", func() {
+				BeforeEach(func() {
+					bbsClient.DomainsReturns(nil, errors.New("bam"))
+				})
+
+				It("responds with service unavailable", func() {
+					resp := httptest.NewRecorder()
+					req := httptest.NewRequest("GET", "/sync/dry-run", nil)
+					watcher.NewDryRunHandler(logger, testWatcher).ServeHTTP(resp, req)
+					Expect(resp.Code).To(Equal(http.StatusServiceUnavailable))
+				})
+			})
+
+			Context("when a dry run is already in progress", func() {
+				var release chan struct{}
+
+				BeforeEach(func() {
+					release = make(chan struct{})
+
+					// make the variable local to avoid race detection
+					releaseCh := release
+					bbsClient.DomainsStub = func(lager.Logger) ([]string, error) {
+						<-releaseCh
+						return []string{"domain"}, nil
+					}
+				})
+
+				It("responds with too many requests until it completes", func() {
+					done := make(chan error, 1)
+					go func() {
+						_, _, err := testWatcher.DryRunSync(context.Background())
+						done <- err
+					}()
+					Eventually(bbsClient.DomainsCallCount).Should(Equal(1))
+
+					resp := httptest.NewRecorder()
+					req := httptest.NewRequest("GET", "/sync/dry-run", nil)
+					watcher.NewDryRunHandler(logger, testWatcher).ServeHTTP(resp, req)
+					Expect(resp.Code).To(Equal(http.StatusTooManyRequests))
+
+					close(release)
+					Eventually(done).Should(Receive(BeNil()))
+
+					resp = httptest.NewRecorder()
+					watcher.NewDryRunHandler(logger, testWatcher).ServeHTTP(resp, req)
+					Expect(resp.Code).To(Equal(http.StatusOK))
+					Expect(bbsClient.DomainsCallCount()).To(Equal(2))
+				})
+			})
+		})
+	})
+
 	Describe("Sync Events", func() {
 		var (
 			errCh   chan error
@@ -620,7 +1106,55 @@ var _ = Describe("Watcher", func() {
 			})
 
 			It("does not emit the sync duration metric", func() {
-				Consistently(fakeMetronClient.SendDurationCallCount).Should(BeZero())
+				Consistently(sentDurations).ShouldNot(ContainElement("RouteEmitterSyncDuration"))
+			})
+
+			It("counts the failure and sends the age of the last successful sync", func() {
+				Eventually(incrementedCounters).Should(ConsistOf("RouteEmitterSyncFailures"))
+				Expect(sentDurations()).To(ConsistOf("RouteEmitterLastSuccessfulSyncAge"))
+
+				clock.Increment(time.Minute)
+				close(errCh)
+				syncCh <- struct{}{}
+
+				Eventually(incrementedCounters).Should(ConsistOf("RouteEmitterSyncFailures", "RouteEmitterSyncSuccesses"))
+				Eventually(sentDurations).Should(ContainElement("RouteEmitterSyncDuration"))
+				name, age, _ := fakeMetronClient.SendDurationArgsForCall(fakeMetronClient.SendDurationCallCount() - 1)
+				Expect(name).To(Equal("RouteEmitterLastSuccessfulSyncAge"))
+				Expect(age).To(BeZero())
+			})
+
+			It("waits for the next sync interval to retry", func() {
+				Eventually(bbsClient.DomainsCallCount).Should(Equal(1))
+				clock.Increment(time.Hour)
+				Consistently(bbsClient.DomainsCallCount).Should(Equal(1))
+			})
+
+			Context("when failed syncs are retried", func() {
+				BeforeEach(func() {
+					syncRetryPolicy = watcher.RetryPolicy{MinBackoff: time.Second, MaxBackoff: 4 * time.Second}
+					errCh = make(chan error, 3)
+					errCh <- errors.New("bam")
+					errCh <- errors.New("bam")
+					errCh <- errors.New("bam")
+				})
+
+				It("retries with backoff until the sync succeeds", func() {
+					Eventually(bbsClient.DomainsCallCount).Should(Equal(1))
+
+					clock.WaitForWatcherAndIncrement(time.Second)
+					Eventually(bbsClient.DomainsCallCount).Should(Equal(2))
+					Eventually(logger).Should(gbytes.Say("waiting-to-retry-sync.*\"backoff\":\"2s\""))
+
+					clock.WaitForWatcherAndIncrement(2 * time.Second)
+					Eventually(bbsClient.DomainsCallCount).Should(Equal(3))
+					Eventually(logger).Should(gbytes.Say("waiting-to-retry-sync.*\"backoff\":\"4s\""))
+
+					close(errCh)
+					clock.WaitForWatcherAndIncrement(4 * time.Second)
+					Eventually(routeHandler.SyncCallCount).Should(Equal(1))
+					Expect(bbsClient.DomainsCallCount()).To(Equal(4))
+				})
 			})
 		})
 
@@ -665,7 +1199,7 @@ var _ = Describe("Watcher", func() {
 			})
 
 			It("should emit the sync duration, and allow event processing", func() {
-				Eventually(fakeMetronClient.SendDurationCallCount).Should(Equal(1))
+				Eventually(fakeMetronClient.SendDurationCallCount).Should(BeNumerically(">=", 1))
 				metric, value, _ := fakeMetronClient.SendDurationArgsForCall(0)
 				Expect(metric).To(Equal("RouteEmitterSyncDuration"))
 				Expect(value).To(BeNumerically(">=", 100*time.Millisecond))
@@ -822,18 +1356,21 @@ var _ = Describe("Watcher", func() {
 						}
 					})
 
-					It("fetches the desired lrp and refreshes the handler", func() {
-						Eventually(bbsClient.DesiredLRPsCallCount).Should(Equal(2))
+					It("fetches the desired lrp after the sync and refreshes the handler", func() {
+						Eventually(routeHandler.SyncCallCount).Should(Equal(1))
+						_, desiredInfo, _, _, cachedEvents := routeHandler.SyncArgsForCall(0)
+						Expect(desiredInfo).NotTo(ContainElement(desiredLRP3))
+						Expect(cachedEvents).To(BeEmpty())
 
+						Eventually(bbsClient.DesiredLRPsCallCount).Should(Equal(2))
 						_, filter := bbsClient.DesiredLRPsArgsForCall(1)
-
 						Expect(filter.ProcessGuids).To(HaveLen(1))
 						Expect(filter.ProcessGuids).To(ConsistOf(actualLRP3.ProcessGuid))
 
-						Eventually(routeHandler.ShouldRefreshDesiredCallCount).Should(Equal(1))
-						Eventually(routeHandler.SyncCallCount).Should(Equal(1))
-						_, desiredInfo, _, _, _ := routeHandler.SyncArgsForCall(0)
+						Eventually(routeHandler.RefreshDesiredCallCount).Should(Equal(1))
+						_, desiredInfo = routeHandler.RefreshDesiredArgsForCall(0)
 						Expect(desiredInfo).To(ContainElement(desiredLRP3))
+						Eventually(routeHandler.HandleEventCallCount).Should(Equal(1))
 					})
 
 					Context("and fetching desired scheduling info fails", func() {
@@ -893,6 +1430,90 @@ var _ = Describe("Watcher", func() {
 			})
 		})
 
+		Context("when the desired lrp of an actual lrp event was synced", func() {
+			BeforeEach(func() {
+				routeHandler.ShouldRefreshDesiredReturns(true)
+				bbsClient.DesiredLRPsReturns([]*models.DesiredLRP{desiredLRP1, desiredLRP3}, nil)
+				sendEvent = func() {
+					Eventually(eventCh).Should(BeSent(EventHolder{models.NewActualLRPInstanceCreatedEvent(actualLRP3)}))
+				}
+			})
+
+			It("refreshes the routes without fetching the desired lrp", func() {
+				Eventually(routeHandler.SyncCallCount).Should(Equal(1))
+				sendEvent()
+
+				Eventually(routeHandler.HandleEventCallCount).Should(Equal(1))
+				Expect(routeHandler.RefreshDesiredCallCount()).To(Equal(1))
+				_, desired := routeHandler.RefreshDesiredArgsForCall(0)
+				Expect(desired).To(ConsistOf(desiredLRP3))
+				Consistently(bbsClient.DesiredLRPsCallCount).Should(Equal(1))
+			})
+
+			Context("when the desired lrp is removed", func() {
+				It("fetches it again", func() {
+					Eventually(routeHandler.SyncCallCount).Should(Equal(1))
+					Eventually(eventCh).Should(BeSent(EventHolder{models.NewDesiredLRPRemovedEvent(desiredLRP3)}))
+					sendEvent()
+
+					Eventually(bbsClient.DesiredLRPsCallCount).Should(Equal(2))
+					_, filter := bbsClient.DesiredLRPsArgsForCall(1)
+					Expect(filter.ProcessGuids).To(ConsistOf("pg-3"))
+				})
+			})
+		})
+
+		Context("when the desired lrps of several actual lrp events are missing", func() {
+			var unblock chan struct{}
+
+			BeforeEach(func() {
+				unblock = make(chan struct{})
+				blocked := unblock
+				routeHandler.ShouldRefreshDesiredReturns(true)
+				bbsClient.DesiredLRPsStub = func(_ lager.Logger, f models.DesiredLRPFilter) ([]*models.DesiredLRP, error) {
+					switch {
+					case len(f.ProcessGuids) == 0:
+						return []*models.DesiredLRP{desiredLRP1}, nil
+					case f.ProcessGuids[0] == "pg-2":
+						<-blocked
+						return []*models.DesiredLRP{desiredLRP2}, nil
+					default:
+						return []*models.DesiredLRP{desiredLRP3}, nil
+					}
+				}
+			})
+
+			It("fetches them in batches without blocking the event loop", func() {
+				Eventually(routeHandler.SyncCallCount).Should(Equal(1))
+
+				createdEvent2 := models.NewActualLRPInstanceCreatedEvent(actualLRP2)
+				removedEvent2 := models.NewActualLRPInstanceRemovedEvent(actualLRP2)
+				createdEvent3 := models.NewActualLRPInstanceCreatedEvent(actualLRP3)
+				Eventually(eventCh).Should(BeSent(EventHolder{createdEvent2}))
+				Eventually(bbsClient.DesiredLRPsCallCount).Should(Equal(2))
+				Eventually(eventCh).Should(BeSent(EventHolder{removedEvent2}))
+				Eventually(eventCh).Should(BeSent(EventHolder{createdEvent3}))
+
+				emitExternalCh <- struct{}{}
+				Eventually(routeHandler.EmitExternalCallCount).Should(Equal(1))
+				Expect(routeHandler.HandleEventCallCount()).To(BeZero())
+
+				close(unblock)
+				Eventually(routeHandler.HandleEventCallCount).Should(Equal(3))
+				Expect(bbsClient.DesiredLRPsCallCount()).To(Equal(3))
+				_, filter := bbsClient.DesiredLRPsArgsForCall(2)
+				Expect(filter.ProcessGuids).To(ConsistOf("pg-3"))
+
+				_, event := routeHandler.HandleEventArgsForCall(0)
+				Expect(event).To(Equal(createdEvent2))
+				_, event = routeHandler.HandleEventArgsForCall(1)
+				Expect(event).To(Equal(removedEvent2))
+				_, event = routeHandler.HandleEventArgsForCall(2)
+				Expect(event).To(Equal(createdEvent3))
+				Expect(routeHandler.RefreshDesiredCallCount()).To(Equal(2))
+			})
+		})
+
 		Context("when actual lrp state is not running", func() {
 			BeforeEach(func() {
 				actualLRP4 := &models.ActualLRP{